@@ -0,0 +1,162 @@
+// Package apitest helpers to test the HTTP API
+package apitest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/feserr/pheme-user/auth"
+	"github.com/feserr/pheme-user/middleware"
+	"github.com/feserr/pheme-user/models"
+	"github.com/feserr/pheme-user/problem"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Secret signs the JWT of the test users.
+const Secret = "test-secret"
+
+// Verifier returns the verifier of the JWT signed with the Secret.
+func Verifier(t *testing.T) *auth.Verifier {
+	t.Helper()
+
+	verifier, err := auth.NewVerifier(auth.Config{
+		Algorithms: []string{"HS256"},
+		Secret:     Secret,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return verifier
+}
+
+// User is a test user with its credentials.
+type User struct {
+	models.User
+	JWT  string
+	CSRF string
+}
+
+// NewUser returns the credentials of the user, signed like the pheme-auth
+// service does.
+func NewUser(t *testing.T, user models.User) User {
+	t.Helper()
+
+	claims := jwt.StandardClaims{
+		Issuer:    fmt.Sprint(user.ID),
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(Secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return User{User: user, JWT: token, CSRF: "csrf-" + user.Name}
+}
+
+// Server sends the requests to the app.
+type Server struct {
+	T   *testing.T
+	App *fiber.App
+}
+
+// Request sends a request authenticated with the cookies of the user.
+func (s *Server) Request(user User, method string, target string, body interface{}) *http.Response {
+	s.T.Helper()
+
+	req := NewRequest(s.T, method, target, body)
+	if user.JWT != "" {
+		req.Header.Set(fiber.HeaderCookie, fmt.Sprintf("jwt=%s; %s=%s", user.JWT, middleware.CSRFCookie, user.CSRF))
+		req.Header.Set(middleware.CSRFHeader, user.CSRF)
+	}
+
+	return s.Do(req)
+}
+
+// Bearer sends a request authenticated with the Authorization header.
+func (s *Server) Bearer(token string, method string, target string, body interface{}) *http.Response {
+	s.T.Helper()
+
+	req := NewRequest(s.T, method, target, body)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+
+	return s.Do(req)
+}
+
+// Do sends the request.
+func (s *Server) Do(req *http.Request) *http.Response {
+	s.T.Helper()
+
+	res, err := s.App.Test(req, -1)
+	if err != nil {
+		s.T.Fatal(err)
+	}
+
+	return res
+}
+
+// NewRequest returns a request with the body encoded as JSON.
+func NewRequest(t *testing.T, method string, target string, body interface{}) *http.Request {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, target, reader)
+	if body != nil {
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	}
+
+	return req
+}
+
+// ExpectStatus fails the test if the response doesn't have the status.
+func ExpectStatus(t *testing.T, res *http.Response, status int) {
+	t.Helper()
+
+	if res.StatusCode != status {
+		body, _ := io.ReadAll(res.Body)
+		t.Fatalf("%s %s: status %d, want %d: %s", res.Request.Method, res.Request.URL, res.StatusCode, status, body)
+	}
+}
+
+// ExpectProblem fails the test unless the response is a problem details of
+// the status and code, and returns it.
+func ExpectProblem(t *testing.T, res *http.Response, status int, code string) models.Problem {
+	t.Helper()
+
+	ExpectStatus(t, res, status)
+	if contentType := res.Header.Get(fiber.HeaderContentType); contentType != problem.ContentType {
+		t.Fatalf("%s %s: content type %q, want %q", res.Request.Method, res.Request.URL, contentType, problem.ContentType)
+	}
+
+	var details models.Problem
+	Decode(t, res, &details)
+	if details.Status != status || details.Code != code {
+		t.Fatalf("%s %s: got problem %+v, want status %d and code %s", res.Request.Method, res.Request.URL, details, status, code)
+	}
+
+	return details
+}
+
+// Decode decodes the JSON body of the response.
+func Decode(t *testing.T, res *http.Response, value interface{}) {
+	t.Helper()
+
+	if err := json.NewDecoder(res.Body).Decode(value); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,31 @@
+// Package auth JWT verification
+package auth
+
+import (
+	"time"
+)
+
+// Config of the JWT verification.
+type Config struct {
+	// Algorithms accepted in the token header, e.g. HS256, RS256 or ES256.
+	Algorithms []string
+	// Secret used to verify HMAC signed tokens.
+	Secret string
+	// PublicKeyFile is a PEM file with a RSA or ECDSA public key.
+	PublicKeyFile string
+	// JWKSFile is a local JSON Web Key Set file.
+	JWKSFile string
+	// JWKSURL is a remote JSON Web Key Set endpoint.
+	JWKSURL string
+	// JWKSCacheTTL is the time after which the key set is loaded again.
+	JWKSCacheTTL time.Duration
+	// JWKSMinRefresh is the minimum time between two loads of the key set
+	// triggered by an unknown kid.
+	JWKSMinRefresh time.Duration
+	// Audience required in the aud claim, ignored when empty.
+	Audience string
+	// Issuer required in the iss claim, ignored when empty.
+	Issuer string
+	// Leeway applied to the exp and nbf claims.
+	Leeway time.Duration
+}
@@ -0,0 +1,298 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// jsonWebKey is a public key of a JSON Web Key Set.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// minRetry is the minimum time before loading again a key set that failed.
+const minRetry = time.Second
+
+// keySet holds the public keys by kid and loads them again when they get
+// stale or a token references an unknown kid.
+type keySet struct {
+	mu         sync.RWMutex
+	keys       map[string]crypto.PublicKey
+	loaded     time.Time
+	load       func() ([]byte, error)
+	ttl        time.Duration
+	minRefresh time.Duration
+
+	// The last failed load, returned until the backoff of the failures in a
+	// row is over so an outage of the JWKS URL isn't hit by every request.
+	err      error
+	failed   time.Time
+	failures int
+}
+
+func newFileKeySet(path string, ttl time.Duration, minRefresh time.Duration) *keySet {
+	return &keySet{
+		keys:       map[string]crypto.PublicKey{},
+		load:       func() ([]byte, error) { return os.ReadFile(path) },
+		ttl:        ttl,
+		minRefresh: minRefresh,
+	}
+}
+
+func newURLKeySet(url string, ttl time.Duration, minRefresh time.Duration) *keySet {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	return &keySet{
+		keys: map[string]crypto.PublicKey{},
+		load: func() ([]byte, error) {
+			res, err := client.Get(url)
+			if err != nil {
+				return nil, err
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != http.StatusOK {
+				return nil, fmt.Errorf("unexpected JWKS response status %d", res.StatusCode)
+			}
+
+			return io.ReadAll(res.Body)
+		},
+		ttl:        ttl,
+		minRefresh: minRefresh,
+	}
+}
+
+// refresh loads the key set again unless it was loaded less than minAge ago,
+// or the last load failed less than the backoff ago: then it returns its error.
+func (s *keySet) refresh(minAge time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.loaded.IsZero() && time.Since(s.loaded) < minAge {
+		return nil
+	}
+
+	if s.err != nil && time.Since(s.failed) < s.backoff() {
+		return s.err
+	}
+
+	keys, err := s.loadKeys()
+	if err != nil {
+		s.err = err
+		s.failed = time.Now()
+		s.failures++
+		return err
+	}
+
+	s.keys = keys
+	s.loaded = time.Now()
+	s.err = nil
+	s.failures = 0
+
+	return nil
+}
+
+// loadKeys loads and parses the key set.
+func (s *keySet) loadKeys() (map[string]crypto.PublicKey, error) {
+	data, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return parseJWKS(data)
+}
+
+// backoff returns the time to wait after the failed loads in a row: the
+// minimum refresh, doubled by failure up to the TTL.
+func (s *keySet) backoff() time.Duration {
+	delay := s.minRefresh
+	if delay < minRetry {
+		delay = minRetry
+	}
+
+	limit := s.ttl
+	if limit < delay {
+		limit = delay
+	}
+
+	for i := 1; i < s.failures && delay < limit; i++ {
+		delay *= 2
+	}
+	if delay > limit {
+		delay = limit
+	}
+
+	return delay
+}
+
+// key returns the public key with the kid. An empty kid matches the only key
+// of the set.
+func (s *keySet) key(kid string) (crypto.PublicKey, error) {
+	s.mu.RLock()
+	stale := s.loaded.IsZero() || time.Since(s.loaded) > s.ttl
+	s.mu.RUnlock()
+
+	if stale {
+		if err := s.refresh(0); err != nil {
+			return nil, err
+		}
+	}
+
+	if key, ok := s.lookup(kid); ok {
+		return key, nil
+	}
+
+	// The keys may have been rotated, load them again.
+	if err := s.refresh(s.minRefresh); err != nil {
+		return nil, err
+	}
+
+	if key, ok := s.lookup(kid); ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+func (s *keySet) lookup(kid string) (crypto.PublicKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+// parseJWKS returns the signing keys of a JSON Web Key Set by kid.
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", jwk.Kid, err)
+		}
+
+		keys[jwk.Kid] = key
+	}
+
+	return keys, nil
+}
+
+func (jwk jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(bytes), nil
+}
+
+// parsePublicKeyFile returns the RSA or ECDSA public key of a PEM file.
+func parsePublicKeyFile(path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	switch key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return key, nil
+	default:
+		return nil, errors.New("unsupported public key type")
+	}
+}
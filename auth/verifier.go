@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+var (
+	ErrMissingExpiration = errors.New("token has no expiration")
+	ErrTokenExpired      = errors.New("token is expired")
+	ErrTokenNotValidYet  = errors.New("token is not valid yet")
+	ErrInvalidAudience   = errors.New("token has an invalid audience")
+	ErrInvalidIssuer     = errors.New("token has an invalid issuer")
+	ErrInvalidSubject    = errors.New("token has an invalid subject")
+)
+
+// Audience of a token, encoded as a string or an array of strings.
+type Audience []string
+
+// UnmarshalJSON accepts a single audience or a list of them.
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+
+	*a = list
+	return nil
+}
+
+// Contains returns if the audience includes the value.
+func (a Audience) Contains(value string) bool {
+	for _, audience := range a {
+		if audience == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Claims of the tokens accepted by the service.
+type Claims struct {
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	Issuer    string   `json:"iss,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+}
+
+// Valid is a no-op, the claims are validated by the Verifier with its leeway.
+func (c *Claims) Valid() error {
+	return nil
+}
+
+// UserID returns the ID of the user the token was issued for. The pheme-auth
+// service stores it in the iss claim, so it is used when there is no sub.
+func (c *Claims) UserID() (uint, error) {
+	subject := c.Subject
+	if subject == "" {
+		subject = c.Issuer
+	}
+
+	userID, err := strconv.ParseUint(subject, 10, 0)
+	if err != nil || userID == 0 {
+		return 0, ErrInvalidSubject
+	}
+
+	return uint(userID), nil
+}
+
+// Verifier validates the signature and the claims of the tokens.
+type Verifier struct {
+	config    Config
+	parser    *jwt.Parser
+	publicKey crypto.PublicKey
+	keys      *keySet
+}
+
+// NewVerifier returns a verifier for the config, loading its keys.
+func NewVerifier(config Config) (*Verifier, error) {
+	if len(config.Algorithms) == 0 {
+		return nil, errors.New("no JWT algorithms configured")
+	}
+
+	verifier := &Verifier{
+		config: config,
+		parser: &jwt.Parser{
+			ValidMethods:         config.Algorithms,
+			SkipClaimsValidation: true,
+		},
+	}
+
+	asymmetric := false
+	for _, algorithm := range config.Algorithms {
+		switch {
+		case strings.HasPrefix(algorithm, "HS"):
+			if config.Secret == "" {
+				return nil, fmt.Errorf("a secret is required for the %s algorithm", algorithm)
+			}
+		case strings.HasPrefix(algorithm, "RS"), strings.HasPrefix(algorithm, "ES"):
+			asymmetric = true
+		default:
+			return nil, fmt.Errorf("unsupported JWT algorithm %q", algorithm)
+		}
+
+		if jwt.GetSigningMethod(algorithm) == nil {
+			return nil, fmt.Errorf("unsupported JWT algorithm %q", algorithm)
+		}
+	}
+
+	if config.JWKSFile != "" && config.JWKSURL != "" {
+		return nil, errors.New("only one of the JWKS file or URL can be configured")
+	}
+
+	if config.PublicKeyFile != "" {
+		key, err := parsePublicKeyFile(config.PublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't load the public key: %w", err)
+		}
+
+		verifier.publicKey = key
+	}
+
+	switch {
+	case config.JWKSFile != "":
+		verifier.keys = newFileKeySet(config.JWKSFile, config.JWKSCacheTTL, config.JWKSMinRefresh)
+		if err := verifier.keys.refresh(0); err != nil {
+			return nil, fmt.Errorf("couldn't load the JWKS file: %w", err)
+		}
+	case config.JWKSURL != "":
+		verifier.keys = newURLKeySet(config.JWKSURL, config.JWKSCacheTTL, config.JWKSMinRefresh)
+	}
+
+	if asymmetric && verifier.publicKey == nil && verifier.keys == nil {
+		return nil, errors.New("a public key or a JWKS is required for asymmetric algorithms")
+	}
+
+	return verifier, nil
+}
+
+// Verify returns the claims of the token if its signature and claims are valid.
+func (v *Verifier) Verify(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	if _, err := v.parser.ParseWithClaims(tokenString, claims, v.keyFunc); err != nil {
+		return nil, err
+	}
+
+	if err := v.validate(claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (v *Verifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		return []byte(v.config.Secret), nil
+	}
+
+	if v.keys != nil {
+		kid, _ := token.Header["kid"].(string)
+		key, err := v.keys.key(kid)
+		if err == nil {
+			return key, nil
+		}
+
+		if v.publicKey == nil {
+			return nil, err
+		}
+	}
+
+	if v.publicKey != nil {
+		return v.publicKey, nil
+	}
+
+	return nil, errors.New("no public key configured")
+}
+
+func (v *Verifier) validate(claims *Claims) error {
+	now := time.Now()
+	leeway := int64(v.config.Leeway / time.Second)
+
+	if claims.ExpiresAt == 0 {
+		return ErrMissingExpiration
+	}
+
+	if now.Unix() > claims.ExpiresAt+leeway {
+		return ErrTokenExpired
+	}
+
+	if claims.NotBefore != 0 && now.Unix()+leeway < claims.NotBefore {
+		return ErrTokenNotValidYet
+	}
+
+	if v.config.Audience != "" && !claims.Audience.Contains(v.config.Audience) {
+		return ErrInvalidAudience
+	}
+
+	if v.config.Issuer != "" && claims.Issuer != v.config.Issuer {
+		return ErrInvalidIssuer
+	}
+
+	return nil
+}
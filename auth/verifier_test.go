@@ -0,0 +1,291 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func encodeBigInt(value *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(value.Bytes())
+}
+
+func writeJWKS(t *testing.T, path string, keys ...jsonWebKey) {
+	t.Helper()
+
+	data, err := json.Marshal(map[string][]jsonWebKey{"keys": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func rsaJWK(kid string, key *rsa.PrivateKey) jsonWebKey {
+	return jsonWebKey{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		Alg: "RS256",
+		N:   encodeBigInt(key.N),
+		E:   encodeBigInt(big.NewInt(int64(key.E))),
+	}
+}
+
+func ecJWK(kid string, key *ecdsa.PrivateKey) jsonWebKey {
+	return jsonWebKey{
+		Kty: "EC",
+		Kid: kid,
+		Use: "sig",
+		Alg: "ES256",
+		Crv: "P-256",
+		X:   encodeBigInt(key.X),
+		Y:   encodeBigInt(key.Y),
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims Claims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, &claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+func validClaims() Claims {
+	return Claims{
+		Subject:   "42",
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestVerifyHMAC(t *testing.T) {
+	verifier, err := NewVerifier(Config{Algorithms: []string{"HS256"}, Secret: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tokens issued by pheme-auth store the user ID in iss.
+	claims := Claims{Issuer: "7", ExpiresAt: time.Now().Add(time.Hour).Unix()}
+	verified, err := verifier.Verify(sign(t, jwt.SigningMethodHS256, "", []byte("secret"), claims))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if userID, err := verified.UserID(); err != nil || userID != 7 {
+		t.Fatalf("got user %d, %v; want 7", userID, err)
+	}
+
+	if _, err := verifier.Verify(sign(t, jwt.SigningMethodHS256, "", []byte("wrong"), claims)); err == nil {
+		t.Fatal("token signed with a wrong secret was accepted")
+	}
+}
+
+func TestVerifyJWKSFile(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, rsaJWK("rsa", rsaKey), ecJWK("ec", ecKey))
+
+	verifier, err := NewVerifier(Config{
+		Algorithms:   []string{"RS256", "ES256"},
+		JWKSFile:     path,
+		JWKSCacheTTL: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := verifier.Verify(sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, validClaims())); err != nil {
+		t.Fatalf("RS256: %v", err)
+	}
+
+	if _, err := verifier.Verify(sign(t, jwt.SigningMethodES256, "ec", ecKey, validClaims())); err != nil {
+		t.Fatalf("ES256: %v", err)
+	}
+
+	if _, err := verifier.Verify(sign(t, jwt.SigningMethodHS256, "", []byte("secret"), validClaims())); err == nil {
+		t.Fatal("HS256 token was accepted without being configured")
+	}
+}
+
+func TestVerifyKeyRotation(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, rsaJWK("old", oldKey))
+
+	verifier, err := NewVerifier(Config{
+		Algorithms:   []string{"RS256"},
+		JWKSFile:     path,
+		JWKSCacheTTL: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := verifier.Verify(sign(t, jwt.SigningMethodRS256, "new", newKey, validClaims())); err == nil {
+		t.Fatal("token with an unknown kid was accepted")
+	}
+
+	writeJWKS(t, path, rsaJWK("old", oldKey), rsaJWK("new", newKey))
+
+	if _, err := verifier.Verify(sign(t, jwt.SigningMethodRS256, "new", newKey, validClaims())); err != nil {
+		t.Fatalf("rotated key: %v", err)
+	}
+
+	if _, err := verifier.Verify(sign(t, jwt.SigningMethodRS256, "new", oldKey, validClaims())); err == nil {
+		t.Fatal("token signed with the wrong key for its kid was accepted")
+	}
+}
+
+func TestVerifyClaims(t *testing.T) {
+	verifier, err := NewVerifier(Config{
+		Algorithms: []string{"HS256"},
+		Secret:     "secret",
+		Audience:   "pheme-user",
+		Issuer:     "pheme-auth",
+		Leeway:     time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	base := Claims{
+		Subject:   "42",
+		Audience:  Audience{"pheme-user", "pheme-manager"},
+		Issuer:    "pheme-auth",
+		ExpiresAt: now.Add(time.Hour).Unix(),
+	}
+
+	tests := []struct {
+		name   string
+		modify func(claims *Claims)
+		err    error
+	}{
+		{"valid", func(claims *Claims) {}, nil},
+		{"expired within leeway", func(claims *Claims) { claims.ExpiresAt = now.Add(-30 * time.Second).Unix() }, nil},
+		{"expired", func(claims *Claims) { claims.ExpiresAt = now.Add(-time.Hour).Unix() }, ErrTokenExpired},
+		{"missing expiration", func(claims *Claims) { claims.ExpiresAt = 0 }, ErrMissingExpiration},
+		{"not valid yet", func(claims *Claims) { claims.NotBefore = now.Add(time.Hour).Unix() }, ErrTokenNotValidYet},
+		{"wrong audience", func(claims *Claims) { claims.Audience = Audience{"other"} }, ErrInvalidAudience},
+		{"wrong issuer", func(claims *Claims) { claims.Issuer = "other" }, ErrInvalidIssuer},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := base
+			test.modify(&claims)
+
+			_, err := verifier.Verify(sign(t, jwt.SigningMethodHS256, "", []byte("secret"), claims))
+			if err != test.err {
+				t.Fatalf("got %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestNewVerifierConfig(t *testing.T) {
+	if _, err := NewVerifier(Config{Algorithms: []string{"HS256"}}); err == nil {
+		t.Fatal("HS256 without a secret was accepted")
+	}
+
+	if _, err := NewVerifier(Config{Algorithms: []string{"RS256"}}); err == nil {
+		t.Fatal("RS256 without keys was accepted")
+	}
+
+	if _, err := NewVerifier(Config{Algorithms: []string{"none"}}); err == nil {
+		t.Fatal("unsupported algorithm was accepted")
+	}
+}
+
+func TestKeySetBackoff(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks, err := json.Marshal(map[string][]jsonWebKey{"keys": {rsaJWK("key", key)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loads := 0
+	down := true
+	set := &keySet{
+		keys: map[string]crypto.PublicKey{},
+		load: func() ([]byte, error) {
+			loads++
+			if down {
+				return nil, errors.New("JWKS URL is down")
+			}
+			return jwks, nil
+		},
+		ttl:        time.Hour,
+		minRefresh: time.Minute,
+	}
+
+	// The outage is only hit once per backoff.
+	for i := 0; i < 5; i++ {
+		if _, err := set.key("key"); err == nil {
+			t.Fatal("got a key while the JWKS URL is down")
+		}
+	}
+	if loads != 1 {
+		t.Errorf("loaded the key set %d times, want once", loads)
+	}
+
+	for failures, want := range map[int]time.Duration{1: time.Minute, 2: 2 * time.Minute, 3: 4 * time.Minute, 10: time.Hour} {
+		set.failures = failures
+		if got := set.backoff(); got != want {
+			t.Errorf("got a backoff of %s after %d failures, want %s", got, failures, want)
+		}
+	}
+
+	// The key set is loaded again once the backoff is over.
+	down = false
+	set.failures = 1
+	set.failed = time.Now().Add(-time.Minute)
+	if _, err := set.key("key"); err != nil || loads != 2 {
+		t.Errorf("got %v after %d loads, want the key once the JWKS URL is back", err, loads)
+	}
+}
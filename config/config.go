@@ -0,0 +1,381 @@
+// Package config configuration of the service
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/feserr/pheme-user/auth"
+	"github.com/feserr/pheme-user/database"
+	"github.com/feserr/pheme-user/logging"
+	"github.com/feserr/pheme-user/ratelimit"
+	"github.com/feserr/pheme-user/tracing"
+)
+
+// Config of the service. Every value can be set in the config file, with an
+// environment variable or with a flag, see Load.
+type Config struct {
+	Server    Server    `yaml:"server" toml:"server"`
+	Database  Database  `yaml:"database" toml:"database"`
+	CORS      CORS      `yaml:"cors" toml:"cors"`
+	JWT       JWT       `yaml:"jwt" toml:"jwt"`
+	Admin     Admin     `yaml:"admin" toml:"admin"`
+	Limits    Limits    `yaml:"limits" toml:"limits"`
+	RateLimit RateLimit `yaml:"rate_limit" toml:"rate_limit"`
+	Stream    Stream    `yaml:"stream" toml:"stream"`
+	Features  Features  `yaml:"features" toml:"features"`
+	Log       Log       `yaml:"log" toml:"log"`
+	Tracing   Tracing   `yaml:"tracing" toml:"tracing"`
+}
+
+// Server is the HTTP server config.
+type Server struct {
+	Host            string        `yaml:"host" toml:"host" env:"SERVER_HOST,PHEME_HOST" usage:"address the server listens on"`
+	Port            int           `yaml:"port" toml:"port" env:"SERVER_PORT,PHEME_USER_PORT" usage:"port the server listens on"`
+	ReadTimeout     time.Duration `yaml:"read_timeout" toml:"read_timeout" env:"SERVER_READ_TIMEOUT" usage:"maximum time to read a request"`
+	WriteTimeout    time.Duration `yaml:"write_timeout" toml:"write_timeout" env:"SERVER_WRITE_TIMEOUT" usage:"maximum time to write a response"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT" usage:"maximum time to drain the requests and jobs on shutdown"`
+	ProxyHeader     string        `yaml:"proxy_header" toml:"proxy_header" env:"SERVER_PROXY_HEADER" usage:"header with the client IP set by the trusted proxies, e.g. X-Forwarded-For"`
+	TrustedProxies  []string      `yaml:"trusted_proxies" toml:"trusted_proxies" env:"SERVER_TRUSTED_PROXIES" usage:"comma separated IPs or CIDR ranges of the proxies whose header is trusted"`
+}
+
+// Database is the database connection config.
+type Database struct {
+	Driver          string        `yaml:"driver" toml:"driver" env:"DATABASE_DRIVER" usage:"postgres or sqlite, detected from the DSN when empty"`
+	DSN             string        `yaml:"dsn" toml:"dsn" env:"DATABASE_DSN" secret:"dsn" usage:"database DSN, built from the host, port, user, password and name when empty"`
+	Host            string        `yaml:"host" toml:"host" env:"DATABASE_HOST" usage:"Postgres host"`
+	Port            int           `yaml:"port" toml:"port" env:"DATABASE_PORT" usage:"Postgres port"`
+	User            string        `yaml:"user" toml:"user" env:"POSTGRES_USER" usage:"Postgres user"`
+	Password        string        `yaml:"password" toml:"password" env:"POSTGRES_PASSWORD" secret:"true" usage:"Postgres password"`
+	Name            string        `yaml:"name" toml:"name" env:"POSTGRES_DB" usage:"Postgres database name"`
+	MaxOpenConns    int           `yaml:"max_open_conns" toml:"max_open_conns" env:"DATABASE_MAX_OPEN_CONNS" usage:"maximum open connections, 0 is unlimited"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" toml:"max_idle_conns" env:"DATABASE_MAX_IDLE_CONNS" usage:"maximum idle connections"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime" env:"DATABASE_CONN_MAX_LIFETIME" usage:"maximum time a connection is reused, 0 is forever"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" toml:"conn_max_idle_time" env:"DATABASE_CONN_MAX_IDLE_TIME" usage:"maximum time a connection is idle, 0 is forever"`
+}
+
+// CORS is the cross-origin resource sharing config.
+type CORS struct {
+	AllowOrigins     []string `yaml:"allow_origins" toml:"allow_origins" env:"CORS_ALLOW_ORIGINS" usage:"comma separated origins allowed to call the API"`
+	AllowCredentials bool     `yaml:"allow_credentials" toml:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS" usage:"allow the cookies in cross-origin requests"`
+}
+
+// JWT is the config of the verification of the JWT, see auth.Config.
+type JWT struct {
+	Algorithms     []string      `yaml:"algorithms" toml:"algorithms" env:"JWT_ALGORITHMS" usage:"comma separated algorithms accepted, e.g. HS256, RS256 or ES256"`
+	Secret         string        `yaml:"secret" toml:"secret" env:"JWT_SECRET" secret:"true" usage:"secret of the HMAC signed tokens"`
+	PublicKeyFile  string        `yaml:"public_key_file" toml:"public_key_file" env:"JWT_PUBLIC_KEY_FILE" usage:"PEM file with the RSA or ECDSA public key"`
+	JWKSFile       string        `yaml:"jwks_file" toml:"jwks_file" env:"JWT_JWKS_FILE" usage:"local JSON Web Key Set file"`
+	JWKSURL        string        `yaml:"jwks_url" toml:"jwks_url" env:"JWT_JWKS_URL" usage:"remote JSON Web Key Set endpoint"`
+	JWKSCacheTTL   time.Duration `yaml:"jwks_cache_ttl" toml:"jwks_cache_ttl" env:"JWT_JWKS_CACHE_TTL" usage:"time after which the key set is loaded again"`
+	JWKSMinRefresh time.Duration `yaml:"jwks_min_refresh" toml:"jwks_min_refresh" env:"JWT_JWKS_MIN_REFRESH" usage:"minimum time between two loads of the key set"`
+	Audience       string        `yaml:"audience" toml:"audience" env:"JWT_AUDIENCE" usage:"required aud claim"`
+	Issuer         string        `yaml:"issuer" toml:"issuer" env:"JWT_ISSUER" usage:"required iss claim"`
+	Leeway         time.Duration `yaml:"leeway" toml:"leeway" env:"JWT_LEEWAY" usage:"leeway of the exp and nbf claims"`
+}
+
+// Admin is the config of the administration.
+type Admin struct {
+	Emails []string `yaml:"emails" toml:"emails" env:"ADMIN_EMAILS" usage:"comma separated emails of the users that are always admins"`
+}
+
+// Limits are the limits of the requests and caches.
+type Limits struct {
+	BodyLimit       int           `yaml:"body_limit" toml:"body_limit" env:"LIMITS_BODY_LIMIT" usage:"maximum size of a request body in bytes"`
+	UserCacheTTL    time.Duration `yaml:"user_cache_ttl" toml:"user_cache_ttl" env:"LIMITS_USER_CACHE_TTL" usage:"time an authenticated user is cached"`
+	IdempotencyTTL  time.Duration `yaml:"idempotency_ttl" toml:"idempotency_ttl" env:"LIMITS_IDEMPOTENCY_TTL" usage:"time the response of a request with an Idempotency-Key is replayed"`
+	BatchSize       int           `yaml:"batch_size" toml:"batch_size" env:"LIMITS_BATCH_SIZE" usage:"maximum items of a batch request"`
+	TrashRetention  time.Duration `yaml:"trash_retention" toml:"trash_retention" env:"LIMITS_TRASH_RETENTION" usage:"time the deleted phemes are kept in the trash"`
+	DeletionGrace   time.Duration `yaml:"deletion_grace" toml:"deletion_grace" env:"LIMITS_DELETION_GRACE" usage:"time the deletion of an account can be canceled"`
+	ExportRetention time.Duration `yaml:"export_retention" toml:"export_retention" env:"LIMITS_EXPORT_RETENTION" usage:"time the exports of the user data can be downloaded"`
+}
+
+// RateLimit is the config of the rate limits of every client, identified by
+// its user or its IP, written as limit/period, e.g. 30/1m. An empty value
+// doesn't limit the requests.
+type RateLimit struct {
+	IP            string `yaml:"ip" toml:"ip" env:"RATE_LIMIT_IP" usage:"requests of an IP to the API, before they are authenticated"`
+	Default       string `yaml:"default" toml:"default" env:"RATE_LIMIT_DEFAULT" usage:"requests of a client to the API"`
+	Phemes        string `yaml:"phemes" toml:"phemes" env:"RATE_LIMIT_PHEMES" usage:"phemes posted by a client"`
+	Relationships string `yaml:"relationships" toml:"relationships" env:"RATE_LIMIT_RELATIONSHIPS" usage:"friends and followers added by a client"`
+}
+
+// Stream is the config of the live stream of the phemes and the notifications.
+type Stream struct {
+	Heartbeat time.Duration `yaml:"heartbeat" toml:"heartbeat" env:"STREAM_HEARTBEAT" usage:"time between the heartbeats of the idle streams and the pings of the notifications"`
+	Retention time.Duration `yaml:"retention" toml:"retention" env:"STREAM_RETENTION" usage:"time the events are kept to resume the streams"`
+	Buffer    int           `yaml:"buffer" toml:"buffer" env:"STREAM_BUFFER" usage:"events or notifications queued for a slow client before closing its connection"`
+}
+
+// Features are the optional features of the service.
+type Features struct {
+	Swagger         bool `yaml:"swagger" toml:"swagger" env:"FEATURES_SWAGGER" usage:"serve the swagger UI"`
+	Metrics         bool `yaml:"metrics" toml:"metrics" env:"FEATURES_METRICS" usage:"serve the Prometheus metrics on /metrics"`
+	UpgradeRewrite  bool `yaml:"upgrade_rewrite" toml:"upgrade_rewrite" env:"UPGRADE_REWRITE" usage:"store back the records upgraded on read"`
+	UpgradeBackfill bool `yaml:"upgrade_backfill" toml:"upgrade_backfill" env:"UPGRADE_BACKFILL" usage:"upgrade all the records in the background at start"`
+}
+
+// Log is the config of the logs.
+type Log struct {
+	Level     string        `yaml:"level" toml:"level" env:"LOG_LEVEL" usage:"minimum level of the logs: debug, info, warn or error"`
+	Format    string        `yaml:"format" toml:"format" env:"LOG_FORMAT" usage:"format of the logs: json or text"`
+	SlowQuery time.Duration `yaml:"slow_query" toml:"slow_query" env:"LOG_SLOW_QUERY" usage:"database queries slower than this are warnings, 0 never"`
+}
+
+// Tracing is the config of the traces, see tracing.Config.
+type Tracing struct {
+	Exporter    string `yaml:"exporter" toml:"exporter" env:"TRACING_EXPORTER" usage:"exporter of the spans: none, otlp or stdout"`
+	Endpoint    string `yaml:"endpoint" toml:"endpoint" env:"TRACING_ENDPOINT,OTEL_EXPORTER_OTLP_ENDPOINT" usage:"OTLP HTTP collector, e.g. http://localhost:4318"`
+	ServiceName string `yaml:"service_name" toml:"service_name" env:"TRACING_SERVICE_NAME,OTEL_SERVICE_NAME" usage:"service name of the spans"`
+}
+
+// Default returns the config used for the values that are not set.
+func Default() Config {
+	return Config{
+		Server: Server{
+			Port:            8001,
+			ReadTimeout:     10 * time.Second,
+			WriteTimeout:    10 * time.Second,
+			ShutdownTimeout: 15 * time.Second,
+		},
+		Database: Database{
+			Port:         5432,
+			MaxOpenConns: 25,
+			MaxIdleConns: 5,
+		},
+		CORS: CORS{
+			AllowOrigins: []string{"*"},
+		},
+		JWT: JWT{
+			Algorithms:     []string{"HS256"},
+			JWKSCacheTTL:   time.Hour,
+			JWKSMinRefresh: time.Minute,
+		},
+		Limits: Limits{
+			BodyLimit:       4 * 1024 * 1024,
+			UserCacheTTL:    30 * time.Second,
+			IdempotencyTTL:  24 * time.Hour,
+			BatchSize:       100,
+			TrashRetention:  30 * 24 * time.Hour,
+			DeletionGrace:   14 * 24 * time.Hour,
+			ExportRetention: 7 * 24 * time.Hour,
+		},
+		RateLimit: RateLimit{
+			IP:            "1200/1m",
+			Default:       "600/1m",
+			Phemes:        "60/1m",
+			Relationships: "120/1h",
+		},
+		Stream: Stream{
+			Heartbeat: 15 * time.Second,
+			Retention: 5 * time.Minute,
+			Buffer:    64,
+		},
+		Features: Features{
+			Swagger: true,
+			Metrics: true,
+		},
+		Log: Log{
+			Level:     "info",
+			Format:    logging.FormatJSON,
+			SlowQuery: 200 * time.Millisecond,
+		},
+		Tracing: Tracing{
+			Exporter:    tracing.ExporterNone,
+			ServiceName: "pheme-user",
+		},
+	}
+}
+
+// Address returns the address the server listens on.
+func (s Server) Address() string {
+	return fmt.Sprintf("%s:%d", s.Host, s.Port)
+}
+
+// Connection returns the config of the database connection.
+func (d Database) Connection() database.Config {
+	dsn := d.DSN
+	if dsn == "" {
+		dsn = fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s", d.Host, d.Port, d.User, d.Password, d.Name)
+	}
+
+	return database.Config{
+		Driver:          database.Driver(d.Driver),
+		DSN:             dsn,
+		MaxOpenConns:    d.MaxOpenConns,
+		MaxIdleConns:    d.MaxIdleConns,
+		ConnMaxLifetime: d.ConnMaxLifetime,
+		ConnMaxIdleTime: d.ConnMaxIdleTime,
+	}
+}
+
+// Verification returns the config of the JWT verification.
+func (j JWT) Verification() auth.Config {
+	return auth.Config{
+		Algorithms:     j.Algorithms,
+		Secret:         j.Secret,
+		PublicKeyFile:  j.PublicKeyFile,
+		JWKSFile:       j.JWKSFile,
+		JWKSURL:        j.JWKSURL,
+		JWKSCacheTTL:   j.JWKSCacheTTL,
+		JWKSMinRefresh: j.JWKSMinRefresh,
+		Audience:       j.Audience,
+		Issuer:         j.Issuer,
+		Leeway:         j.Leeway,
+	}
+}
+
+// Traces returns the config of the traces.
+func (t Tracing) Traces() tracing.Config {
+	return tracing.Config{
+		Exporter:    t.Exporter,
+		Endpoint:    t.Endpoint,
+		ServiceName: t.ServiceName,
+	}
+}
+
+// Policies returns the policies of the rate limits.
+func (r RateLimit) Policies() (ratelimit.Policies, error) {
+	var policies ratelimit.Policies
+	var err error
+	if policies.IP, err = ratelimit.ParsePolicy("ip", r.IP); err != nil {
+		return policies, err
+	}
+	if policies.Default, err = ratelimit.ParsePolicy("default", r.Default); err != nil {
+		return policies, err
+	}
+	if policies.Phemes, err = ratelimit.ParsePolicy("phemes", r.Phemes); err != nil {
+		return policies, err
+	}
+	if policies.Relationships, err = ratelimit.ParsePolicy("relationships", r.Relationships); err != nil {
+		return policies, err
+	}
+
+	return policies, nil
+}
+
+// ValidationError lists all the invalid values of a config.
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return "invalid config:\n  " + strings.Join(e, "\n  ")
+}
+
+// Validate returns a ValidationError with all the invalid values of the config.
+func (c Config) Validate() error {
+	var problems ValidationError
+	check := func(valid bool, format string, args ...interface{}) {
+		if !valid {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(c.Server.Port > 0 && c.Server.Port < 65536, "server.port must be between 1 and 65535, got %d", c.Server.Port)
+	check(c.Server.ReadTimeout >= 0, "server.read_timeout can't be negative")
+	check(c.Server.WriteTimeout >= 0, "server.write_timeout can't be negative")
+	check(c.Server.ShutdownTimeout >= 0, "server.shutdown_timeout can't be negative")
+
+	driver := database.Driver(c.Database.Driver)
+	check(driver == "" || driver == database.DriverPostgres || driver == database.DriverSQLite,
+		"database.driver must be postgres or sqlite, got %q", c.Database.Driver)
+	check(c.Database.DSN != "" || c.Database.Host != "", "database.dsn or database.host is required")
+	check(c.Database.MaxOpenConns >= 0, "database.max_open_conns can't be negative")
+	check(c.Database.MaxIdleConns >= 0, "database.max_idle_conns can't be negative")
+	check(c.Database.ConnMaxLifetime >= 0, "database.conn_max_lifetime can't be negative")
+	check(c.Database.ConnMaxIdleTime >= 0, "database.conn_max_idle_time can't be negative")
+
+	check(c.Server.ProxyHeader == "" || len(c.Server.TrustedProxies) > 0,
+		"server.trusted_proxies is required by server.proxy_header")
+	for _, proxy := range c.Server.TrustedProxies {
+		check(validProxy(proxy), "server.trusted_proxies has an invalid IP or CIDR range %q", proxy)
+	}
+
+	for _, origin := range c.CORS.AllowOrigins {
+		check(validOrigin(origin), "cors.allow_origins has an invalid origin %q", origin)
+	}
+	check(!c.CORS.AllowCredentials || !contains(c.CORS.AllowOrigins, "*"),
+		"cors.allow_credentials can't be used with the * origin")
+
+	check(len(c.JWT.Algorithms) > 0, "jwt.algorithms is required")
+	for _, algorithm := range c.JWT.Algorithms {
+		switch {
+		case strings.HasPrefix(algorithm, "HS"):
+			check(c.JWT.Secret != "", "jwt.secret is required by %s", algorithm)
+		case strings.HasPrefix(algorithm, "RS"), strings.HasPrefix(algorithm, "ES"):
+			check(c.JWT.PublicKeyFile != "" || c.JWT.JWKSFile != "" || c.JWT.JWKSURL != "",
+				"jwt.public_key_file, jwt.jwks_file or jwt.jwks_url is required by %s", algorithm)
+		default:
+			check(false, "jwt.algorithms has an unsupported algorithm %q", algorithm)
+		}
+	}
+	check(c.JWT.JWKSCacheTTL > 0, "jwt.jwks_cache_ttl must be positive")
+	check(c.JWT.Leeway >= 0, "jwt.leeway can't be negative")
+
+	check(c.Limits.BodyLimit > 0, "limits.body_limit must be positive")
+	check(c.Limits.UserCacheTTL >= 0, "limits.user_cache_ttl can't be negative")
+	check(c.Limits.IdempotencyTTL > 0, "limits.idempotency_ttl must be positive")
+	check(c.Limits.BatchSize > 0, "limits.batch_size must be positive")
+	check(c.Limits.TrashRetention > 0, "limits.trash_retention must be positive")
+	check(c.Limits.DeletionGrace >= 0, "limits.deletion_grace can't be negative")
+	check(c.Limits.ExportRetention > 0, "limits.export_retention must be positive")
+
+	for _, limit := range [][2]string{
+		{"ip", c.RateLimit.IP},
+		{"default", c.RateLimit.Default},
+		{"phemes", c.RateLimit.Phemes},
+		{"relationships", c.RateLimit.Relationships},
+	} {
+		_, err := ratelimit.ParsePolicy(limit[0], limit[1])
+		check(err == nil, "rate_limit.%s must be limit/period, e.g. 30/1m, got %q", limit[0], limit[1])
+	}
+
+	check(c.Stream.Heartbeat > 0, "stream.heartbeat must be positive")
+	check(c.Stream.Retention >= 0, "stream.retention can't be negative")
+	check(c.Stream.Buffer > 0, "stream.buffer must be positive")
+
+	_, err := logging.ParseLevel(c.Log.Level)
+	check(err == nil, "log.level must be debug, info, warn or error, got %q", c.Log.Level)
+	check(c.Log.Format == logging.FormatJSON || c.Log.Format == logging.FormatText,
+		"log.format must be json or text, got %q", c.Log.Format)
+	check(c.Log.SlowQuery >= 0, "log.slow_query can't be negative")
+
+	check(c.Tracing.Exporter == tracing.ExporterNone || c.Tracing.Exporter == tracing.ExporterOTLP || c.Tracing.Exporter == tracing.ExporterStdout,
+		"tracing.exporter must be none, otlp or stdout, got %q", c.Tracing.Exporter)
+	check(c.Tracing.ServiceName != "", "tracing.service_name is required")
+
+	if len(problems) > 0 {
+		return problems
+	}
+
+	return nil
+}
+
+func validOrigin(origin string) bool {
+	if origin == "*" {
+		return true
+	}
+
+	parsed, err := url.Parse(origin)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != "" && parsed.Path == ""
+}
+
+func validProxy(proxy string) bool {
+	if _, _, err := net.ParseCIDR(proxy); err == nil {
+		return true
+	}
+
+	return net.ParseIP(proxy) != nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,169 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv is the environment variable with the path of the config file.
+const FileEnv = "CONFIG_FILE"
+
+// field is a value of the config with its names in every source.
+type field struct {
+	// name of the field in the file and of the flag, e.g. server.port.
+	name   string
+	env    []string
+	secret string
+	usage  string
+	value  reflect.Value
+}
+
+// fields returns the values of the config, every section is a struct of values.
+func fields(config *Config) []field {
+	result := []field{}
+
+	sections := reflect.ValueOf(config).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		sectionName := sections.Type().Field(i).Tag.Get("yaml")
+		section := sections.Field(i)
+
+		for j := 0; j < section.NumField(); j++ {
+			tag := section.Type().Field(j).Tag
+			result = append(result, field{
+				name:   sectionName + "." + tag.Get("yaml"),
+				env:    strings.Split(tag.Get("env"), ","),
+				secret: tag.Get("secret"),
+				usage:  tag.Get("usage"),
+				value:  section.Field(j),
+			})
+		}
+	}
+
+	return result
+}
+
+// set parses the raw value into the field.
+func (f field) set(raw string) error {
+	switch f.value.Interface().(type) {
+	case string:
+		f.value.SetString(raw)
+	case int:
+		value, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("%s must be a number, got %q", f.name, raw)
+		}
+		f.value.SetInt(int64(value))
+	case bool:
+		value, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("%s must be true or false, got %q", f.name, raw)
+		}
+		f.value.SetBool(value)
+	case time.Duration:
+		value, err := time.ParseDuration(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("%s must be a duration like 30s, got %q", f.name, raw)
+		}
+		f.value.SetInt(int64(value))
+	case []string:
+		values := []string{}
+		for _, value := range strings.Split(raw, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+		f.value.Set(reflect.ValueOf(values))
+	default:
+		return fmt.Errorf("%s has an unsupported type %s", f.name, f.value.Type())
+	}
+
+	return nil
+}
+
+// Load returns the config of the service and the arguments left after the
+// flags. The values are taken, from lowest to highest precedence, from the
+// defaults, the YAML or TOML file of the -config flag or CONFIG_FILE, the
+// environment variables and the flags. The config is validated.
+func Load(args []string, output io.Writer) (Config, []string, error) {
+	config := Default()
+	all := fields(&config)
+
+	flags := flag.NewFlagSet("pheme-user", flag.ContinueOnError)
+	flags.SetOutput(output)
+	file := flags.String("config", os.Getenv(FileEnv), "YAML or TOML config file")
+	raw := map[string]*string{}
+	for _, f := range all {
+		usage := f.usage
+		if f.env[0] != "" {
+			usage += " (" + strings.Join(f.env, ", ") + ")"
+		}
+		raw[f.name] = flags.String(f.name, "", usage)
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return config, nil, err
+	}
+
+	if *file != "" {
+		if err := loadFile(*file, &config); err != nil {
+			return config, nil, err
+		}
+	}
+
+	for _, f := range all {
+		for _, env := range f.env {
+			if value, ok := os.LookupEnv(env); ok && env != "" {
+				if err := f.set(value); err != nil {
+					return config, nil, fmt.Errorf("%s: %w", env, err)
+				}
+				break
+			}
+		}
+	}
+
+	var err error
+	flags.Visit(func(visited *flag.Flag) {
+		for _, f := range all {
+			if f.name == visited.Name && err == nil {
+				err = f.set(*raw[f.name])
+			}
+		}
+	})
+	if err != nil {
+		return config, nil, err
+	}
+
+	return config, flags.Args(), config.Validate()
+}
+
+// loadFile decodes the config file, by its extension.
+func loadFile(path string, config *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, config)
+	case ".toml":
+		err = toml.Unmarshal(data, config)
+	default:
+		return fmt.Errorf("config file %s must be .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	return nil
+}
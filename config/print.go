@@ -0,0 +1,58 @@
+package config
+
+import (
+	"io"
+	"net/url"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces the secrets of the printed config.
+const redacted = "REDACTED"
+
+// dsnPassword matches the password of a key=value DSN.
+var dsnPassword = regexp.MustCompile(`(password=)(\S+)`)
+
+// Redacted returns a copy of the config without the secrets.
+func (c Config) Redacted() Config {
+	copied := c
+	for _, f := range fields(&copied) {
+		value := f.value.String()
+		if value == "" {
+			continue
+		}
+
+		switch f.secret {
+		case "true":
+			f.value.SetString(redacted)
+		case "dsn":
+			f.value.SetString(redactDSN(value))
+		}
+	}
+
+	return copied
+}
+
+// redactDSN removes the password of a URL or key=value DSN.
+func redactDSN(dsn string) string {
+	if parsed, err := url.Parse(dsn); err == nil && parsed.User != nil {
+		if _, ok := parsed.User.Password(); ok {
+			parsed.User = url.UserPassword(parsed.User.Username(), redacted)
+			return parsed.String()
+		}
+	}
+
+	return dsnPassword.ReplaceAllString(dsn, "${1}"+redacted)
+}
+
+// Print writes the config without the secrets as YAML.
+func (c Config) Print(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c.Redacted()); err != nil {
+		return err
+	}
+
+	return encoder.Close()
+}
@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/feserr/pheme-user/middleware"
+	"github.com/feserr/pheme-user/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// DeleteAccount godoc
+// @Summary      Delete the account of the user
+// @Description  schedule the deletion of the account with all its data after a grace period, the request can be canceled until then
+// @Tags         user
+// @Produce      json
+// @Success      202  {object}  models.AccountDeletion
+// @Failure      401  {object}  models.Problem
+// @Failure      403  {object}  models.Problem
+// @Router       /user [delete]
+func (s *Service) DeleteAccount(c *fiber.Ctx) error {
+	user, _ := middleware.CurrentUser(c)
+
+	now := time.Now()
+	deletion, err := s.Deletions.ScheduleAccountDeletion(c.UserContext(), models.AccountDeletion{
+		UserID:      user.ID,
+		RequestedAt: now,
+		ScheduledAt: now.Add(s.DeletionGrace),
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(deletion)
+}
+
+// GetAccountDeletion godoc
+// @Summary      Retrieve the deletion of the account
+// @Description  get the scheduled deletion of the account of the user
+// @Tags         user
+// @Produce      json
+// @Success      200  {object}  models.AccountDeletion
+// @Failure      401  {object}  models.Problem
+// @Failure      403  {object}  models.Problem
+// @Failure      404  {object}  models.Problem
+// @Router       /user/deletion [get]
+func (s *Service) GetAccountDeletion(c *fiber.Ctx) error {
+	user, _ := middleware.CurrentUser(c)
+
+	deletion, err := s.Deletions.FindAccountDeletion(c.UserContext(), user.ID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(deletion)
+}
+
+// CancelAccountDeletion godoc
+// @Summary      Cancel the deletion of the account
+// @Description  cancel the scheduled deletion of the account of the user
+// @Tags         user
+// @Produce      json
+// @Success      204
+// @Failure      401  {object}  models.Problem
+// @Failure      403  {object}  models.Problem
+// @Failure      404  {object}  models.Problem
+// @Router       /user/deletion [delete]
+func (s *Service) CancelAccountDeletion(c *fiber.Ctx) error {
+	user, _ := middleware.CurrentUser(c)
+
+	if err := s.Deletions.CancelAccountDeletion(c.UserContext(), user.ID); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
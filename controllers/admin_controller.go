@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"github.com/feserr/pheme-user/middleware"
+	"github.com/feserr/pheme-user/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	errUnknownRole  = models.Invalid("unknown_role", "Unknown role")
+	errOwnAdminRole = models.Invalid("own_admin_role", "Admins cannot revoke their own admin role")
+)
+
+// GetUserRoles godoc
+// @Summary      Retrieve the roles of a user
+// @Description  get the roles granted to a user
+// @Tags         admin
+// @Produce      json
+// @Param        id   path      int  true  "User ID"
+// @Success      200  {object}  []models.UserRole
+// @Failure      400  {object}  models.Problem
+// @Failure      401  {object}  models.Problem
+// @Failure      403  {object}  models.Problem
+// @Router       /admin/user/{id}/role [get]
+func (s *Service) GetUserRoles(c *fiber.Ctx) error {
+	var paramsID models.UserParamsID
+	if err := c.ParamsParser(&paramsID); err != nil {
+		return models.ErrInvalidParameters
+	}
+
+	roles, err := s.Users.GetRoles(c.UserContext(), paramsID.ID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(roles)
+}
+
+// GrantRole godoc
+// @Summary      Grant a role to a user
+// @Description  put a role to the user
+// @Tags         admin
+// @Produce      json
+// @Param        id   path      int     true  "User ID"
+// @Param        role path      string  true  "Role name"
+// @Success      200  {object}  models.Message
+// @Failure      400  {object}  models.Problem
+// @Failure      401  {object}  models.Problem
+// @Failure      403  {object}  models.Problem
+// @Failure      404  {object}  models.Problem
+// @Router       /admin/user/{id}/role/{role} [put]
+func (s *Service) GrantRole(c *fiber.Ctx) error {
+	user, _ := middleware.CurrentUser(c)
+
+	var paramsRole models.RoleParams
+	if err := c.ParamsParser(&paramsRole); err != nil {
+		return models.ErrInvalidParameters
+	}
+
+	role, err := models.ParseRole(paramsRole.Role)
+	if err != nil {
+		return errUnknownRole
+	}
+
+	if err := s.Users.GrantRole(c.UserContext(), paramsRole.ID, role, user.ID); err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Success",
+	})
+}
+
+// RevokeRole godoc
+// @Summary      Revoke a role from a user
+// @Description  delete a role of the user
+// @Tags         admin
+// @Produce      json
+// @Param        id   path      int     true  "User ID"
+// @Param        role path      string  true  "Role name"
+// @Success      200  {object}  models.Message
+// @Failure      400  {object}  models.Problem
+// @Failure      401  {object}  models.Problem
+// @Failure      403  {object}  models.Problem
+// @Failure      404  {object}  models.Problem
+// @Router       /admin/user/{id}/role/{role} [delete]
+func (s *Service) RevokeRole(c *fiber.Ctx) error {
+	user, _ := middleware.CurrentUser(c)
+
+	var paramsRole models.RoleParams
+	if err := c.ParamsParser(&paramsRole); err != nil {
+		return models.ErrInvalidParameters
+	}
+
+	role, err := models.ParseRole(paramsRole.Role)
+	if err != nil {
+		return errUnknownRole
+	}
+
+	if user.ID == paramsRole.ID && role == models.RoleAdmin {
+		return errOwnAdminRole
+	}
+
+	if err := s.Users.RevokeRole(c.UserContext(), paramsRole.ID, role); err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Success",
+	})
+}
@@ -0,0 +1,300 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/feserr/pheme-user/events"
+	"github.com/feserr/pheme-user/middleware"
+	"github.com/feserr/pheme-user/models"
+	"github.com/feserr/pheme-user/problem"
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetPhemeBatch godoc
+// @Summary      Retrieve many phemes
+// @Description  get the phemes of the IDs visible for the user
+// @Tags         phemes
+// @Produce      json
+// @Param        ids  query     string  true  "Comma separated pheme IDs"
+// @Success      200  {object}  models.PhemeBatch
+// @Failure      400  {object}  models.Problem
+// @Failure      401  {object}  models.Problem
+// @Router       /pheme/batch [get]
+func (s *Service) GetPhemeBatch(c *fiber.Ctx) error {
+	user, _ := middleware.CurrentUser(c)
+
+	var query models.PhemeBatchQuery
+	if err := c.QueryParser(&query); err != nil {
+		return models.ErrInvalidParameters
+	}
+
+	if err := validateBody(query); err != nil {
+		return err
+	}
+
+	ids := uniqueIDs(query.IDs)
+	if err := s.checkBatchSize(len(ids)); err != nil {
+		return err
+	}
+
+	phemes, err := s.Phemes.FetchPhemes(c.UserContext(), ids, user.ID)
+	if err != nil {
+		return err
+	}
+
+	found := map[uint]bool{}
+	for _, pheme := range phemes {
+		found[pheme.ID] = true
+	}
+
+	batch := models.PhemeBatch{Phemes: phemes, NotFound: []uint{}}
+	for _, id := range ids {
+		if !found[id] {
+			batch.NotFound = append(batch.NotFound, id)
+		}
+	}
+
+	return c.JSON(batch)
+}
+
+// PostPhemeBatch godoc
+// @Summary      Post many phemes
+// @Description  post the phemes of a batch, all or none when atomic
+// @Tags         phemes
+// @Accept       json
+// @Produce      json
+// @Param        Idempotency-Key  header  string  false  "Key replaying the response to the retries"
+// @Success      200  {object}  models.BatchResult
+// @Failure      400  {object}  models.Problem
+// @Failure      401  {object}  models.Problem
+// @Failure      403  {object}  models.Problem
+// @Failure      409  {object}  models.Problem
+// @Failure      422  {object}  models.Problem
+// @Failure      429  {object}  models.Problem
+// @Router       /pheme/batch [post]
+func (s *Service) PostPhemeBatch(c *fiber.Ctx) error {
+	user, _ := middleware.CurrentUser(c)
+
+	var body models.PhemeBatchPost
+	if err := c.BodyParser(&body); err != nil {
+		return models.ErrInvalidBody
+	}
+
+	if err := validateBody(body); err != nil {
+		return err
+	}
+
+	if err := s.checkBatchSize(len(body.Phemes)); err != nil {
+		return err
+	}
+
+	var created []models.Pheme
+	results, err := runBatch(c.UserContext(), s.Transactions, "phemes", body.Phemes, body.Atomic, func(ctx context.Context, post models.PhemeParamsPost) (uint, error) {
+		pheme, err := s.createPheme(ctx, user.ID, post)
+		if err == nil {
+			created = append(created, pheme)
+		}
+
+		return pheme.ID, err
+	})
+	// The phemes of the failed atomic batches were rolled back.
+	if err == nil || !body.Atomic {
+		for _, pheme := range created {
+			s.publish(events.PhemeCreated, pheme)
+			s.notifyPheme(pheme)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(results)
+}
+
+// PostRelationshipBatch godoc
+// @Summary      Add and remove many friends and followers
+// @Description  add and remove the friends and followers of the user, all or none when atomic
+// @Tags         user
+// @Accept       json
+// @Produce      json
+// @Param        Idempotency-Key  header  string  false  "Key replaying the response to the retries"
+// @Success      200  {object}  models.BatchResult
+// @Failure      400  {object}  models.Problem
+// @Failure      401  {object}  models.Problem
+// @Failure      404  {object}  models.Problem
+// @Failure      409  {object}  models.Problem
+// @Failure      422  {object}  models.Problem
+// @Failure      429  {object}  models.Problem
+// @Router       /user/relationships/batch [post]
+func (s *Service) PostRelationshipBatch(c *fiber.Ctx) error {
+	user, _ := middleware.CurrentUser(c)
+
+	var body models.RelationshipBatch
+	if err := c.BodyParser(&body); err != nil {
+		return models.ErrInvalidBody
+	}
+
+	if err := validateBody(body); err != nil {
+		return err
+	}
+
+	if err := s.checkBatchSize(len(body.Operations)); err != nil {
+		return err
+	}
+
+	var changed []models.RelationshipOperation
+	results, err := runBatch(c.UserContext(), s.Transactions, "operations", body.Operations, body.Atomic, func(ctx context.Context, operation models.RelationshipOperation) (uint, error) {
+		err := s.changeRelationship(ctx, user.ID, operation)
+		if err == nil {
+			changed = append(changed, operation)
+		}
+
+		return operation.UserID, err
+	})
+	// The operations of the failed atomic batches were rolled back.
+	if err == nil || !body.Atomic {
+		for _, operation := range changed {
+			s.notifyRelationship(c.UserContext(), user.ID, operation)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(results)
+}
+
+// runBatch validates the items of a batch and runs them. The atomic batches
+// run in a transaction, failing with the error of the first item that fails,
+// named after the field of the items. Otherwise every item has its own result
+// and only the unexpected errors fail the batch.
+func runBatch[T any](ctx context.Context, transactions models.Transactor, field string, items []T, atomic bool, run func(ctx context.Context, item T) (uint, error)) (models.BatchResult, error) {
+	results := models.BatchResult{Results: make([]models.BatchItem, len(items))}
+	invalid := make([]error, len(items))
+	var fields []models.FieldError
+	for i, item := range items {
+		results.Results[i].Index = i
+
+		err := validateBody(item)
+		switch {
+		case err == nil:
+		case failed(err):
+			invalid[i] = err
+			fields = append(fields, itemError(field, i, err).Fields...)
+		default:
+			return results, err
+		}
+	}
+
+	if atomic {
+		if len(fields) > 0 {
+			return results, models.Invalid("invalid_fields", "Wrong JSON params", fields...)
+		}
+
+		err := transactions.Transaction(ctx, func(ctx context.Context) error {
+			for i, item := range items {
+				id, err := run(ctx, item)
+				if err != nil && failed(err) {
+					return itemError(field, i, err)
+				} else if err != nil {
+					return err
+				}
+
+				results.Results[i].Status = fiber.StatusOK
+				results.Results[i].ID = id
+			}
+
+			return nil
+		})
+
+		return results, err
+	}
+
+	for i, item := range items {
+		err := invalid[i]
+		if err == nil {
+			var id uint
+			id, err = run(ctx, item)
+			results.Results[i].ID = id
+		}
+
+		switch {
+		case err == nil:
+			results.Results[i].Status = fiber.StatusOK
+		case failed(err):
+			itemProblem := problem.Of(err)
+			results.Results[i].Status = itemProblem.Status
+			results.Results[i].ID = 0
+			results.Results[i].Error = &itemProblem
+		default:
+			return results, err
+		}
+	}
+
+	return results, nil
+}
+
+// checkBatchSize fails when the batch has more items than the limit.
+func (s *Service) checkBatchSize(size int) error {
+	if size > s.BatchSize {
+		return models.Invalid("batch_too_large", fmt.Sprintf("The batch can have at most %d items", s.BatchSize))
+	}
+
+	return nil
+}
+
+// changeRelationship runs the relationship operation of the user, the
+// operation must be validated.
+func (s *Service) changeRelationship(ctx context.Context, userID uint, operation models.RelationshipOperation) error {
+	if userID == operation.UserID {
+		return errSameUser
+	}
+
+	add := operation.Action == models.ActionAdd
+	switch {
+	case operation.Relation == models.RelationFriend && add:
+		return s.Users.AddFriend(ctx, userID, operation.UserID)
+	case operation.Relation == models.RelationFriend:
+		return s.Users.RemoveFriend(ctx, userID, operation.UserID)
+	case add:
+		return s.Users.AddFollower(ctx, userID, operation.UserID)
+	default:
+		return s.Users.RemoveFollower(ctx, userID, operation.UserID)
+	}
+}
+
+// failed returns if the item of a batch failed with a client error, the rest
+// of the errors fail the batch.
+func failed(err error) bool {
+	return problem.Status(err) < fiber.StatusInternalServerError
+}
+
+// itemError returns the error of the item of a batch with its message and
+// fields named after the item, e.g. phemes[2].text.
+func itemError(field string, index int, err error) *models.Error {
+	item := fmt.Sprintf("%s[%d]", field, index)
+	itemProblem := problem.Of(err)
+
+	named := &models.Error{Kind: err, Code: itemProblem.Code, Message: item + ": " + itemProblem.Detail}
+	for _, fieldErr := range itemProblem.Errors {
+		fieldErr.Field = item + "." + fieldErr.Field
+		named.Fields = append(named.Fields, fieldErr)
+	}
+
+	return named
+}
+
+// uniqueIDs returns the IDs without the repeated ones, in their order.
+func uniqueIDs(ids []uint) []uint {
+	seen := map[uint]bool{}
+	unique := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	return unique
+}
@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/feserr/pheme-user/middleware"
+	"github.com/feserr/pheme-user/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// exportRetryAfter is the time suggested to the clients between two polls of a pending export.
+const exportRetryAfter = 10 * time.Second
+
+// PostExport godoc
+// @Summary      Export the data of the user
+// @Description  start building a ZIP archive with the profile, phemes, relationships and tokens of the user, or return the pending or running one
+// @Tags         user
+// @Produce      json
+// @Success      202  {object}  models.Export
+// @Failure      401  {object}  models.Problem
+// @Failure      403  {object}  models.Problem
+// @Router       /user/export [post]
+func (s *Service) PostExport(c *fiber.Ctx) error {
+	user, _ := middleware.CurrentUser(c)
+
+	export, err := s.Exports.CreateExport(c.UserContext(), models.Export{
+		UserID:    user.ID,
+		Status:    models.ExportPending,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	c.Location(fmt.Sprintf("/api/v1/user/export/%d", export.ID))
+	return c.Status(fiber.StatusAccepted).JSON(export)
+}
+
+// GetExport godoc
+// @Summary      Retrieve an export of the user
+// @Description  get the status of the export while it is pending, running or failed, and its ZIP archive once it is ready
+// @Tags         user
+// @Produce      json,application/zip
+// @Param        id   path      int  true  "Export ID"
+// @Success      200  {file}    file
+// @Success      202  {object}  models.Export
+// @Failure      400  {object}  models.Problem
+// @Failure      401  {object}  models.Problem
+// @Failure      403  {object}  models.Problem
+// @Failure      404  {object}  models.Problem
+// @Router       /user/export/{id} [get]
+func (s *Service) GetExport(c *fiber.Ctx) error {
+	user, _ := middleware.CurrentUser(c)
+
+	var paramsID models.ExportParamsID
+	if err := c.ParamsParser(&paramsID); err != nil {
+		return models.ErrInvalidParameters
+	}
+
+	export, err := s.Exports.FindExport(c.UserContext(), paramsID.ID, user.ID)
+	if err != nil {
+		return err
+	}
+
+	switch export.Status {
+	case models.ExportPending, models.ExportRunning:
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(exportRetryAfter.Seconds())))
+		return c.Status(fiber.StatusAccepted).JSON(export)
+	case models.ExportFailed:
+		return c.JSON(export)
+	}
+
+	archive, err := s.Exports.FetchExportArchive(c.UserContext(), export.ID, user.ID)
+	if err != nil {
+		return err
+	}
+
+	c.Attachment(fmt.Sprintf("pheme-export-%d.zip", export.ID))
+	c.Set(fiber.HeaderContentType, "application/zip")
+	return c.Send(archive)
+}
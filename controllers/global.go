@@ -1,9 +1,60 @@
 package controllers
 
-import "github.com/go-playground/validator"
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/feserr/pheme-user/models"
+	"github.com/go-playground/validator"
+)
 
 var validate *validator.Validate
 
 func init() {
 	validate = validator.New()
+	// The fields are reported with the names of the JSON body.
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+
+		return name
+	})
+}
+
+// validateBody validates the JSON body, returning the fields that failed as a
+// validation error.
+func validateBody(body interface{}) error {
+	err := validate.Struct(body)
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return err
+	}
+
+	fields := make([]models.FieldError, 0, len(validationErrs))
+	for _, fieldErr := range validationErrs {
+		fields = append(fields, models.FieldError{
+			Field:   fieldErr.Field(),
+			Code:    fieldErr.Tag(),
+			Message: fieldMessage(fieldErr),
+		})
+	}
+
+	return models.Invalid("invalid_fields", "Wrong JSON params", fields...)
+}
+
+func fieldMessage(fieldErr validator.FieldError) string {
+	switch fieldErr.Tag() {
+	case "required":
+		return "The field is required"
+	case "min":
+		return fmt.Sprintf("The field must be at least %s", fieldErr.Param())
+	case "max":
+		return fmt.Sprintf("The field must be at most %s", fieldErr.Param())
+	}
+
+	return fmt.Sprintf("The field failed the %s validation", fieldErr.Tag())
 }
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// readinessTimeout is the maximum time of the readiness checks.
+const readinessTimeout = 2 * time.Second
+
+// ReadinessCheck returns an error when a dependency of the service is not ready.
+type ReadinessCheck func(ctx context.Context) error
+
+// Health answers the liveness and readiness probes.
+type Health struct {
+	// Checks are the readiness checks by name.
+	Checks map[string]ReadinessCheck
+
+	draining atomic.Bool
+}
+
+// Drain makes the service not ready, so it stops receiving traffic while it
+// shuts down.
+func (h *Health) Drain() {
+	h.draining.Store(true)
+}
+
+// Live godoc
+// @Summary      Liveness probe
+// @Description  get if the service is running
+// @Tags         health
+// @Produce      json
+// @Success      200  {object}  models.Message
+// @Router       /healthz [get]
+func (h *Health) Live(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"message": "ok",
+	})
+}
+
+// Ready godoc
+// @Summary      Readiness probe
+// @Description  get if the service can handle requests, with the failed checks
+// @Tags         health
+// @Produce      json
+// @Success      200  {object}  models.Message
+// @Failure      503  {object}  models.Problem
+// @Router       /readyz [get]
+func (h *Health) Ready(c *fiber.Ctx) error {
+	if h.draining.Load() {
+		c.Status(fiber.StatusServiceUnavailable)
+		return c.JSON(fiber.Map{
+			"message": "Shutting down",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), readinessTimeout)
+	defer cancel()
+
+	names := make([]string, 0, len(h.Checks))
+	for name := range h.Checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	failed := fiber.Map{}
+	for _, name := range names {
+		if err := h.Checks[name](ctx); err != nil {
+			failed[name] = err.Error()
+		}
+	}
+
+	if len(failed) > 0 {
+		c.Status(fiber.StatusServiceUnavailable)
+		return c.JSON(fiber.Map{
+			"message": "Not ready",
+			"checks":  failed,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "ok",
+	})
+}
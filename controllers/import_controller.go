@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"bytes"
+
+	"github.com/feserr/pheme-user/importer"
+	"github.com/feserr/pheme-user/middleware"
+	"github.com/feserr/pheme-user/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// PostImport godoc
+// @Summary      Import phemes
+// @Description  import the phemes of a JSON Lines or Twitter archive with their original dates, skipping the ones imported before
+// @Tags         phemes
+// @Accept       plain
+// @Produce      json
+// @Param        format      query     string  true   "Format of the archive, jsonl or twitter"
+// @Param        category    query     string  false  "Category of the phemes without one, imported by default"
+// @Param        categories  query     string  false  "Renamed categories, e.g. news=News,dev=Development"
+// @Param        visibility  query     string  false  "Visibility of the phemes without one, public by default"
+// @Param        archive     body      string  true   "Archive"
+// @Success      200  {object}  models.ImportReport
+// @Failure      400  {object}  models.Problem
+// @Failure      401  {object}  models.Problem
+// @Failure      403  {object}  models.Problem
+// @Failure      429  {object}  models.Problem
+// @Router       /pheme/import [post]
+func (s *Service) PostImport(c *fiber.Ctx) error {
+	user, _ := middleware.CurrentUser(c)
+
+	var query models.ImportQuery
+	if err := c.QueryParser(&query); err != nil {
+		return models.ErrInvalidParameters
+	}
+
+	options, err := importer.NewOptions(query)
+	if err != nil {
+		return err
+	}
+
+	report, err := importer.Import(c.UserContext(), s.Phemes, user.ID, bytes.NewReader(c.Body()), options)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(report)
+}
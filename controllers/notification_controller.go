@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/feserr/pheme-user/middleware"
+	"github.com/feserr/pheme-user/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+)
+
+// maxMentions is the maximum users notified by a pheme.
+const maxMentions = 10
+
+// mentionPattern matches the names mentioned in the phemes, e.g. @alice.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([\w.-]+)`)
+
+var errOriginNotAllowed = models.Forbidden("origin_not_allowed", "The origin can't open the notifications with the cookies")
+
+// GetNotifications godoc
+// @Summary      Receive the notifications
+// @Description  upgrade to a WebSocket pushing the notifications of the user, on any number of connections. The client sends {"action": "subscribe", "types": ["friend", "follow", "mention", "reply", "reaction"]}, or "unsubscribe", answered with the subscribed types, then receives {"type": "notification", "notification": {...}}. The connections authenticated with the cookies must come from the service or an origin allowed with credentials.
+// @Tags         user
+// @Success      101  {object}  models.NotificationMessage
+// @Failure      401  {object}  models.Problem
+// @Failure      403  {object}  models.Problem
+// @Failure      426  {object}  models.Problem
+// @Router       /user/notifications [get]
+func (s *Service) GetNotifications(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return fiber.ErrUpgradeRequired
+	}
+
+	// The browsers send the cookies in the handshakes of any site.
+	if middleware.CurrentAuthSource(c) == middleware.AuthSourceCookie && !s.notificationOrigin(c.Get(fiber.HeaderOrigin), c.BaseURL()) {
+		return errOriginNotAllowed
+	}
+
+	user, _ := middleware.CurrentUser(c)
+
+	return websocket.New(func(conn *websocket.Conn) {
+		s.Notifications.Serve(conn.Conn, user.ID)
+	})(c)
+}
+
+// notificationOrigin returns if the origin can open the notifications with
+// the cookies.
+func (s *Service) notificationOrigin(origin string, service string) bool {
+	if origin == "" || origin == service {
+		return true
+	}
+
+	for _, allowed := range s.NotificationOrigins {
+		if allowed == origin {
+			return true
+		}
+	}
+
+	return false
+}
+
+// notify sends the notification, if they are served. The failures are only
+// logged, the change notified is already done.
+func (s *Service) notify(ctx context.Context, notification models.Notification) {
+	if s.Notifications == nil {
+		return
+	}
+
+	notification.CreatedAt = time.Now()
+	if err := s.Notifications.Notify(ctx, notification); err != nil {
+		s.Logger.Error("failed to notify", "type", notification.Type, "user", notification.UserID, "error", err)
+	}
+}
+
+// notifyRelationship notifies the user added as a friend or follower.
+func (s *Service) notifyRelationship(ctx context.Context, userID uint, operation models.RelationshipOperation) {
+	if operation.Action != models.ActionAdd {
+		return
+	}
+
+	notificationType := models.NotificationFollow
+	if operation.Relation == models.RelationFriend {
+		notificationType = models.NotificationFriend
+	}
+
+	s.notify(ctx, models.Notification{Type: notificationType, UserID: operation.UserID, ActorID: userID})
+}
+
+// notifyPheme queues the notifications of the author of the pheme replied to
+// and the users mentioned by the pheme, found in the background so the request
+// doesn't wait for them. They are dropped when the queue of the hub is full.
+func (s *Service) notifyPheme(pheme models.Pheme) {
+	if s.Notifications == nil || (pheme.ReplyTo == nil && len(mentions(pheme.Text)) == 0) {
+		return
+	}
+
+	queued := s.Notifications.Queue(func(ctx context.Context) {
+		if pheme.ReplyTo != nil {
+			s.sendReply(ctx, pheme)
+		}
+		s.sendMentions(ctx, pheme)
+	})
+	if !queued {
+		s.Logger.Warn("too many queued notifications, the ones of the pheme dropped", "pheme", pheme.ID)
+	}
+}
+
+// sendReply notifies the author of the pheme replied to, if they can see the
+// reply.
+func (s *Service) sendReply(ctx context.Context, pheme models.Pheme) {
+	replied, err := s.Phemes.FindPheme(ctx, *pheme.ReplyTo)
+	if err != nil {
+		s.Logger.Error("failed to find the pheme replied to", "pheme", *pheme.ReplyTo, "error", err)
+		return
+	}
+
+	if replied.CreatedBy == pheme.CreatedBy {
+		return
+	}
+
+	audience, err := loadAudience(ctx, s.Users, replied.CreatedBy)
+	if err != nil {
+		s.Logger.Error("failed to load the relationships of the replied user", "user", replied.CreatedBy, "error", err)
+		return
+	}
+
+	if audience.visible(pheme) {
+		reply := pheme
+		s.notify(ctx, models.Notification{Type: models.NotificationReply, UserID: replied.CreatedBy, ActorID: pheme.CreatedBy, Pheme: &reply})
+	}
+}
+
+// notifyReaction notifies the author of the pheme the user reacted to.
+func (s *Service) notifyReaction(ctx context.Context, pheme models.Pheme, reaction models.Reaction) {
+	if pheme.CreatedBy == reaction.UserID {
+		return
+	}
+
+	s.notify(ctx, models.Notification{Type: models.NotificationReaction, UserID: pheme.CreatedBy, ActorID: reaction.UserID, Pheme: &pheme, Reaction: reaction.Emoji})
+}
+
+// sendMentions notifies the users mentioned by the pheme that can see it.
+func (s *Service) sendMentions(ctx context.Context, pheme models.Pheme) {
+	for _, name := range mentions(pheme.Text) {
+		users, err := s.Users.FindByName(ctx, name)
+		if err != nil {
+			s.Logger.Error("failed to find the mentioned user", "name", name, "error", err)
+			continue
+		}
+
+		for _, user := range users {
+			if user.Name != name || user.ID == pheme.CreatedBy {
+				continue
+			}
+
+			audience, err := loadAudience(ctx, s.Users, user.ID)
+			if err != nil {
+				s.Logger.Error("failed to load the relationships of the mentioned user", "user", user.ID, "error", err)
+				continue
+			}
+
+			if audience.visible(pheme) {
+				mentioned := pheme
+				s.notify(ctx, models.Notification{Type: models.NotificationMention, UserID: user.ID, ActorID: pheme.CreatedBy, Pheme: &mentioned})
+			}
+		}
+	}
+}
+
+// mentions returns the names mentioned in the text, without repeating them.
+func mentions(text string) []string {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		name := strings.TrimRight(match[1], ".-")
+		if name == "" || seen[name] {
+			continue
+		}
+
+		seen[name] = true
+		names = append(names, name)
+		if len(names) == maxMentions {
+			break
+		}
+	}
+
+	return names
+}
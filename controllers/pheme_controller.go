@@ -1,38 +1,30 @@
 package controllers
 
 import (
+	"context"
+	"errors"
 	"time"
 
+	"github.com/feserr/pheme-user/events"
+	"github.com/feserr/pheme-user/middleware"
 	"github.com/feserr/pheme-user/models"
 	"github.com/gofiber/fiber/v2"
 )
 
-// SecretKey the secret key.
-const SecretKey = "secret"
-
 // GetAllPhemes godoc
 // @Summary      Retrieve all phemes
 // @Description  get all phemes
 // @Tags         phemes
 // @Produce      json
 // @Success      200  {object}  []models.Pheme
-// @Failure      401  {object}  models.Message
+// @Failure      401  {object}  models.Problem
 // @Router       /pheme [get]
-func GetAllPhemes(c *fiber.Ctx) error {
-	user, err := models.GetUser(c, SecretKey)
-	if err != nil {
-		c.Status(fiber.StatusUnauthorized)
-		return c.JSON(fiber.Map{
-			"message": "Unauthenticated",
-		})
-	}
+func (s *Service) GetAllPhemes(c *fiber.Ctx) error {
+	user, _ := middleware.CurrentUser(c)
 
-	phemes, err := models.FetchAllPhemes(user.ID)
+	phemes, err := s.Phemes.FetchAllPhemes(c.UserContext(), user.ID)
 	if err != nil {
-		c.Status(fiber.StatusNoContent)
-		return c.JSON(fiber.Map{
-			"message": "No phemes found for the user",
-		})
+		return err
 	}
 
 	return c.JSON(phemes)
@@ -44,23 +36,14 @@ func GetAllPhemes(c *fiber.Ctx) error {
 // @Tags         phemes
 // @Produce      json
 // @Success      200  {object}  []models.Pheme
-// @Failure      401  {object}  models.Message
+// @Failure      401  {object}  models.Problem
 // @Router       /pheme/mine [get]
-func GetUserPhemes(c *fiber.Ctx) error {
-	user, err := models.GetUser(c, SecretKey)
-	if err != nil {
-		c.Status(fiber.StatusUnauthorized)
-		return c.JSON(fiber.Map{
-			"message": "Unauthenticated",
-		})
-	}
+func (s *Service) GetUserPhemes(c *fiber.Ctx) error {
+	user, _ := middleware.CurrentUser(c)
 
-	phemes, err := models.FetchUserPhemes(user.ID, byte(models.PRIVATE))
+	phemes, err := s.Phemes.FetchUserPhemes(c.UserContext(), user.ID, byte(models.PRIVATE))
 	if err != nil {
-		c.Status(fiber.StatusNoContent)
-		return c.JSON(fiber.Map{
-			"message": "No phemes found for the user",
-		})
+		return err
 	}
 
 	return c.JSON(phemes)
@@ -73,33 +56,21 @@ func GetUserPhemes(c *fiber.Ctx) error {
 // @Produce      json
 // @Param        id   path      int  true  "Pheme ID"
 // @Success      200  {object}  models.Pheme
-// @Failure      204  {object}  models.Message
-// @Failure      400  {object}  models.Message
-// @Failure      401  {object}  models.Message
+// @Failure      400  {object}  models.Problem
+// @Failure      401  {object}  models.Problem
+// @Failure      404  {object}  models.Problem
 // @Router       /pheme/{id} [get]
-func GetPheme(c *fiber.Ctx) error {
-	user, err := models.GetUser(c, SecretKey)
-	if err != nil {
-		c.Status(fiber.StatusUnauthorized)
-		return c.JSON(fiber.Map{
-			"message": "Unauthenticated",
-		})
-	}
+func (s *Service) GetPheme(c *fiber.Ctx) error {
+	user, _ := middleware.CurrentUser(c)
 
 	var paramsPhemeID models.PhemeParamsID
 	if err := c.ParamsParser(&paramsPhemeID); err != nil {
-		c.Status(fiber.StatusBadRequest)
-		return c.JSON(fiber.Map{
-			"message": "Wrong parameters",
-		})
+		return models.ErrInvalidParameters
 	}
 
-	phemes, err := models.FetchPheme(paramsPhemeID.ID, user.ID)
+	phemes, err := s.Phemes.FetchPheme(c.UserContext(), paramsPhemeID.ID, user.ID)
 	if err != nil {
-		c.Status(fiber.StatusBadRequest)
-		return c.JSON(fiber.Map{
-			"message": "No phemes found",
-		})
+		return err
 	}
 
 	return c.JSON(phemes)
@@ -111,98 +82,126 @@ func GetPheme(c *fiber.Ctx) error {
 // @Tags         phemes
 // @Accept       json
 // @Produce      json
+// @Param        Idempotency-Key  header  string  false  "Key replaying the response to the retries"
 // @Success      200  {object}  models.PhemeParamsID
-// @Failure      400  {object}  models.Message
-// @Failure      401  {object}  models.Message
+// @Failure      400  {object}  models.Problem
+// @Failure      401  {object}  models.Problem
+// @Failure      403  {object}  models.Problem
+// @Failure      409  {object}  models.Problem
+// @Failure      422  {object}  models.Problem
+// @Failure      429  {object}  models.Problem
 // @Router       /pheme [post]
-func PostPheme(c *fiber.Ctx) error {
-	user, err := models.GetUser(c, SecretKey)
-	if err != nil {
-		c.Status(fiber.StatusUnauthorized)
-		return c.JSON(fiber.Map{
-			"message": "Unauthenticated",
-		})
-	}
+func (s *Service) PostPheme(c *fiber.Ctx) error {
+	user, _ := middleware.CurrentUser(c)
 
 	var body models.PhemeParamsPost
 	if err := c.BodyParser(&body); err != nil {
-		c.Status(fiber.StatusBadRequest)
-		return c.JSON(fiber.Map{
-			"message": "Invalid JSON body",
-		})
+		return models.ErrInvalidBody
 	}
 
-	if err := validate.Struct(body); err != nil {
-		c.Status(fiber.StatusBadRequest)
-		println(err.Error())
-		return c.JSON(fiber.Map{
-			"message": "Wrong JSON params",
-		})
+	if err := validateBody(body); err != nil {
+		return err
 	}
 
+	pheme, err := s.createPheme(c.UserContext(), user.ID, body)
+	if err != nil {
+		return err
+	}
+
+	s.publish(events.PhemeCreated, pheme)
+	s.notifyPheme(pheme)
+	return c.JSON(models.PhemeParamsID{ID: pheme.ID})
+}
+
+// createPheme adds the pheme posted by the user, the body must be validated.
+func (s *Service) createPheme(ctx context.Context, userID uint, body models.PhemeParamsPost) (models.Pheme, error) {
 	pheme := models.Pheme{}
 	pheme.Version = models.PhemeVersion()
 	pheme.CreatedAt = time.Now()
+	pheme.UpdatedAt = pheme.CreatedAt
 	pheme.Visibility = byte(body.Visibilty)
 	pheme.Category = body.Category
 	pheme.Text = body.Text
-	pheme.CreatedBy = user.ID
+	pheme.CreatedBy = userID
 	pheme.UserID = body.UserID
 
-	id, err := models.CreatePheme(pheme)
+	if body.ReplyTo != nil {
+		replied, err := s.visiblePheme(ctx, *body.ReplyTo, userID)
+		if errors.Is(err, models.ErrPhemeNotFound) {
+			return models.Pheme{}, models.ErrReplyNotFound
+		}
+		if err != nil {
+			return models.Pheme{}, err
+		}
+
+		pheme.ReplyTo = &replied.ID
+	}
+
+	id, err := s.Phemes.CreatePheme(ctx, pheme)
 	if err != nil {
-		c.Status(fiber.StatusBadRequest)
-		return c.JSON(fiber.Map{
-			"message": "Failed to insert pheme",
-		})
+		return models.Pheme{}, err
 	}
 
 	if id == 0 {
-		c.Status(fiber.StatusBadRequest)
-		return c.JSON(fiber.Map{
-			"message": "Cannot create phemes for non-friends users",
-		})
+		return models.Pheme{}, models.ErrNotFriends
+	}
+
+	pheme.ID = id
+	return pheme, nil
+}
+
+// visiblePheme returns the pheme if it is listed by the phemes of the user.
+func (s *Service) visiblePheme(ctx context.Context, phemeID uint, userID uint) (models.Pheme, error) {
+	pheme, err := s.Phemes.FindPheme(ctx, phemeID)
+	if err != nil {
+		return models.Pheme{}, err
+	}
+
+	audience, err := loadAudience(ctx, s.Users, userID)
+	if err != nil {
+		return models.Pheme{}, err
+	}
+
+	if !audience.visible(pheme) {
+		return models.Pheme{}, models.ErrPhemeNotFound
 	}
 
-	return c.JSON(models.PhemeParamsID{ID: id})
+	return pheme, nil
 }
 
 // DeletePheme godoc
 // @Summary      Delete a pheme from the user
-// @Description  delete a user pheme
+// @Description  move a user pheme to the trash, moderators can delete any pheme
 // @Tags         phemes
 // @Produce      json
 // @Param        id   path      int  true  "Pheme ID"
 // @Success      200  {object}  models.PhemeParamsID
-// @Failure      400  {object}  models.Message
-// @Failure      401  {object}  models.Message
+// @Failure      400  {object}  models.Problem
+// @Failure      401  {object}  models.Problem
+// @Failure      403  {object}  models.Problem
+// @Failure      404  {object}  models.Problem
 // @Router       /pheme/{id} [delete]
-func DeletePheme(c *fiber.Ctx) error {
-	user, err := models.GetUser(c, SecretKey)
-	if err != nil {
-		c.Status(fiber.StatusUnauthorized)
-		return c.JSON(fiber.Map{
-			"message": "Unauthenticated",
-		})
-	}
+func (s *Service) DeletePheme(c *fiber.Ctx) error {
+	user, _ := middleware.CurrentUser(c)
 
 	var paramsDelete models.PhemeParamsID
 	if err := c.ParamsParser(&paramsDelete); err != nil {
-		c.Status(fiber.StatusBadRequest)
-		return c.JSON(fiber.Map{
-			"message": "Wrong parameters",
-		})
+		return models.ErrInvalidParameters
 	}
 
-	id, err := models.DeletePheme(paramsDelete.ID, user.ID)
+	var pheme models.Pheme
+	var err error
+	if middleware.Can(c, models.PermissionPhemesModerate) {
+		pheme, err = s.Phemes.DeletePhemeByID(c.UserContext(), paramsDelete.ID, user.ID)
+	} else {
+		pheme, err = s.Phemes.DeletePheme(c.UserContext(), paramsDelete.ID, user.ID)
+	}
 	if err != nil {
-		c.Status(fiber.StatusBadRequest)
-		return c.JSON(fiber.Map{
-			"message": "Failed to delete pheme",
-		})
+		return err
 	}
 
-	return c.JSON(models.PhemeParamsID{ID: id})
+	s.publish(events.PhemeDeleted, pheme)
+	return c.JSON(models.PhemeParamsID{ID: pheme.ID})
 }
 
 // UpdatePheme godoc
@@ -213,48 +212,81 @@ func DeletePheme(c *fiber.Ctx) error {
 // @Produce      json
 // @Param        id   path      int  true  "Pheme ID"
 // @Success      200  {object}  models.Pheme
-// @Failure      400  {object}  models.Message
-// @Failure      401  {object}  models.Message
+// @Failure      400  {object}  models.Problem
+// @Failure      401  {object}  models.Problem
+// @Failure      404  {object}  models.Problem
 // @Router       /pheme/{id} [put]
-func UpdatePheme(c *fiber.Ctx) error {
-	user, err := models.GetUser(c, SecretKey)
-	if err != nil {
-		c.Status(fiber.StatusUnauthorized)
-		return c.JSON(fiber.Map{
-			"message": "Unauthenticated",
-		})
-	}
+func (s *Service) UpdatePheme(c *fiber.Ctx) error {
+	user, _ := middleware.CurrentUser(c)
 
 	var paramsUpdate models.PhemeParamsID
 	if err := c.ParamsParser(&paramsUpdate); err != nil {
-		c.Status(fiber.StatusBadRequest)
-		return c.JSON(fiber.Map{
-			"message": "Wrong parameters",
-		})
+		return models.ErrInvalidParameters
 	}
 
 	var pheme models.PhemeParamsPost
 	if err := c.BodyParser(&pheme); err != nil {
-		c.Status(fiber.StatusBadRequest)
-		return c.JSON(fiber.Map{
-			"message": "Invalid JSON body",
-		})
+		return models.ErrInvalidBody
 	}
 
-	if err := validate.Struct(pheme); err != nil {
-		c.Status(fiber.StatusBadRequest)
-		return c.JSON(fiber.Map{
-			"message": "Wrong JSON params",
-		})
+	if err := validateBody(pheme); err != nil {
+		return err
 	}
 
-	updatedPheme, err := models.UpdatePheme(pheme, paramsUpdate.ID, user.ID)
+	updatedPheme, err := s.Phemes.UpdatePheme(c.UserContext(), pheme, paramsUpdate.ID, user.ID)
 	if err != nil {
-		c.Status(fiber.StatusBadRequest)
-		return c.JSON(fiber.Map{
-			"message": "Failed to update pheme",
-		})
+		return err
 	}
 
+	s.publish(events.PhemeUpdated, updatedPheme)
 	return c.JSON(updatedPheme)
 }
+
+// GetTrash godoc
+// @Summary      Retrieve the trashed phemes
+// @Description  get the phemes of the user in the trash, until they are purged
+// @Tags         phemes
+// @Produce      json
+// @Success      200  {object}  []models.Pheme
+// @Failure      401  {object}  models.Problem
+// @Router       /pheme/trash [get]
+func (s *Service) GetTrash(c *fiber.Ctx) error {
+	user, _ := middleware.CurrentUser(c)
+
+	phemes, err := s.Phemes.FetchTrash(c.UserContext(), user.ID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(phemes)
+}
+
+// RestorePheme godoc
+// @Summary      Restore a pheme of the user
+// @Description  move a user pheme out of the trash, unless a moderator deleted it
+// @Tags         phemes
+// @Produce      json
+// @Param        id   path      int  true  "Pheme ID"
+// @Success      200  {object}  models.Pheme
+// @Failure      400  {object}  models.Problem
+// @Failure      401  {object}  models.Problem
+// @Failure      403  {object}  models.Problem
+// @Failure      404  {object}  models.Problem
+// @Router       /pheme/{id}/restore [post]
+func (s *Service) RestorePheme(c *fiber.Ctx) error {
+	user, _ := middleware.CurrentUser(c)
+
+	var paramsRestore models.PhemeParamsID
+	if err := c.ParamsParser(&paramsRestore); err != nil {
+		return models.ErrInvalidParameters
+	}
+
+	pheme, err := s.Phemes.RestorePheme(c.UserContext(), paramsRestore.ID, user.ID)
+	if err != nil {
+		return err
+	}
+
+	// The streams list the restored pheme again, like a new one.
+	s.publish(events.PhemeCreated, pheme)
+	return c.JSON(pheme)
+}
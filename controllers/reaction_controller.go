@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/feserr/pheme-user/middleware"
+	"github.com/feserr/pheme-user/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetReactions godoc
+// @Summary      Retrieve the reactions to a pheme
+// @Description  get the reactions of the users to a pheme visible for the user, the oldest first
+// @Tags         phemes
+// @Produce      json
+// @Param        id   path      int  true  "Pheme ID"
+// @Success      200  {object}  []models.Reaction
+// @Failure      400  {object}  models.Problem
+// @Failure      401  {object}  models.Problem
+// @Failure      404  {object}  models.Problem
+// @Router       /pheme/{id}/reactions [get]
+func (s *Service) GetReactions(c *fiber.Ctx) error {
+	user, _ := middleware.CurrentUser(c)
+
+	var params models.PhemeParamsID
+	if err := c.ParamsParser(&params); err != nil {
+		return models.ErrInvalidParameters
+	}
+
+	if _, err := s.visiblePheme(c.UserContext(), params.ID, user.ID); err != nil {
+		return err
+	}
+
+	reactions, err := s.Reactions.FetchReactions(c.UserContext(), params.ID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(reactions)
+}
+
+// PutReaction godoc
+// @Summary      React to a pheme
+// @Description  add the reaction of the user to a pheme visible for them, replacing the previous one, and notify its author
+// @Tags         phemes
+// @Accept       json
+// @Produce      json
+// @Param        id        path      int                    true  "Pheme ID"
+// @Param        reaction  body      models.ReactionParams  true  "Reaction"
+// @Success      200  {object}  models.Reaction
+// @Failure      400  {object}  models.Problem
+// @Failure      401  {object}  models.Problem
+// @Failure      404  {object}  models.Problem
+// @Router       /pheme/{id}/reaction [put]
+func (s *Service) PutReaction(c *fiber.Ctx) error {
+	user, _ := middleware.CurrentUser(c)
+
+	var params models.PhemeParamsID
+	if err := c.ParamsParser(&params); err != nil {
+		return models.ErrInvalidParameters
+	}
+
+	var body models.ReactionParams
+	if err := c.BodyParser(&body); err != nil {
+		return models.ErrInvalidBody
+	}
+
+	if err := validateBody(body); err != nil {
+		return err
+	}
+
+	pheme, err := s.visiblePheme(c.UserContext(), params.ID, user.ID)
+	if err != nil {
+		return err
+	}
+
+	reaction := models.Reaction{PhemeID: pheme.ID, UserID: user.ID, Emoji: body.Emoji, CreatedAt: time.Now()}
+	changed, err := s.Reactions.SetReaction(c.UserContext(), reaction)
+	if err != nil {
+		return err
+	}
+
+	if changed {
+		s.notifyReaction(c.UserContext(), pheme, reaction)
+	}
+
+	return c.JSON(reaction)
+}
+
+// DeleteReaction godoc
+// @Summary      Remove the reaction to a pheme
+// @Description  remove the reaction of the user to a pheme
+// @Tags         phemes
+// @Produce      json
+// @Param        id   path      int  true  "Pheme ID"
+// @Success      200  {object}  models.PhemeParamsID
+// @Failure      400  {object}  models.Problem
+// @Failure      401  {object}  models.Problem
+// @Failure      404  {object}  models.Problem
+// @Router       /pheme/{id}/reaction [delete]
+func (s *Service) DeleteReaction(c *fiber.Ctx) error {
+	user, _ := middleware.CurrentUser(c)
+
+	var params models.PhemeParamsID
+	if err := c.ParamsParser(&params); err != nil {
+		return models.ErrInvalidParameters
+	}
+
+	if err := s.Reactions.DeleteReaction(c.UserContext(), params.ID, user.ID); err != nil {
+		return err
+	}
+
+	return c.JSON(models.PhemeParamsID{ID: params.ID})
+}
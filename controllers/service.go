@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/feserr/pheme-user/events"
+	"github.com/feserr/pheme-user/models"
+	"github.com/feserr/pheme-user/notify"
+	"github.com/feserr/pheme-user/ratelimit"
+	"golang.org/x/exp/slog"
+)
+
+// Service holds the repositories used by the controllers. The handlers return
+// the errors to the error handler of the app, which writes and logs them.
+type Service struct {
+	Phemes models.PhemeRepository
+	Users  models.UserRepository
+	Tokens models.TokenRepository
+	// Transactions runs the atomic batches in a transaction of the repositories.
+	Transactions models.Transactor
+	Logger       *slog.Logger
+	// Limiter limits the rate of the requests, unlimited without a store.
+	Limiter ratelimit.Limiter
+	// IdempotencyKeys stores the responses replayed to the retries of the
+	// requests with an Idempotency-Key, for IdempotencyTTL.
+	IdempotencyKeys models.IdempotencyRepository
+	IdempotencyTTL  time.Duration
+	// BatchSize is the maximum items of a batch request.
+	BatchSize int
+	// Deletions schedules the deletion of the accounts after DeletionGrace.
+	Deletions     models.AccountDeletionRepository
+	DeletionGrace time.Duration
+	// Reactions are the reactions of the users to the phemes.
+	Reactions models.ReactionRepository
+	// Exports are the copies of the data of the users, built in the background.
+	Exports models.ExportRepository
+	// Events delivers the changes of the phemes to the streams, which send a
+	// heartbeat every Heartbeat and drop the clients not reading a write for
+	// WriteTimeout. The changes are not published without a bus.
+	Events       *events.Bus
+	Heartbeat    time.Duration
+	WriteTimeout time.Duration
+	// Notifications pushes the notifications to the connected users, opened
+	// with the cookies from the service or NotificationOrigins. They are not
+	// sent without a hub.
+	Notifications       *notify.Hub
+	NotificationOrigins []string
+}
@@ -0,0 +1,233 @@
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/feserr/pheme-user/events"
+	"github.com/feserr/pheme-user/middleware"
+	"github.com/feserr/pheme-user/models"
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/exp/slog"
+)
+
+// streamRetry is the time the clients wait before reconnecting a stream.
+const streamRetry = 3 * time.Second
+
+// The events of the stream that are not changes of the phemes.
+const (
+	// streamReset tells the client that the changes after its Last-Event-ID
+	// are no longer kept, so it must fetch the phemes again.
+	streamReset = "reset"
+	// streamLagging tells the client that it didn't read the changes fast
+	// enough, so it must reconnect with its Last-Event-ID.
+	streamLagging = "lagging"
+)
+
+// publish sends the change of the pheme to the streams, if they are served.
+func (s *Service) publish(eventType string, pheme models.Pheme) {
+	if s.Events != nil {
+		s.Events.Publish(eventType, pheme)
+	}
+}
+
+// StreamPhemes godoc
+// @Summary      Stream the changes of the phemes
+// @Description  send the created, updated and deleted phemes visible for the user as server-sent events, resuming after the Last-Event-ID. A reset event means that the phemes must be fetched again and a lagging event that the stream must be reconnected.
+// @Tags         phemes
+// @Produce      text/event-stream
+// @Param        Last-Event-ID  header  string  false  "ID of the last event received"
+// @Success      200  {string}  string  "event stream"
+// @Failure      400  {object}  models.Problem
+// @Failure      401  {object}  models.Problem
+// @Router       /pheme/stream [get]
+func (s *Service) StreamPhemes(c *fiber.Ctx) error {
+	user, _ := middleware.CurrentUser(c)
+
+	var lastID uint64
+	if header := c.Get("Last-Event-ID"); header != "" {
+		var err error
+		if lastID, err = strconv.ParseUint(header, 10, 64); err != nil {
+			return models.ErrInvalidParameters
+		}
+	}
+
+	stream := &phemeStream{
+		users:        s.Users,
+		logger:       s.Logger,
+		userID:       user.ID,
+		heartbeat:    s.Heartbeat,
+		writeTimeout: s.WriteTimeout,
+		conn:         c.Context().Conn(),
+		done:         c.Context().Done(),
+	}
+	if err := stream.refresh(c.UserContext()); err != nil {
+		return err
+	}
+
+	stream.subscription, stream.missed, stream.resumed = s.Events.Subscribe(lastID)
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+	c.Context().SetBodyStreamWriter(stream.run)
+
+	return nil
+}
+
+// phemeStream writes the changes of the phemes visible for a user. It runs
+// after the handler returns, so it can't use the context of the request.
+type phemeStream struct {
+	users        models.UserRepository
+	logger       *slog.Logger
+	userID       uint
+	heartbeat    time.Duration
+	writeTimeout time.Duration
+	conn         net.Conn
+	// done is closed when the server shuts down.
+	done <-chan struct{}
+
+	subscription *events.Subscription
+	missed       []events.Event
+	resumed      bool
+
+	audience audience
+}
+
+// refresh loads the relationships deciding the visible phemes.
+func (s *phemeStream) refresh(ctx context.Context) error {
+	audience, err := loadAudience(ctx, s.users, s.userID)
+	if err != nil {
+		return err
+	}
+
+	s.audience = audience
+	return nil
+}
+
+// run writes the events until the client goes away, the subscription is
+// closed or the server shuts down.
+func (s *phemeStream) run(w *bufio.Writer) {
+	defer s.subscription.Close()
+
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry.Milliseconds())
+	if !s.resumed {
+		fmt.Fprintf(w, "event: %s\ndata: {}\n\n", streamReset)
+	}
+	for _, event := range s.missed {
+		s.write(w, event)
+	}
+	if s.flush(w) != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(s.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case event, ok := <-s.subscription.Events():
+			if !ok {
+				if s.subscription.Lagging() {
+					fmt.Fprintf(w, "event: %s\ndata: {}\n\n", streamLagging)
+					s.flush(w)
+				}
+				return
+			}
+
+			s.write(w, event)
+		case <-heartbeat.C:
+			// The friends and followers may have changed since the last one.
+			if err := s.refresh(context.Background()); err != nil {
+				s.logger.Warn("failed to refresh the stream", "user", s.userID, "error", err)
+			}
+
+			fmt.Fprint(w, ": heartbeat\n\n")
+		}
+
+		if s.flush(w) != nil {
+			return
+		}
+	}
+}
+
+// write writes the event if its pheme is visible for the user.
+func (s *phemeStream) write(w *bufio.Writer, event events.Event) {
+	if !s.audience.visible(event.Pheme) {
+		return
+	}
+
+	data, err := json.Marshal(event.Pheme)
+	if err != nil {
+		s.logger.Error("failed to encode the event", "event", event.ID, "error", err)
+		return
+	}
+
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+}
+
+// flush sends the written events, failing when the client doesn't read them
+// within the write timeout.
+func (s *phemeStream) flush(w *bufio.Writer) error {
+	if s.writeTimeout > 0 && s.conn != nil {
+		if err := s.conn.SetWriteDeadline(time.Now().Add(s.writeTimeout)); err != nil {
+			return err
+		}
+	}
+
+	return w.Flush()
+}
+
+// audience are the relationships deciding the phemes visible for a user.
+type audience struct {
+	userID    uint
+	friends   map[uint]bool
+	followers map[uint]bool
+}
+
+// loadAudience returns the relationships of the user.
+func loadAudience(ctx context.Context, users models.UserRepository, userID uint) (audience, error) {
+	friends, err := users.GetFriends(ctx, userID)
+	if err != nil {
+		return audience{}, err
+	}
+
+	followers, err := users.GetFollowers(ctx, userID)
+	if err != nil {
+		return audience{}, err
+	}
+
+	return audience{userID: userID, friends: idSet(friends), followers: idSet(followers)}, nil
+}
+
+// visible returns if the pheme is listed by the phemes of the user.
+func (a audience) visible(pheme models.Pheme) bool {
+	switch {
+	case pheme.UserID == a.userID:
+		return true
+	case a.friends[pheme.UserID]:
+		return pheme.Visibility >= byte(models.PROTECTED)
+	case a.followers[pheme.UserID]:
+		return pheme.Visibility >= byte(models.PUBLIC)
+	}
+
+	return false
+}
+
+// idSet returns the set of the IDs.
+func idSet(ids []uint) map[uint]bool {
+	set := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+
+	return set
+}
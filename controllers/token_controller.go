@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/feserr/pheme-user/middleware"
+	"github.com/feserr/pheme-user/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetTokens godoc
+// @Summary      Retrieve the personal access tokens
+// @Description  get the personal access tokens of the user
+// @Tags         tokens
+// @Produce      json
+// @Success      200  {object}  []models.PersonalAccessToken
+// @Failure      400  {object}  models.Problem
+// @Failure      401  {object}  models.Problem
+// @Failure      403  {object}  models.Problem
+// @Router       /user/tokens [get]
+func (s *Service) GetTokens(c *fiber.Ctx) error {
+	user, _ := middleware.CurrentUser(c)
+
+	tokens, err := s.Tokens.FetchTokens(c.UserContext(), user.ID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(tokens)
+}
+
+// PostToken godoc
+// @Summary      Create a personal access token
+// @Description  post a personal access token, its value is only returned once
+// @Tags         tokens
+// @Accept       json
+// @Produce      json
+// @Param        token body     models.TokenParamsNew  true  "Token"
+// @Success      200  {object}  models.TokenCreated
+// @Failure      400  {object}  models.Problem
+// @Failure      401  {object}  models.Problem
+// @Failure      403  {object}  models.Problem
+// @Router       /user/tokens [post]
+func (s *Service) PostToken(c *fiber.Ctx) error {
+	user, _ := middleware.CurrentUser(c)
+
+	var body models.TokenParamsNew
+	if err := c.BodyParser(&body); err != nil {
+		return models.ErrInvalidBody
+	}
+
+	if err := validateBody(body); err != nil {
+		return err
+	}
+
+	if body.ExpiresAt != nil && body.ExpiresAt.Before(time.Now()) {
+		return models.Invalid("invalid_fields", "Wrong JSON params", models.FieldError{
+			Field:   "expiresAt",
+			Code:    "future",
+			Message: "The expiration date is in the past",
+		})
+	}
+
+	token := models.PersonalAccessToken{}
+	token.UserID = user.ID
+	token.Name = body.Name
+	token.CreatedAt = time.Now()
+	token.ExpiresAt = body.ExpiresAt
+	for _, name := range body.Scopes {
+		scope, err := models.ParseScope(name)
+		if err != nil {
+			return models.Invalid("invalid_fields", "Wrong JSON params", models.FieldError{
+				Field:   "scopes",
+				Code:    "scope",
+				Message: "Unknown scope " + name,
+			})
+		}
+
+		if !user.Can(scope) {
+			return models.Forbidden("missing_permission", "The user doesn't have the scope "+name)
+		}
+
+		token.Scopes = append(token.Scopes, scope)
+	}
+
+	value, err := token.Generate()
+	if err != nil {
+		return err
+	}
+
+	token, err = s.Tokens.CreateToken(c.UserContext(), token)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(models.TokenCreated{PersonalAccessToken: token, Token: value})
+}
+
+// DeleteToken godoc
+// @Summary      Revoke a personal access token
+// @Description  delete a personal access token of the user
+// @Tags         tokens
+// @Produce      json
+// @Param        id   path      int  true  "Token ID"
+// @Success      200  {object}  models.TokenParamsID
+// @Failure      400  {object}  models.Problem
+// @Failure      401  {object}  models.Problem
+// @Failure      403  {object}  models.Problem
+// @Failure      404  {object}  models.Problem
+// @Router       /user/tokens/{id} [delete]
+func (s *Service) DeleteToken(c *fiber.Ctx) error {
+	user, _ := middleware.CurrentUser(c)
+
+	var paramsID models.TokenParamsID
+	if err := c.ParamsParser(&paramsID); err != nil {
+		return models.ErrInvalidParameters
+	}
+
+	id, err := s.Tokens.DeleteToken(c.UserContext(), paramsID.ID, user.ID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(models.TokenParamsID{ID: id})
+}
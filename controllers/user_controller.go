@@ -1,10 +1,27 @@
 package controllers
 
 import (
+	"github.com/feserr/pheme-user/middleware"
 	"github.com/feserr/pheme-user/models"
 	"github.com/gofiber/fiber/v2"
 )
 
+var errSameUser = models.Invalid("same_user", "The user cannot relate to itself")
+
+// GetCurrentUser godoc
+// @Summary      Retrieve the logged user
+// @Description  get the logged user
+// @Tags         user
+// @Produce      json
+// @Success      200  {object}  models.User
+// @Failure      401  {object}  models.Problem
+// @Router       /user [get]
+func (s *Service) GetCurrentUser(c *fiber.Ctx) error {
+	user, _ := middleware.CurrentUser(c)
+
+	return c.JSON(user)
+}
+
 // GetUsersByName godoc
 // @Summary      Retrieve the user phemes
 // @Description  get the user phemes
@@ -13,25 +30,19 @@ import (
 // @Produce      json
 // @Param        name path      string  true  "User name"
 // @Success      200  {object}  []models.User
-// @Failure      400  {object}  models.Message
-// @Failure      401  {object}  models.Message
+// @Failure      400  {object}  models.Problem
+// @Failure      401  {object}  models.Problem
 // @Router       /user/{name} [get]
-func GetUsersByName(c *fiber.Ctx) error {
+func (s *Service) GetUsersByName(c *fiber.Ctx) error {
 	var paramsName models.UserParamsName
 	err := c.ParamsParser(&paramsName)
 	if err != nil {
-		c.Status(fiber.StatusBadRequest)
-		return c.JSON(fiber.Map{
-			"message": "Wrong parameters",
-		})
+		return models.ErrInvalidParameters
 	}
 
-	users, err := models.FindByName(paramsName.Name)
+	users, err := s.Users.FindByName(c.UserContext(), paramsName.Name)
 	if err != nil {
-		c.Status(fiber.StatusNoContent)
-		return c.JSON(fiber.Map{
-			"message": "No user found for that name",
-		})
+		return err
 	}
 
 	return c.JSON(users)
@@ -44,43 +55,35 @@ func GetUsersByName(c *fiber.Ctx) error {
 // @Accept       json
 // @Produce      json
 // @Param        id path      string  true  "Friend ID"
+// @Param        Idempotency-Key  header  string  false  "Key replaying the response to the retries"
 // @Success      200  {object}  models.Message
-// @Failure      400  {object}  models.Message
-// @Failure      401  {object}  models.Message
+// @Failure      400  {object}  models.Problem
+// @Failure      401  {object}  models.Problem
+// @Failure      404  {object}  models.Problem
+// @Failure      409  {object}  models.Problem
+// @Failure      422  {object}  models.Problem
+// @Failure      429  {object}  models.Problem
 // @Router       /user/friend/{id} [put]
-func AddFriend(c *fiber.Ctx) error {
+func (s *Service) AddFriend(c *fiber.Ctx) error {
 	var paramsID models.UserParamsID
 	err := c.ParamsParser(&paramsID)
 	if err != nil {
-		c.Status(fiber.StatusBadRequest)
-		return c.JSON(fiber.Map{
-			"message": "Wrong parameters",
-		})
+		return models.ErrInvalidParameters
 	}
 
-	user, err := models.GetUser(c, SecretKey)
-	if err != nil {
-		c.Status(fiber.StatusUnauthorized)
-		return c.JSON(fiber.Map{
-			"message": "Unauthenticated",
-		})
-	}
+	user, _ := middleware.CurrentUser(c)
 
 	if user.ID == paramsID.ID {
-		c.Status(fiber.StatusBadRequest)
-		return c.JSON(fiber.Map{
-			"message": "User ID and friend ID are the same",
-		})
+		return errSameUser
 	}
 
-	err = models.AddFriend(user.ID, paramsID.ID)
+	err = s.Users.AddFriend(c.UserContext(), user.ID, paramsID.ID)
 	if err != nil {
-		c.Status(fiber.StatusBadRequest)
-		return c.JSON(fiber.Map{
-			"message": "Fail to add the friend",
-		})
+		return err
 	}
 
+	s.notifyRelationship(c.UserContext(), user.ID, models.RelationshipOperation{Action: models.ActionAdd, Relation: models.RelationFriend, UserID: paramsID.ID})
+
 	return c.JSON(fiber.Map{
 		"message": "Success",
 	})
@@ -93,43 +96,35 @@ func AddFriend(c *fiber.Ctx) error {
 // @Accept       json
 // @Produce      json
 // @Param        id path      string  true  "Follower ID"
+// @Param        Idempotency-Key  header  string  false  "Key replaying the response to the retries"
 // @Success      200  {object}  models.Message
-// @Failure      400  {object}  models.Message
-// @Failure      401  {object}  models.Message
+// @Failure      400  {object}  models.Problem
+// @Failure      401  {object}  models.Problem
+// @Failure      404  {object}  models.Problem
+// @Failure      409  {object}  models.Problem
+// @Failure      422  {object}  models.Problem
+// @Failure      429  {object}  models.Problem
 // @Router       /user/follower/{id} [put]
-func AddFollower(c *fiber.Ctx) error {
+func (s *Service) AddFollower(c *fiber.Ctx) error {
 	var paramsID models.UserParamsID
 	err := c.ParamsParser(&paramsID)
 	if err != nil {
-		c.Status(fiber.StatusBadRequest)
-		return c.JSON(fiber.Map{
-			"message": "Wrong parameters",
-		})
+		return models.ErrInvalidParameters
 	}
 
-	user, err := models.GetUser(c, SecretKey)
-	if err != nil {
-		c.Status(fiber.StatusUnauthorized)
-		return c.JSON(fiber.Map{
-			"message": "Unauthenticated",
-		})
-	}
+	user, _ := middleware.CurrentUser(c)
 
 	if user.ID == paramsID.ID {
-		c.Status(fiber.StatusBadRequest)
-		return c.JSON(fiber.Map{
-			"message": "User ID and follower ID are the same",
-		})
+		return errSameUser
 	}
 
-	err = models.AddFollower(user.ID, paramsID.ID)
+	err = s.Users.AddFollower(c.UserContext(), user.ID, paramsID.ID)
 	if err != nil {
-		c.Status(fiber.StatusBadRequest)
-		return c.JSON(fiber.Map{
-			"message": "Fail to add the follower",
-		})
+		return err
 	}
 
+	s.notifyRelationship(c.UserContext(), user.ID, models.RelationshipOperation{Action: models.ActionAdd, Relation: models.RelationFollower, UserID: paramsID.ID})
+
 	return c.JSON(fiber.Map{
 		"message": "Success",
 	})
@@ -143,40 +138,26 @@ func AddFollower(c *fiber.Ctx) error {
 // @Produce      json
 // @Param        id path      string  true  "Friend ID"
 // @Success      200  {object}  models.Message
-// @Failure      400  {object}  models.Message
-// @Failure      401  {object}  models.Message
+// @Failure      400  {object}  models.Problem
+// @Failure      401  {object}  models.Problem
+// @Failure      404  {object}  models.Problem
 // @Router       /user/friend/{id} [delete]
-func DeleteFriend(c *fiber.Ctx) error {
+func (s *Service) DeleteFriend(c *fiber.Ctx) error {
 	var paramsID models.UserParamsID
 	err := c.ParamsParser(&paramsID)
 	if err != nil {
-		c.Status(fiber.StatusBadRequest)
-		return c.JSON(fiber.Map{
-			"message": "Wrong parameters",
-		})
+		return models.ErrInvalidParameters
 	}
 
-	user, err := models.GetUser(c, SecretKey)
-	if err != nil {
-		c.Status(fiber.StatusUnauthorized)
-		return c.JSON(fiber.Map{
-			"message": "Unauthenticated",
-		})
-	}
+	user, _ := middleware.CurrentUser(c)
 
 	if user.ID == paramsID.ID {
-		c.Status(fiber.StatusBadRequest)
-		return c.JSON(fiber.Map{
-			"message": "User ID and friend ID are the same",
-		})
+		return errSameUser
 	}
 
-	err = models.RemoveFriend(user.ID, paramsID.ID)
+	err = s.Users.RemoveFriend(c.UserContext(), user.ID, paramsID.ID)
 	if err != nil {
-		c.Status(fiber.StatusNoContent)
-		return c.JSON(fiber.Map{
-			"message": "Fail to delete the friend",
-		})
+		return err
 	}
 
 	return c.JSON(fiber.Map{
@@ -192,40 +173,26 @@ func DeleteFriend(c *fiber.Ctx) error {
 // @Produce      json
 // @Param        id path      string  true  "Follower ID"
 // @Success      200  {object}  models.Message
-// @Failure      400  {object}  models.Message
-// @Failure      401  {object}  models.Message
+// @Failure      400  {object}  models.Problem
+// @Failure      401  {object}  models.Problem
+// @Failure      404  {object}  models.Problem
 // @Router       /user/follower/{id} [delete]
-func DeleteFollower(c *fiber.Ctx) error {
+func (s *Service) DeleteFollower(c *fiber.Ctx) error {
 	var paramsID models.UserParamsID
 	err := c.ParamsParser(&paramsID)
 	if err != nil {
-		c.Status(fiber.StatusBadRequest)
-		return c.JSON(fiber.Map{
-			"message": "Wrong parameters",
-		})
+		return models.ErrInvalidParameters
 	}
 
-	user, err := models.GetUser(c, SecretKey)
-	if err != nil {
-		c.Status(fiber.StatusUnauthorized)
-		return c.JSON(fiber.Map{
-			"message": "Unauthenticated",
-		})
-	}
+	user, _ := middleware.CurrentUser(c)
 
 	if user.ID == paramsID.ID {
-		c.Status(fiber.StatusBadRequest)
-		return c.JSON(fiber.Map{
-			"message": "User ID and follower ID are the same",
-		})
+		return errSameUser
 	}
 
-	err = models.RemoveFollower(user.ID, paramsID.ID)
+	err = s.Users.RemoveFollower(c.UserContext(), user.ID, paramsID.ID)
 	if err != nil {
-		c.Status(fiber.StatusNoContent)
-		return c.JSON(fiber.Map{
-			"message": "Fail to delete the follower",
-		})
+		return err
 	}
 
 	return c.JSON(fiber.Map{
@@ -0,0 +1,177 @@
+// Package events delivers the changes of the phemes to the live streams.
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/feserr/pheme-user/models"
+)
+
+// The types of the events.
+const (
+	PhemeCreated = "pheme.created"
+	PhemeUpdated = "pheme.updated"
+	PhemeDeleted = "pheme.deleted"
+)
+
+// maxRecent is the maximum number of events kept to resume the subscriptions,
+// whatever their age.
+const maxRecent = 10000
+
+// Event is a change of a pheme.
+type Event struct {
+	ID    uint64
+	Type  string
+	Pheme models.Pheme
+	At    time.Time
+}
+
+// Bus delivers the published events to its subscriptions, keeping the recent
+// ones for the subscriptions resuming after a disconnection. The events of a
+// bus are only seen by the subscriptions of the same process.
+type Bus struct {
+	retention time.Duration
+	buffer    int
+
+	mu            sync.Mutex
+	lastID        uint64
+	recent        []Event
+	subscriptions map[*Subscription]bool
+	closed        bool
+}
+
+// NewBus returns a bus keeping the events for the retention, with a queue of
+// buffer events for every subscription.
+func NewBus(retention time.Duration, buffer int) *Bus {
+	return &Bus{
+		retention: retention,
+		buffer:    buffer,
+		// The IDs of the restarted buses are higher than the old ones, so the
+		// subscriptions can't resume from an event of another bus.
+		lastID:        uint64(time.Now().UnixMicro()),
+		subscriptions: map[*Subscription]bool{},
+	}
+}
+
+// Publish sends the event of the pheme to the subscriptions. The subscriptions
+// with a full queue are closed as lagging instead of blocking the publisher,
+// they can resume from the recent events.
+func (b *Bus) Publish(eventType string, pheme models.Pheme) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	b.lastID++
+	event := Event{ID: b.lastID, Type: eventType, Pheme: pheme, At: time.Now()}
+	b.recent = append(b.recent, event)
+	b.expire(event.At)
+
+	for subscription := range b.subscriptions {
+		select {
+		case subscription.events <- event:
+		default:
+			subscription.lagging = true
+			b.close(subscription)
+		}
+	}
+}
+
+// expire drops the events older than the retention, it must be called with
+// the lock held.
+func (b *Bus) expire(now time.Time) {
+	expired := 0
+	for expired < len(b.recent) && (len(b.recent)-expired > maxRecent || now.Sub(b.recent[expired].At) > b.retention) {
+		expired++
+	}
+
+	if expired > 0 {
+		b.recent = append(b.recent[:0:0], b.recent[expired:]...)
+	}
+}
+
+// Subscribe returns a subscription to the events published after the last ID,
+// 0 for the new events only, and the recent events after it. The subscription
+// can't resume when the events after the last ID are no longer kept: then
+// resumed is false and the recent events are empty.
+func (b *Bus) Subscribe(lastID uint64) (subscription *Subscription, missed []Event, resumed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subscription = &Subscription{bus: b, events: make(chan Event, b.buffer)}
+	if b.closed {
+		close(subscription.events)
+		return subscription, nil, true
+	}
+
+	b.subscriptions[subscription] = true
+	b.expire(time.Now())
+
+	if lastID == 0 || lastID == b.lastID {
+		return subscription, nil, true
+	}
+
+	// The event after the last ID must still be kept.
+	if lastID > b.lastID || len(b.recent) == 0 || b.recent[0].ID > lastID+1 {
+		return subscription, nil, false
+	}
+
+	for _, event := range b.recent {
+		if event.ID > lastID {
+			missed = append(missed, event)
+		}
+	}
+
+	return subscription, missed, true
+}
+
+// Close closes all the subscriptions, the events published after it are
+// dropped.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for subscription := range b.subscriptions {
+		b.close(subscription)
+	}
+}
+
+// close removes the subscription, it must be called with the lock held.
+func (b *Bus) close(subscription *Subscription) {
+	if b.subscriptions[subscription] {
+		delete(b.subscriptions, subscription)
+		close(subscription.events)
+	}
+}
+
+// Subscription receives the events published to a bus.
+type Subscription struct {
+	bus     *Bus
+	events  chan Event
+	lagging bool
+}
+
+// Events returns the channel of the events, closed with the subscription.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Lagging returns if the subscription was closed because its queue was full.
+func (s *Subscription) Lagging() bool {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	return s.lagging
+}
+
+// Close stops receiving the events.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	s.bus.close(s)
+}
@@ -0,0 +1,91 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/feserr/pheme-user/models"
+)
+
+func TestBusResume(t *testing.T) {
+	bus := NewBus(time.Minute, 8)
+	defer bus.Close()
+
+	live, missed, resumed := bus.Subscribe(0)
+	defer live.Close()
+	if len(missed) != 0 || !resumed {
+		t.Fatalf("got %d missed, resumed %v, want only the new events", len(missed), resumed)
+	}
+
+	bus.Publish(PhemeCreated, models.Pheme{ID: 1})
+	bus.Publish(PhemeUpdated, models.Pheme{ID: 1})
+	bus.Publish(PhemeDeleted, models.Pheme{ID: 1})
+
+	first := <-live.Events()
+	if first.Type != PhemeCreated || first.Pheme.ID != 1 {
+		t.Errorf("got %+v, want the created pheme", first)
+	}
+
+	resumedSub, missed, resumed := bus.Subscribe(first.ID)
+	defer resumedSub.Close()
+	if !resumed || len(missed) != 2 || missed[0].Type != PhemeUpdated || missed[1].Type != PhemeDeleted {
+		t.Errorf("got %+v, resumed %v, want the events after the first", missed, resumed)
+	}
+
+	if _, missed, resumed := bus.Subscribe(first.ID - 1); !resumed || len(missed) != 3 {
+		t.Errorf("got %+v, resumed %v, want all the events", missed, resumed)
+	}
+	if _, _, resumed := bus.Subscribe(first.ID + 100); resumed {
+		t.Error("resumed from an event not published yet")
+	}
+}
+
+func TestBusExpire(t *testing.T) {
+	bus := NewBus(0, 8)
+	defer bus.Close()
+
+	bus.Publish(PhemeCreated, models.Pheme{ID: 1})
+	bus.Publish(PhemeCreated, models.Pheme{ID: 2})
+
+	subscription, missed, resumed := bus.Subscribe(1)
+	defer subscription.Close()
+	if resumed || len(missed) != 0 {
+		t.Errorf("got %+v, resumed %v, want the expired events dropped", missed, resumed)
+	}
+}
+
+func TestBusLagging(t *testing.T) {
+	bus := NewBus(time.Minute, 2)
+	defer bus.Close()
+
+	slow, _, _ := bus.Subscribe(0)
+	fast, _, _ := bus.Subscribe(0)
+	defer fast.Close()
+
+	var last Event
+	for i := uint(1); i <= 3; i++ {
+		bus.Publish(PhemeCreated, models.Pheme{ID: i})
+		last = <-fast.Events()
+	}
+
+	received := 0
+	for range slow.Events() {
+		received++
+	}
+	if received != 2 || !slow.Lagging() || fast.Lagging() {
+		t.Errorf("got %d events, lagging %v, want the slow subscription closed after 2", received, slow.Lagging())
+	}
+
+	// The lagging subscription resumes from its last event.
+	resumedSub, missed, resumed := bus.Subscribe(last.ID - 1)
+	defer resumedSub.Close()
+	if !resumed || len(missed) != 1 || missed[0].Pheme.ID != 3 {
+		t.Errorf("got %+v, resumed %v, want the third event", missed, resumed)
+	}
+
+	slow.Close()
+	bus.Close()
+	if _, ok := <-fast.Events(); ok {
+		t.Error("the subscriptions are open after closing the bus")
+	}
+}
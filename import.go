@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/feserr/pheme-user/importer"
+	"github.com/feserr/pheme-user/models"
+	"github.com/feserr/pheme-user/repository"
+	"gorm.io/gorm"
+)
+
+const importUsage = `usage: pheme-user import -user <id> -format <jsonl|twitter> [flags] <file>
+
+flags:`
+
+// importPhemes runs the import subcommand, importing the phemes of an archive
+// to a user and printing the report.
+func importPhemes(db *gorm.DB, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.SetOutput(out)
+	flags.Usage = func() {
+		fmt.Fprintln(out, importUsage)
+		flags.PrintDefaults()
+	}
+
+	var query models.ImportQuery
+	userID := flags.Uint("user", 0, "ID of the user importing the phemes")
+	flags.StringVar(&query.Format, "format", "", "format of the archive, jsonl or twitter")
+	flags.StringVar(&query.Category, "category", "", "category of the phemes without one, imported by default")
+	flags.StringVar(&query.Categories, "categories", "", "renamed categories, e.g. news=News,dev=Development")
+	flags.StringVar(&query.Visibility, "visibility", "", "visibility of the phemes without one, public by default")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *userID == 0 || flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("the user and the file are required")
+	}
+
+	options, err := importer.NewOptions(query)
+	var invalid *models.Error
+	if errors.As(err, &invalid) {
+		for _, field := range invalid.Fields {
+			fmt.Fprintf(out, "-%s: %s\n", field.Field, field.Message)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	ctx := context.Background()
+	store := repository.NewGorm(db)
+	if _, err := store.FindByID(ctx, *userID); err != nil {
+		return fmt.Errorf("user %d: %w", *userID, err)
+	}
+
+	report, err := importer.Import(ctx, store, *userID, file, options)
+	for _, lineErr := range report.Errors {
+		fmt.Fprintf(out, "line %d: %s: %s\n", lineErr.Line, lineErr.Code, lineErr.Message)
+	}
+	fmt.Fprintf(out, "imported %d, duplicates %d, failed %d\n", report.Imported, report.Duplicates, report.Failed)
+
+	return err
+}
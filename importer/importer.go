@@ -0,0 +1,347 @@
+// Package importer imports the phemes of the archives of other platforms.
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/feserr/pheme-user/models"
+)
+
+// batchSize is the number of phemes added at once.
+const batchSize = 100
+
+// Options map the phemes of an archive to the phemes of the user.
+type Options struct {
+	// Format of the archive, models.ImportJSONLines or models.ImportTwitter.
+	Format string
+	// Category of the phemes without one.
+	Category string
+	// Categories renames the categories of the archive.
+	Categories map[string]string
+	// Visibility of the phemes without one.
+	Visibility byte
+}
+
+// NewOptions returns the options of the query, failing with the fields that
+// are not valid.
+func NewOptions(query models.ImportQuery) (Options, error) {
+	options := Options{
+		Format:     query.Format,
+		Category:   query.Category,
+		Categories: map[string]string{},
+		Visibility: byte(models.PUBLIC),
+	}
+
+	var fields []models.FieldError
+	if options.Format != models.ImportJSONLines && options.Format != models.ImportTwitter {
+		fields = append(fields, models.FieldError{Field: "format", Code: "oneof", Message: "The format must be jsonl or twitter"})
+	}
+
+	if options.Category == "" {
+		options.Category = "imported"
+	}
+
+	if query.Categories != "" {
+		for _, mapping := range strings.Split(query.Categories, ",") {
+			from, to, ok := strings.Cut(mapping, "=")
+			if !ok || from == "" || to == "" {
+				fields = append(fields, models.FieldError{Field: "categories", Code: "mapping", Message: "The categories must be renamed with from=to, separated by commas"})
+				break
+			}
+
+			options.Categories[from] = to
+		}
+	}
+
+	if query.Visibility != "" {
+		visibility, ok := models.ParseVisibility(query.Visibility)
+		if !ok {
+			fields = append(fields, models.FieldError{Field: "visibility", Code: "oneof", Message: "The visibility must be public, protected or private"})
+		}
+
+		options.Visibility = visibility
+	}
+
+	if len(fields) > 0 {
+		return options, models.Invalid("invalid_fields", "Wrong import options", fields...)
+	}
+
+	return options, nil
+}
+
+// Import adds the phemes of the archive to the user, reporting the lines that
+// fail. The phemes imported before are skipped, so an import can be run again.
+func Import(ctx context.Context, phemes models.PhemeRepository, userID uint, archive io.Reader, options Options) (models.ImportReport, error) {
+	imp := &importer{ctx: ctx, phemes: phemes, userID: userID, options: options}
+	imp.report.Errors = []models.ImportError{}
+
+	var err error
+	switch options.Format {
+	case models.ImportJSONLines:
+		err = imp.jsonLines(archive)
+	case models.ImportTwitter:
+		err = imp.twitter(archive)
+	default:
+		err = models.Invalid("invalid_format", "Unknown format "+options.Format)
+	}
+	if err != nil {
+		return imp.report, err
+	}
+
+	return imp.report, imp.flush()
+}
+
+// importer adds the phemes of an archive in batches.
+type importer struct {
+	ctx     context.Context
+	phemes  models.PhemeRepository
+	userID  uint
+	options Options
+	batch   []models.Pheme
+	report  models.ImportReport
+}
+
+// jsonLine is a pheme of a JSON Lines archive.
+type jsonLine struct {
+	ID         json.RawMessage `json:"id"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	Category   string          `json:"category"`
+	Visibility json.RawMessage `json:"visibility"`
+	Text       string          `json:"text"`
+}
+
+// jsonLines imports an archive with a JSON pheme by line.
+func (imp *importer) jsonLines(archive io.Reader) error {
+	reader := bufio.NewReader(archive)
+	for line := 1; ; line++ {
+		content, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+
+		if content = bytes.TrimSpace(content); len(content) > 0 {
+			if lineErr := imp.jsonLine(line, content); lineErr != nil {
+				imp.fail(line, lineErr)
+			} else if flushErr := imp.flushFull(); flushErr != nil {
+				return flushErr
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+	}
+}
+
+// jsonLine adds the pheme of a line of a JSON Lines archive.
+func (imp *importer) jsonLine(line int, content []byte) error {
+	var record jsonLine
+	if err := json.Unmarshal(content, &record); err != nil {
+		return models.Invalid("invalid_json", "Invalid JSON: "+err.Error())
+	}
+
+	visibility := imp.options.Visibility
+	if len(record.Visibility) > 0 && string(record.Visibility) != "null" {
+		var ok bool
+		if visibility, ok = parseVisibility(record.Visibility); !ok {
+			return invalidField("visibility", "oneof", "The visibility must be public, protected, private or a number up to 255")
+		}
+	}
+
+	key := strings.Trim(string(record.ID), `"`)
+	if key == "" || key == "null" {
+		hash := sha256.Sum256([]byte(record.CreatedAt.UTC().Format(time.RFC3339Nano) + "\n" + record.Text))
+		key = hex.EncodeToString(hash[:])
+	}
+
+	return imp.add(models.ImportJSONLines+":"+key, record.CreatedAt, record.Category, visibility, record.Text)
+}
+
+// tweet is a tweet of a Twitter archive.
+type tweet struct {
+	ID        string `json:"id_str"`
+	CreatedAt string `json:"created_at"`
+	FullText  string `json:"full_text"`
+	Text      string `json:"text"`
+	Entities  struct {
+		Hashtags []struct {
+			Text string `json:"text"`
+		} `json:"hashtags"`
+	} `json:"entities"`
+}
+
+// twitter imports the tweets of a Twitter archive, the tweets.js file or its
+// JSON array. The tweets are categorized by their first hashtag.
+func (imp *importer) twitter(archive io.Reader) error {
+	content, err := io.ReadAll(archive)
+	if err != nil {
+		return err
+	}
+
+	// The tweets.js file assigns the array to a variable.
+	if start := bytes.IndexByte(content, '['); start > 0 && !bytes.HasPrefix(bytes.TrimSpace(content), []byte("[")) {
+		content = content[start:]
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(content, &items); err != nil {
+		return models.Invalid("invalid_archive", "The Twitter archive must be an array of tweets: "+err.Error())
+	}
+
+	for i, item := range items {
+		if itemErr := imp.tweet(item); itemErr != nil {
+			imp.fail(i+1, itemErr)
+		} else if flushErr := imp.flushFull(); flushErr != nil {
+			return flushErr
+		}
+	}
+
+	return nil
+}
+
+// tweet adds the pheme of a tweet, with or without its wrapping object.
+func (imp *importer) tweet(item json.RawMessage) error {
+	var wrapped struct {
+		Tweet *tweet `json:"tweet"`
+	}
+	if err := json.Unmarshal(item, &wrapped); err != nil {
+		return models.Invalid("invalid_json", "Invalid JSON: "+err.Error())
+	}
+
+	record := wrapped.Tweet
+	if record == nil {
+		record = &tweet{}
+		if err := json.Unmarshal(item, record); err != nil {
+			return models.Invalid("invalid_json", "Invalid JSON: "+err.Error())
+		}
+	}
+
+	if record.ID == "" {
+		return invalidField("id_str", "required", "The field is required")
+	}
+
+	createdAt, err := time.Parse(time.RubyDate, record.CreatedAt)
+	if err != nil {
+		return invalidField("created_at", "date", "The date must be like Mon Jan 02 15:04:05 -0700 2006")
+	}
+
+	text := record.FullText
+	if text == "" {
+		text = record.Text
+	}
+
+	category := ""
+	if len(record.Entities.Hashtags) > 0 {
+		category = record.Entities.Hashtags[0].Text
+	}
+
+	return imp.add(models.ImportTwitter+":"+record.ID, createdAt, category, imp.options.Visibility, html.UnescapeString(text))
+}
+
+// add validates a pheme of the archive and adds it to the batch.
+func (imp *importer) add(key string, createdAt time.Time, category string, visibility byte, text string) error {
+	if createdAt.IsZero() {
+		return invalidField("createdAt", "required", "The field is required")
+	}
+
+	if strings.TrimSpace(text) == "" {
+		return invalidField("text", "required", "The field is required")
+	}
+
+	if category == "" {
+		category = imp.options.Category
+	}
+	if renamed, ok := imp.options.Categories[category]; ok {
+		category = renamed
+	}
+
+	imp.batch = append(imp.batch, models.Pheme{
+		Version:    models.PhemeVersion(),
+		CreatedAt:  createdAt,
+		UpdatedAt:  createdAt,
+		Visibility: visibility,
+		Category:   category,
+		Text:       text,
+		CreatedBy:  imp.userID,
+		UserID:     imp.userID,
+		ImportKey:  &key,
+	})
+
+	return nil
+}
+
+// fail reports the error of a line.
+func (imp *importer) fail(line int, err error) {
+	importErr := models.ImportError{Line: line, Code: "invalid", Message: err.Error()}
+
+	var modelErr *models.Error
+	if errors.As(err, &modelErr) {
+		importErr.Code = modelErr.Code
+		importErr.Message = modelErr.Message
+		if len(modelErr.Fields) > 0 {
+			messages := make([]string, len(modelErr.Fields))
+			for i, field := range modelErr.Fields {
+				messages[i] = fmt.Sprintf("%s: %s", field.Field, field.Message)
+			}
+			importErr.Message = strings.Join(messages, ", ")
+		}
+	}
+
+	imp.report.Failed++
+	imp.report.Errors = append(imp.report.Errors, importErr)
+}
+
+// flushFull adds the phemes of the batch once it is full.
+func (imp *importer) flushFull() error {
+	if len(imp.batch) < batchSize {
+		return nil
+	}
+
+	return imp.flush()
+}
+
+// flush adds the phemes of the batch, counting the ones imported before.
+func (imp *importer) flush() error {
+	if len(imp.batch) == 0 {
+		return nil
+	}
+
+	imported, err := imp.phemes.ImportPhemes(imp.ctx, imp.batch)
+	if err != nil {
+		return err
+	}
+
+	imp.report.Imported += imported
+	imp.report.Duplicates += len(imp.batch) - imported
+	imp.batch = imp.batch[:0]
+
+	return nil
+}
+
+// parseVisibility returns the visibility of its name or number.
+func parseVisibility(raw json.RawMessage) (byte, bool) {
+	var name string
+	if err := json.Unmarshal(raw, &name); err == nil {
+		return models.ParseVisibility(name)
+	}
+
+	number, err := strconv.ParseUint(string(raw), 10, 8)
+	return byte(number), err == nil
+}
+
+// invalidField returns the error of a field of a line.
+func invalidField(field string, code string, message string) error {
+	return models.Invalid("invalid_fields", "Wrong pheme", models.FieldError{Field: field, Code: code, Message: message})
+}
@@ -0,0 +1,129 @@
+package importer
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/feserr/pheme-user/models"
+	"github.com/feserr/pheme-user/repository"
+)
+
+func newStore(t *testing.T) (*repository.Memory, uint) {
+	t.Helper()
+
+	store := repository.NewMemory()
+	user := store.AddUser(models.User{Version: models.UserVersion(), Name: "alice", Email: "alice@user.com"})
+
+	return store, user.ID
+}
+
+func TestNewOptions(t *testing.T) {
+	options, err := NewOptions(models.ImportQuery{Format: "jsonl", Categories: "news=News,dev=Development", Visibility: "protected"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.Category != "imported" || options.Categories["dev"] != "Development" || options.Visibility != byte(models.PROTECTED) {
+		t.Errorf("got %+v, want the default category, renamed categories and protected visibility", options)
+	}
+
+	for _, query := range []models.ImportQuery{
+		{},
+		{Format: "csv"},
+		{Format: "jsonl", Categories: "news"},
+		{Format: "jsonl", Visibility: "friends"},
+	} {
+		if _, err := NewOptions(query); err == nil {
+			t.Errorf("expected an error for %+v", query)
+		}
+	}
+}
+
+func TestImportJSONLines(t *testing.T) {
+	store, userID := newStore(t)
+	options, err := NewOptions(models.ImportQuery{Format: models.ImportJSONLines, Categories: "dev=Development"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive := `{"id": 1, "createdAt": "2019-03-01T10:00:00Z", "category": "dev", "visibility": "private", "text": "first"}
+{"createdAt": "2019-03-02T10:00:00Z", "visibility": 175, "text": "second"}
+
+not json
+{"id": "4", "createdAt": "2019-03-04T10:00:00Z", "text": ""}
+{"id": "5", "text": "no date"}
+{"id": "6", "createdAt": "2019-03-06T10:00:00Z", "visibility": "friends", "text": "unknown visibility"}
+{"id": 1, "createdAt": "2019-03-01T10:00:00Z", "text": "repeated"}`
+
+	report, err := Import(context.Background(), store, userID, strings.NewReader(archive), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Imported != 2 || report.Duplicates != 1 || report.Failed != 4 {
+		t.Errorf("got %+v, want 2 imported, 1 duplicate and 4 failed", report)
+	}
+
+	lines := []int{}
+	for _, lineErr := range report.Errors {
+		lines = append(lines, lineErr.Line)
+	}
+	if len(lines) != 4 || lines[0] != 4 || lines[1] != 5 || lines[2] != 6 || lines[3] != 7 {
+		t.Errorf("got the errors %+v, want the lines 4 to 7", report.Errors)
+	}
+
+	phemes, err := store.FetchPersonalPhemes(context.Background(), userID)
+	if err != nil || len(phemes) != 2 {
+		t.Fatalf("got %d phemes, %v, want 2", len(phemes), err)
+	}
+	first, second := phemes[0], phemes[1]
+	if !first.CreatedAt.Equal(time.Date(2019, 3, 1, 10, 0, 0, 0, time.UTC)) || first.Category != "Development" || first.Visibility != byte(models.PRIVATE) {
+		t.Errorf("got %+v, want the date, renamed category and visibility of the archive", first)
+	}
+	if second.Category != "imported" || second.Visibility != byte(models.PROTECTED) {
+		t.Errorf("got %+v, want the default category", second)
+	}
+
+	// Importing again skips the phemes imported before, with or without IDs.
+	report, err = Import(context.Background(), store, userID, strings.NewReader(archive), options)
+	if err != nil || report.Imported != 0 || report.Duplicates != 3 {
+		t.Errorf("got %+v, %v, want every pheme skipped", report, err)
+	}
+}
+
+func TestImportTwitter(t *testing.T) {
+	store, userID := newStore(t)
+	options, err := NewOptions(models.ImportQuery{Format: models.ImportTwitter})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive := `window.YTD.tweets.part0 = [
+  {"tweet": {"id_str": "100", "created_at": "Wed Oct 10 20:19:24 +0000 2018", "full_text": "Fish &amp; chips #food", "entities": {"hashtags": [{"text": "food"}]}}},
+  {"id_str": "101", "created_at": "Thu Oct 11 08:00:00 +0000 2018", "text": "no wrapper"},
+  {"tweet": {"id_str": "102", "created_at": "yesterday", "full_text": "bad date"}}
+]`
+
+	report, err := Import(context.Background(), store, userID, strings.NewReader(archive), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Imported != 2 || report.Failed != 1 || report.Errors[0].Line != 3 {
+		t.Errorf("got %+v, want 2 imported and the third failed", report)
+	}
+
+	phemes, err := store.FetchPersonalPhemes(context.Background(), userID)
+	if err != nil || len(phemes) != 2 {
+		t.Fatalf("got %d phemes, %v, want 2", len(phemes), err)
+	}
+	if phemes[0].Text != "Fish & chips #food" || phemes[0].Category != "food" || phemes[0].Visibility != byte(models.PUBLIC) {
+		t.Errorf("got %+v, want the unescaped text categorized by its hashtag", phemes[0])
+	}
+	if phemes[0].CreatedAt.Year() != 2018 || phemes[1].Category != "imported" {
+		t.Errorf("got %+v, want the date of the tweets and the default category", phemes)
+	}
+
+	if _, err := Import(context.Background(), store, userID, strings.NewReader(`{"tweets": []}`), options); err == nil {
+		t.Error("expected an error for an archive without an array of tweets")
+	}
+}
@@ -0,0 +1,929 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/feserr/pheme-user/apitest"
+	"github.com/feserr/pheme-user/config"
+	"github.com/feserr/pheme-user/controllers"
+	"github.com/feserr/pheme-user/database"
+	"github.com/feserr/pheme-user/jobs"
+	"github.com/feserr/pheme-user/logging"
+	"github.com/feserr/pheme-user/middleware"
+	"github.com/feserr/pheme-user/models"
+	"github.com/feserr/pheme-user/notify"
+	"github.com/feserr/pheme-user/repository"
+	"github.com/feserr/pheme-user/tracing"
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/exp/slog"
+	"gorm.io/gorm"
+)
+
+// integrationServer is the whole app backed by a SQLite database.
+type integrationServer struct {
+	apitest.Server
+	db      *gorm.DB
+	health  *controllers.Health
+	service *controllers.Service
+}
+
+func newIntegrationServer(t *testing.T) *integrationServer {
+	t.Helper()
+
+	return newObservedIntegrationServer(t, logging.Discard(), trace.NewNoopTracerProvider())
+}
+
+// newObservedIntegrationServer returns the integration server writing its logs
+// to the logger and its spans to the tracer.
+func newObservedIntegrationServer(t *testing.T, logger *slog.Logger, tracer trace.TracerProvider) *integrationServer {
+	t.Helper()
+
+	return newConfiguredIntegrationServer(t, config.Default(), notify.NewMemory(), logger, tracer)
+}
+
+// newConfiguredIntegrationServer returns the integration server with the
+// config, carrying its notifications through the pub/sub.
+func newConfiguredIntegrationServer(t *testing.T, cfg config.Config, pubsub notify.PubSub, logger *slog.Logger, tracer trace.TracerProvider) *integrationServer {
+	t.Helper()
+
+	db, err := database.Open(database.Config{
+		DSN: "sqlite:" + filepath.Join(t.TempDir(), "pheme.db"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	app, health, service, err := newApp(cfg, db, apitest.Verifier(t), pubsub, logger, tracer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go service.Notifications.Run(ctx)
+	t.Cleanup(cancel)
+
+	return &integrationServer{Server: apitest.Server{T: t, App: app}, db: db, health: health, service: service}
+}
+
+// addUser inserts a user like the pheme-auth service does.
+func (s *integrationServer) addUser(name string) apitest.User {
+	s.T.Helper()
+
+	user := models.User{
+		Version:      models.UserVersion(),
+		Name:         name,
+		Email:        name + "@user.com",
+		Password:     []byte("password"),
+		PasswordDate: time.Now(),
+		CreatedAt:    time.Now(),
+	}
+	if err := s.db.Create(&user).Error; err != nil {
+		s.T.Fatal(err)
+	}
+
+	return apitest.NewUser(s.T, user)
+}
+
+func (s *integrationServer) postPheme(user apitest.User, pheme models.PhemeParamsPost) uint {
+	s.T.Helper()
+
+	res := s.Request(user, http.MethodPost, "/api/v1/pheme", pheme)
+	apitest.ExpectStatus(s.T, res, http.StatusOK)
+
+	var created models.PhemeParamsID
+	apitest.Decode(s.T, res, &created)
+
+	return created.ID
+}
+
+func (s *integrationServer) phemes(user apitest.User, target string) []models.Pheme {
+	s.T.Helper()
+
+	res := s.Request(user, http.MethodGet, target, nil)
+	apitest.ExpectStatus(s.T, res, http.StatusOK)
+
+	var phemes []models.Pheme
+	apitest.Decode(s.T, res, &phemes)
+
+	return phemes
+}
+
+func TestIntegrationPhemes(t *testing.T) {
+	s := newIntegrationServer(t)
+	alice := s.addUser("alice")
+
+	id := s.postPheme(alice, models.PhemeParamsPost{
+		Visibilty: byte(models.PUBLIC),
+		Category:  "test",
+		Text:      "first",
+		UserID:    alice.ID,
+	})
+	target := fmt.Sprintf("/api/v1/pheme/%d", id)
+
+	res := s.Request(alice, http.MethodPut, target, models.PhemeParamsPost{
+		Visibilty: byte(models.PRIVATE),
+		Category:  "test",
+		Text:      "updated",
+		UserID:    alice.ID,
+	})
+	apitest.ExpectStatus(t, res, http.StatusOK)
+
+	res = s.Request(alice, http.MethodGet, target, nil)
+	apitest.ExpectStatus(t, res, http.StatusOK)
+
+	var pheme models.Pheme
+	apitest.Decode(t, res, &pheme)
+	if pheme.Text != "updated" || pheme.Visibility != byte(models.PRIVATE) {
+		t.Errorf("got pheme %+v", pheme)
+	}
+
+	if phemes := s.phemes(alice, "/api/v1/pheme/mine"); len(phemes) != 1 {
+		t.Errorf("got %d phemes, want 1", len(phemes))
+	}
+
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodDelete, target, nil), http.StatusOK)
+
+	if phemes := s.phemes(alice, "/api/v1/pheme/mine"); len(phemes) != 0 {
+		t.Errorf("got %d phemes, want none", len(phemes))
+	}
+}
+
+func TestIntegrationTrash(t *testing.T) {
+	s := newIntegrationServer(t)
+	alice := s.addUser("alice")
+
+	kept := s.postPheme(alice, models.PhemeParamsPost{Category: "test", Text: "kept", UserID: alice.ID})
+	purged := s.postPheme(alice, models.PhemeParamsPost{Category: "test", Text: "purged", UserID: alice.ID})
+	for _, id := range []uint{kept, purged} {
+		apitest.ExpectStatus(t, s.Request(alice, http.MethodDelete, fmt.Sprintf("/api/v1/pheme/%d", id), nil), http.StatusOK)
+	}
+
+	if phemes := s.phemes(alice, "/api/v1/pheme"); len(phemes) != 0 {
+		t.Errorf("got %d phemes, want the trashed ones excluded", len(phemes))
+	}
+	if trash := s.phemes(alice, "/api/v1/pheme/trash"); len(trash) != 2 || trash[0].ID != purged {
+		t.Errorf("got the trash %+v, want the last trashed first", trash)
+	}
+
+	// Only the phemes trashed before the retention are purged.
+	old := time.Now().Add(-48 * time.Hour)
+	if err := s.db.Unscoped().Model(&models.Pheme{}).Where("id = ?", purged).Update("deleted_at", old).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := jobs.PurgeTrash(repository.NewGorm(s.db), 24*time.Hour, logging.Discard())(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int64
+	if err := s.db.Unscoped().Model(&models.Pheme{}).Count(&count).Error; err != nil || count != 1 {
+		t.Errorf("got %d phemes, %v, want the old trashed pheme purged", count, err)
+	}
+
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodPost, fmt.Sprintf("/api/v1/pheme/%d/restore", kept), nil), http.StatusOK)
+	apitest.ExpectProblem(t, s.Request(alice, http.MethodPost, fmt.Sprintf("/api/v1/pheme/%d/restore", purged), nil), http.StatusNotFound, "pheme_not_found")
+	if phemes := s.phemes(alice, "/api/v1/pheme"); len(phemes) != 1 || phemes[0].ID != kept {
+		t.Errorf("got %+v, want the restored pheme", phemes)
+	}
+
+	// The owner can't restore the pheme deleted by a moderator.
+	bob := s.addUser("bob")
+	if err := repository.NewGorm(s.db).GrantRole(context.Background(), bob.ID, models.RoleModerator, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	apitest.ExpectStatus(t, s.Request(bob, http.MethodDelete, fmt.Sprintf("/api/v1/pheme/%d", kept), nil), http.StatusOK)
+	apitest.ExpectProblem(t, s.Request(alice, http.MethodPost, fmt.Sprintf("/api/v1/pheme/%d/restore", kept), nil), http.StatusForbidden, "pheme_moderated")
+}
+
+func TestIntegrationReactions(t *testing.T) {
+	s := newIntegrationServer(t)
+	alice := s.addUser("alice")
+	bob := s.addUser("bob")
+	store := repository.NewGorm(s.db)
+	ctx := context.Background()
+	for _, users := range [][2]uint{{alice.ID, bob.ID}, {bob.ID, alice.ID}} {
+		if err := store.AddFriend(ctx, users[0], users[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	question := s.postPheme(alice, models.PhemeParamsPost{Visibilty: byte(models.PROTECTED), Category: "test", Text: "question", UserID: alice.ID})
+	answer := s.postPheme(bob, models.PhemeParamsPost{Visibilty: byte(models.PROTECTED), Category: "test", Text: "answer", UserID: bob.ID, ReplyTo: &question})
+	if phemes := s.phemes(bob, "/api/v1/pheme/mine"); len(phemes) != 1 || phemes[0].ID != answer || phemes[0].ReplyTo == nil || *phemes[0].ReplyTo != question {
+		t.Errorf("got %+v, want the reply to the question", phemes)
+	}
+
+	// Only the new emojis change the reaction.
+	target := fmt.Sprintf("/api/v1/pheme/%d/reaction", question)
+	for _, emoji := range []string{"👍", "🎉"} {
+		apitest.ExpectStatus(t, s.Request(bob, http.MethodPut, target, models.ReactionParams{Emoji: emoji}), http.StatusOK)
+	}
+	for _, reaction := range []struct {
+		emoji   string
+		changed bool
+	}{{"🎉", false}, {"👀", true}} {
+		changed, err := store.SetReaction(ctx, models.Reaction{PhemeID: question, UserID: bob.ID, Emoji: reaction.emoji, CreatedAt: time.Now()})
+		if err != nil || changed != reaction.changed {
+			t.Errorf("got %t, %v for %s, want %t", changed, err, reaction.emoji, reaction.changed)
+		}
+	}
+	if reactions, err := store.FetchReactions(ctx, question); err != nil || len(reactions) != 1 || reactions[0].Emoji != "👀" {
+		t.Errorf("got %+v, %v, want the last reaction of bob", reactions, err)
+	}
+
+	// The reactions go with the purged phemes and the deleted users.
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodPut, fmt.Sprintf("/api/v1/pheme/%d/reaction", answer), models.ReactionParams{Emoji: "👍"}), http.StatusOK)
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodDelete, fmt.Sprintf("/api/v1/pheme/%d", question), nil), http.StatusOK)
+	if _, err := store.PurgeTrash(ctx, time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteByID(ctx, bob.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int64
+	if err := s.db.Model(&models.Reaction{}).Count(&count).Error; err != nil || count != 0 {
+		t.Errorf("got %d reactions, %v, want none", count, err)
+	}
+}
+
+func TestIntegrationAccountDeletion(t *testing.T) {
+	s := newIntegrationServer(t)
+	alice := s.addUser("alice")
+	bob := s.addUser("bob")
+
+	for _, target := range []string{"friend", "follower"} {
+		apitest.ExpectStatus(t, s.Request(alice, http.MethodPut, fmt.Sprintf("/api/v1/user/%s/%d", target, bob.ID), nil), http.StatusOK)
+		apitest.ExpectStatus(t, s.Request(bob, http.MethodPut, fmt.Sprintf("/api/v1/user/%s/%d", target, alice.ID), nil), http.StatusOK)
+	}
+
+	s.postPheme(alice, models.PhemeParamsPost{Category: "test", Text: "own", UserID: alice.ID})
+	s.postPheme(alice, models.PhemeParamsPost{Category: "test", Text: "for bob", UserID: bob.ID})
+	s.postPheme(bob, models.PhemeParamsPost{Category: "test", Text: "for alice", UserID: alice.ID})
+	kept := s.postPheme(bob, models.PhemeParamsPost{Category: "test", Text: "kept", UserID: bob.ID})
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodPost, "/api/v1/user/tokens", models.TokenParamsNew{Name: "cli", Scopes: []string{string(models.PermissionPhemesRead)}}), http.StatusOK)
+
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodPost, "/api/v1/user/export", nil), http.StatusAccepted)
+
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodDelete, "/api/v1/user", nil), http.StatusAccepted)
+	if err := s.db.Model(&models.AccountDeletion{}).Where("user_id = ?", alice.ID).Update("scheduled_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	store := repository.NewGorm(s.db)
+	if err := jobs.DeleteAccounts(store, s.service.Users, logging.Discard())(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The deleted user was cached by the requests above.
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodGet, "/api/v1/pheme", nil), http.StatusUnauthorized)
+
+	counts := map[string]int64{
+		"users":                  1,
+		"phemes":                 1,
+		"friendship":             0,
+		"followship":             0,
+		"personal_access_tokens": 0,
+		"account_deletions":      0,
+		"exports":                0,
+	}
+	for table, want := range counts {
+		var count int64
+		if err := s.db.Table(table).Count(&count).Error; err != nil || count != want {
+			t.Errorf("got %d rows in %s, %v, want %d", count, table, err, want)
+		}
+	}
+
+	if phemes := s.phemes(bob, "/api/v1/pheme"); len(phemes) != 1 || phemes[0].ID != kept {
+		t.Errorf("got %+v, want only the pheme of bob", phemes)
+	}
+}
+
+func TestIntegrationExport(t *testing.T) {
+	s := newIntegrationServer(t)
+	alice := s.addUser("alice")
+	bob := s.addUser("bob")
+
+	apitest.ExpectStatus(t, s.Request(bob, http.MethodPut, fmt.Sprintf("/api/v1/user/friend/%d", alice.ID), nil), http.StatusOK)
+	trashed := s.postPheme(alice, models.PhemeParamsPost{Category: "test", Text: "trashed", UserID: alice.ID})
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodDelete, fmt.Sprintf("/api/v1/pheme/%d", trashed), nil), http.StatusOK)
+	s.postPheme(bob, models.PhemeParamsPost{Category: "test", Text: "for alice", UserID: alice.ID})
+
+	res := s.Request(alice, http.MethodPost, "/api/v1/user/export", nil)
+	apitest.ExpectStatus(t, res, http.StatusAccepted)
+
+	var export models.Export
+	apitest.Decode(t, res, &export)
+	target := fmt.Sprintf("/api/v1/user/export/%d", export.ID)
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodGet, target, nil), http.StatusAccepted)
+
+	store := repository.NewGorm(s.db)
+	if err := jobs.BuildExports(store, store, store, store, logging.Discard())(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	res = s.Request(alice, http.MethodGet, target, nil)
+	apitest.ExpectStatus(t, res, http.StatusOK)
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := archive.Open("phemes.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var phemes []models.Pheme
+	if err := json.NewDecoder(f).Decode(&phemes); err != nil || len(phemes) != 2 || !phemes[0].DeletedAt.Valid {
+		t.Errorf("got the phemes %+v, %v, want the trashed and received ones", phemes, err)
+	}
+
+	// The exports are removed after the retention.
+	if err := jobs.DeleteExports(store, -time.Minute, logging.Discard())(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	apitest.ExpectProblem(t, s.Request(alice, http.MethodGet, target, nil), http.StatusNotFound, "export_not_found")
+}
+
+func TestIntegrationRelationships(t *testing.T) {
+	s := newIntegrationServer(t)
+	alice := s.addUser("alice")
+	bob := s.addUser("bob")
+
+	res := s.Request(alice, http.MethodPost, "/api/v1/pheme", models.PhemeParamsPost{
+		Category: "test",
+		Text:     "not a friend",
+		UserID:   bob.ID,
+	})
+	apitest.ExpectProblem(t, res, http.StatusForbidden, "not_friends")
+
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodPut, fmt.Sprintf("/api/v1/user/friend/%d", bob.ID), nil), http.StatusOK)
+	apitest.ExpectStatus(t, s.Request(bob, http.MethodPut, fmt.Sprintf("/api/v1/user/friend/%d", alice.ID), nil), http.StatusOK)
+
+	s.postPheme(alice, models.PhemeParamsPost{
+		Visibilty: byte(models.PUBLIC),
+		Category:  "test",
+		Text:      "for a friend",
+		UserID:    bob.ID,
+	})
+	s.postPheme(alice, models.PhemeParamsPost{
+		Visibilty: byte(models.PUBLIC),
+		Category:  "test",
+		Text:      "mine",
+		UserID:    alice.ID,
+	})
+
+	if phemes := s.phemes(bob, "/api/v1/pheme"); len(phemes) != 2 {
+		t.Errorf("got %d phemes, want 2", len(phemes))
+	}
+
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodDelete, fmt.Sprintf("/api/v1/user/friend/%d", bob.ID), nil), http.StatusOK)
+
+	res = s.Request(alice, http.MethodPost, "/api/v1/pheme", models.PhemeParamsPost{
+		Category: "test",
+		Text:     "not a friend anymore",
+		UserID:   bob.ID,
+	})
+	apitest.ExpectProblem(t, res, http.StatusForbidden, "not_friends")
+}
+
+func TestIntegrationProblems(t *testing.T) {
+	s := newIntegrationServer(t)
+	alice := s.addUser("alice")
+
+	problem := apitest.ExpectProblem(t, s.Request(alice, http.MethodPut, "/api/v1/user/friend/99", nil), http.StatusNotFound, "not_found")
+	if problem.Instance != "/api/v1/user/friend/99" {
+		t.Errorf("got instance %q, want the path of the request", problem.Instance)
+	}
+
+	apitest.ExpectProblem(t, s.Request(alice, http.MethodDelete, fmt.Sprintf("/api/v1/user/friend/%d", alice.ID), nil), http.StatusBadRequest, "same_user")
+	apitest.ExpectProblem(t, s.Request(alice, http.MethodPatch, "/api/v1/pheme", nil), http.StatusMethodNotAllowed, "method_not_allowed")
+
+	// The database errors are not disclosed, neither answered with a 204.
+	if err := s.db.Migrator().DropTable("phemes"); err != nil {
+		t.Fatal(err)
+	}
+	problem = apitest.ExpectProblem(t, s.Request(alice, http.MethodGet, "/api/v1/pheme", nil), http.StatusInternalServerError, "internal_error")
+	if problem.Detail != "" {
+		t.Errorf("got detail %q, want none", problem.Detail)
+	}
+}
+
+func TestIntegrationIdempotency(t *testing.T) {
+	s := newIntegrationServer(t)
+	alice := s.addUser("alice")
+	bob := s.addUser("bob")
+
+	send := func(method string, target string, key string, body interface{}) *http.Response {
+		req := apitest.NewRequest(t, method, target, body)
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+alice.JWT)
+		req.Header.Set(middleware.HeaderIdempotencyKey, key)
+		return s.Do(req)
+	}
+
+	pheme := models.PhemeParamsPost{Category: "test", Text: "once", UserID: alice.ID}
+	var ids []uint
+	for i := 0; i < 2; i++ {
+		res := send(http.MethodPost, "/api/v1/pheme", "pheme", pheme)
+		apitest.ExpectStatus(t, res, http.StatusOK)
+
+		var created models.PhemeParamsID
+		apitest.Decode(t, res, &created)
+		ids = append(ids, created.ID)
+	}
+	if ids[0] != ids[1] {
+		t.Errorf("got the ids %v, want the first response replayed", ids)
+	}
+
+	var count int64
+	if err := s.db.Model(&models.Pheme{}).Count(&count).Error; err != nil || count != 1 {
+		t.Errorf("got %d phemes, %v, want 1", count, err)
+	}
+
+	// The completed key is kept for the TTL, not the lease of the request.
+	var key models.IdempotencyKey
+	if err := s.db.First(&key, "key = ?", "pheme").Error; err != nil || !key.ExpiresAt.After(time.Now().Add(time.Hour)) {
+		t.Errorf("got the key %+v, %v, want it kept for the TTL", key, err)
+	}
+
+	friend := fmt.Sprintf("/api/v1/user/friend/%d", bob.ID)
+	apitest.ExpectStatus(t, send(http.MethodPut, friend, "friend", nil), http.StatusOK)
+	res := send(http.MethodPut, friend, "friend", nil)
+	apitest.ExpectStatus(t, res, http.StatusOK)
+	if res.Header.Get(middleware.HeaderIdempotentReplayed) != "true" {
+		t.Error("the retry of the friend request was not replayed")
+	}
+	apitest.ExpectProblem(t, send(http.MethodPut, fmt.Sprintf("/api/v1/user/follower/%d", bob.ID), "friend", nil), http.StatusUnprocessableEntity, "idempotency_key_reused")
+}
+
+func TestIntegrationBatch(t *testing.T) {
+	s := newIntegrationServer(t)
+	alice := s.addUser("alice")
+	bob := s.addUser("bob")
+
+	// The atomic batch is rolled back by the pheme for a user who is not a friend.
+	res := s.Request(alice, http.MethodPost, "/api/v1/pheme/batch", models.PhemeBatchPost{
+		Phemes: []models.PhemeParamsPost{
+			{Category: "test", Text: "first", UserID: alice.ID},
+			{Category: "test", Text: "not a friend", UserID: bob.ID},
+		},
+		Atomic: true,
+	})
+	apitest.ExpectProblem(t, res, http.StatusForbidden, "not_friends")
+
+	var count int64
+	if err := s.db.Model(&models.Pheme{}).Count(&count).Error; err != nil || count != 0 {
+		t.Errorf("got %d phemes, %v, want the batch rolled back", count, err)
+	}
+
+	res = s.Request(alice, http.MethodPost, "/api/v1/user/relationships/batch", models.RelationshipBatch{
+		Operations: []models.RelationshipOperation{
+			{Action: models.ActionAdd, Relation: models.RelationFriend, UserID: bob.ID},
+			{Action: models.ActionAdd, Relation: models.RelationFollower, UserID: bob.ID},
+		},
+		Atomic: true,
+	})
+	apitest.ExpectStatus(t, res, http.StatusOK)
+
+	res = s.Request(alice, http.MethodPost, "/api/v1/pheme/batch", models.PhemeBatchPost{
+		Phemes: []models.PhemeParamsPost{
+			{Category: "test", Text: "first", UserID: alice.ID},
+			{Category: "test", Text: "for a friend", UserID: bob.ID},
+		},
+		Atomic: true,
+	})
+	apitest.ExpectStatus(t, res, http.StatusOK)
+
+	var results models.BatchResult
+	apitest.Decode(t, res, &results)
+
+	res = s.Request(alice, http.MethodGet, fmt.Sprintf("/api/v1/pheme/batch?ids=%d,%d", results.Results[0].ID, results.Results[1].ID), nil)
+	apitest.ExpectStatus(t, res, http.StatusOK)
+
+	var batch models.PhemeBatch
+	apitest.Decode(t, res, &batch)
+	if len(batch.Phemes) != 1 || batch.Phemes[0].Text != "first" || len(batch.NotFound) != 1 {
+		t.Errorf("got %+v, want only the pheme of alice visible", batch)
+	}
+}
+
+func TestIntegrationUsers(t *testing.T) {
+	s := newIntegrationServer(t)
+	alice := s.addUser("alice")
+	s.addUser("bob")
+
+	res := s.Request(alice, http.MethodGet, "/api/v1/user", nil)
+	apitest.ExpectStatus(t, res, http.StatusOK)
+
+	var user models.User
+	apitest.Decode(t, res, &user)
+	if user.ID != alice.ID {
+		t.Errorf("got user %d, want %d", user.ID, alice.ID)
+	}
+
+	res = s.Request(alice, http.MethodGet, "/api/v1/user/bo", nil)
+	apitest.ExpectStatus(t, res, http.StatusOK)
+
+	var users []models.User
+	apitest.Decode(t, res, &users)
+	if len(users) != 1 || users[0].Name != "bob" {
+		t.Errorf("got users %+v, want bob", users)
+	}
+}
+
+func TestIntegrationRoles(t *testing.T) {
+	s := newIntegrationServer(t)
+	alice := s.addUser("alice")
+	bob := s.addUser("bob")
+
+	target := fmt.Sprintf("/api/v1/admin/user/%d/role/moderator", bob.ID)
+	apitest.ExpectStatus(t, s.Request(bob, http.MethodPut, target, nil), http.StatusForbidden)
+
+	role := models.UserRole{UserID: alice.ID, Role: models.RoleAdmin, GrantedBy: alice.ID, CreatedAt: time.Now()}
+	if err := s.db.Create(&role).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodPut, target, nil), http.StatusOK)
+
+	id := s.postPheme(alice, models.PhemeParamsPost{
+		Category: "test",
+		Text:     "moderated",
+		UserID:   alice.ID,
+	})
+	apitest.ExpectStatus(t, s.Request(bob, http.MethodDelete, fmt.Sprintf("/api/v1/pheme/%d", id), nil), http.StatusOK)
+
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodDelete, target, nil), http.StatusOK)
+}
+
+func TestIntegrationTokens(t *testing.T) {
+	s := newIntegrationServer(t)
+	alice := s.addUser("alice")
+
+	res := s.Request(alice, http.MethodPost, "/api/v1/user/tokens", models.TokenParamsNew{
+		Name:   "read only",
+		Scopes: []string{string(models.PermissionPhemesRead)},
+	})
+	apitest.ExpectStatus(t, res, http.StatusOK)
+
+	var created models.TokenCreated
+	apitest.Decode(t, res, &created)
+
+	apitest.ExpectStatus(t, s.Bearer(created.Token, http.MethodGet, "/api/v1/pheme", nil), http.StatusOK)
+	apitest.ExpectStatus(t, s.Bearer(created.Token, http.MethodPost, "/api/v1/pheme", models.PhemeParamsPost{
+		Category: "test",
+		Text:     "out of scope",
+		UserID:   alice.ID,
+	}), http.StatusForbidden)
+
+	res = s.Request(alice, http.MethodGet, "/api/v1/user/tokens", nil)
+	apitest.ExpectStatus(t, res, http.StatusOK)
+
+	var tokens []models.PersonalAccessToken
+	apitest.Decode(t, res, &tokens)
+	if len(tokens) != 1 || tokens[0].LastUsedAt == nil || len(tokens[0].Scopes) != 1 {
+		t.Errorf("got tokens %+v, want one used token", tokens)
+	}
+
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodDelete, fmt.Sprintf("/api/v1/user/tokens/%d", created.ID), nil), http.StatusOK)
+	apitest.ExpectStatus(t, s.Bearer(created.Token, http.MethodGet, "/api/v1/pheme", nil), http.StatusUnauthorized)
+}
+
+func TestIntegrationHealth(t *testing.T) {
+	s := newIntegrationServer(t)
+
+	apitest.ExpectStatus(t, s.Do(apitest.NewRequest(t, http.MethodGet, "/healthz", nil)), http.StatusOK)
+	apitest.ExpectStatus(t, s.Do(apitest.NewRequest(t, http.MethodGet, "/readyz", nil)), http.StatusOK)
+
+	if err := migrate(s.db, []string{"down", "1"}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	res := s.Do(apitest.NewRequest(t, http.MethodGet, "/readyz", nil))
+	apitest.ExpectStatus(t, res, http.StatusServiceUnavailable)
+
+	var body struct {
+		Checks map[string]string `json:"checks"`
+	}
+	apitest.Decode(t, res, &body)
+	if _, ok := body.Checks["migrations"]; !ok || len(body.Checks) != 1 {
+		t.Errorf("got failed checks %v, want the migrations", body.Checks)
+	}
+
+	if err := migrate(s.db, []string{"up"}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	apitest.ExpectStatus(t, s.Do(apitest.NewRequest(t, http.MethodGet, "/readyz", nil)), http.StatusOK)
+
+	s.health.Drain()
+	apitest.ExpectStatus(t, s.Do(apitest.NewRequest(t, http.MethodGet, "/readyz", nil)), http.StatusServiceUnavailable)
+	apitest.ExpectStatus(t, s.Do(apitest.NewRequest(t, http.MethodGet, "/healthz", nil)), http.StatusOK)
+}
+
+func TestIntegrationMetrics(t *testing.T) {
+	s := newIntegrationServer(t)
+	alice := s.addUser("alice")
+	bob := s.addUser("bob")
+
+	for i := 0; i < 2; i++ {
+		id := s.postPheme(alice, models.PhemeParamsPost{
+			Visibilty: byte(models.PUBLIC),
+			Category:  "test",
+			Text:      "counted",
+			UserID:    alice.ID,
+		})
+		apitest.ExpectStatus(t, s.Request(alice, http.MethodGet, fmt.Sprintf("/api/v1/pheme/%d", id), nil), http.StatusOK)
+	}
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodDelete, "/api/v1/pheme/1", nil), http.StatusOK)
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodPut, fmt.Sprintf("/api/v1/user/friend/%d", bob.ID), nil), http.StatusOK)
+	apitest.ExpectStatus(t, s.Do(apitest.NewRequest(t, http.MethodGet, "/unknown/1", nil)), http.StatusNotFound)
+	apitest.ExpectStatus(t, s.Do(apitest.NewRequest(t, http.MethodGet, "/api/v1/pheme/3", nil)), http.StatusUnauthorized)
+
+	res := s.Do(apitest.NewRequest(t, http.MethodGet, "/metrics", nil))
+	apitest.ExpectStatus(t, res, http.StatusOK)
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{
+		`pheme_http_requests_total{method="GET",route="/api/v1/pheme/:id<int>",status="200"} 2`,
+		`pheme_http_requests_total{method="POST",route="/api/v1/pheme",status="200"} 2`,
+		`pheme_phemes_created_total 2`,
+		`pheme_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`pheme_http_requests_total{method="GET",route="/api/v1/pheme",status="401"} 1`,
+		`pheme_phemes_deleted_total 1`,
+		`pheme_relationships_added_total{kind="friend"} 1`,
+		`pheme_db_query_duration_seconds_count{operation="create",table="phemes"} 2`,
+		`go_sql_max_open_connections{db_name="sqlite"} 1`,
+	} {
+		if !strings.Contains(string(body), line) {
+			t.Errorf("missing metric %s", line)
+		}
+	}
+}
+
+func TestIntegrationProxyIP(t *testing.T) {
+	cfg := config.Default()
+	cfg.RateLimit.IP = "2/1m"
+	cfg.Server.ProxyHeader = fiber.HeaderXForwardedFor
+	// The address of the connections of app.Test.
+	cfg.Server.TrustedProxies = []string{"0.0.0.0"}
+	s := newConfiguredIntegrationServer(t, cfg, notify.NewMemory(), logging.Discard(), trace.NewNoopTracerProvider())
+
+	request := func(forwardedFor string) *http.Response {
+		req := apitest.NewRequest(t, http.MethodGet, "/api/v1/pheme", nil)
+		req.Header.Set(fiber.HeaderXForwardedFor, forwardedFor)
+		return s.Do(req)
+	}
+
+	for i := 0; i < 2; i++ {
+		apitest.ExpectStatus(t, request("203.0.113.1"), http.StatusUnauthorized)
+	}
+	apitest.ExpectProblem(t, request("203.0.113.1"), http.StatusTooManyRequests, "rate_limited")
+
+	// The clients behind the proxy have buckets of their own.
+	apitest.ExpectStatus(t, request("198.51.100.7"), http.StatusUnauthorized)
+
+	// The addresses sent by the client before the one seen by the proxy are
+	// ignored.
+	apitest.ExpectProblem(t, request("192.0.2.9, 203.0.113.1"), http.StatusTooManyRequests, "rate_limited")
+}
+
+func TestIntegrationRequestID(t *testing.T) {
+	var logs bytes.Buffer
+	logger, err := logging.New(&logs, "info", logging.FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newObservedIntegrationServer(t, logger, trace.NewNoopTracerProvider())
+	alice := s.addUser("alice")
+
+	req := apitest.NewRequest(t, http.MethodGet, "/api/v1/pheme/1", nil)
+	req.AddCookie(&http.Cookie{Name: "jwt", Value: alice.JWT})
+	req.Header.Set("X-Request-ID", "trace-1")
+	res := s.Do(req)
+	apitest.ExpectProblem(t, res, http.StatusNotFound, "pheme_not_found")
+	if id := res.Header.Get("X-Request-ID"); id != "trace-1" {
+		t.Errorf("got request ID %q, want the one of the request", id)
+	}
+
+	// The failed request is logged once, by the access log, with its error.
+	if !strings.Contains(logs.String(), `"msg":"request",`) || !strings.Contains(logs.String(), `"error":"The pheme doesn't exist`) {
+		t.Errorf("missing the request log with its error in:\n%s", logs.String())
+	}
+	if count := strings.Count(logs.String(), `"request_id":"trace-1"`); count != 1 {
+		t.Errorf("got %d logs with the request ID, want 1:\n%s", count, logs.String())
+	}
+
+	req = apitest.NewRequest(t, http.MethodGet, "/api/v1/pheme/1", nil)
+	req.Header.Set("X-Request-ID", "not valid\n")
+	res = s.Do(req)
+	if id := res.Header.Get("X-Request-ID"); id == "" || strings.ContainsAny(id, " \n") {
+		t.Errorf("got request ID %q, want a generated one", id)
+	}
+}
+
+func TestIntegrationTracing(t *testing.T) {
+	var out bytes.Buffer
+	tracer, flush, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    tracing.ExporterStdout,
+		ServiceName: "pheme-user",
+	}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newObservedIntegrationServer(t, logging.Discard(), tracer)
+	alice := s.addUser("alice")
+
+	const traceID, parentID = "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	req := apitest.NewRequest(t, http.MethodGet, "/api/v1/pheme/mine", nil)
+	req.AddCookie(&http.Cookie{Name: "jwt", Value: alice.JWT})
+	req.Header.Set("traceparent", "00-"+traceID+"-"+parentID+"-01")
+	apitest.ExpectStatus(t, s.Do(req), http.StatusOK)
+
+	if err := flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	type spanContext struct {
+		TraceID string
+		SpanID  string
+	}
+	spans := map[string]spanContext{}
+	parents := map[string]string{}
+	decoder := json.NewDecoder(&out)
+	for decoder.More() {
+		var span struct {
+			Name        string
+			SpanContext spanContext
+			Parent      spanContext
+		}
+		if err := decoder.Decode(&span); err != nil {
+			t.Fatal(err)
+		}
+		// The users are inserted out of the request, in their own traces.
+		if span.SpanContext.TraceID != traceID {
+			continue
+		}
+		spans[span.Name] = span.SpanContext
+		parents[span.Name] = span.Parent.SpanID
+	}
+
+	request, ok := spans["GET /api/v1/pheme/mine"]
+	if !ok || parents["GET /api/v1/pheme/mine"] != parentID {
+		t.Fatalf("got spans %v, want the request span child of the traceparent", spans)
+	}
+	if _, ok := spans["gorm.query"]; !ok || parents["gorm.query"] != request.SpanID {
+		t.Errorf("got spans %v, want the queries children of the request span", parents)
+	}
+}
+
+// recordingPubSub is the in-memory pub/sub keeping the published messages.
+type recordingPubSub struct {
+	*notify.Memory
+
+	mu       sync.Mutex
+	messages [][]byte
+}
+
+func (p *recordingPubSub) Publish(ctx context.Context, topic string, message []byte) error {
+	p.mu.Lock()
+	p.messages = append(p.messages, message)
+	p.mu.Unlock()
+
+	return p.Memory.Publish(ctx, topic, message)
+}
+
+func TestIntegrationPubSub(t *testing.T) {
+	pubsub := &recordingPubSub{Memory: notify.NewMemory()}
+	s := newConfiguredIntegrationServer(t, config.Default(), pubsub, logging.Discard(), trace.NewNoopTracerProvider())
+	alice := s.addUser("alice")
+	bob := s.addUser("bob")
+
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodPut, fmt.Sprintf("/api/v1/user/follower/%d", bob.ID), nil), http.StatusOK)
+
+	pubsub.mu.Lock()
+	defer pubsub.mu.Unlock()
+
+	if len(pubsub.messages) != 1 {
+		t.Fatalf("got %d notifications published, want 1", len(pubsub.messages))
+	}
+
+	var notification models.Notification
+	if err := json.Unmarshal(pubsub.messages[0], &notification); err != nil || notification.Type != models.NotificationFollow || notification.ActorID != alice.ID {
+		t.Errorf("got the notification %+v, %v, want the follow of alice", notification, err)
+	}
+}
+
+func TestMigrateCommand(t *testing.T) {
+	db, err := database.Open(database.Config{
+		DSN: "sqlite:" + filepath.Join(t.TempDir(), "pheme.db"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	if err := migrate(db, []string{"up"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "applied 0001 create_users") {
+		t.Errorf("unexpected up output:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := migrate(db, []string{"down", "2"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(out.String(), "rolled back") != 2 {
+		t.Errorf("unexpected down output:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := migrate(db, []string{"status"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "pending") || !strings.Contains(out.String(), "applied") {
+		t.Errorf("unexpected status output:\n%s", out.String())
+	}
+
+	for _, args := range [][]string{nil, {"sideways"}, {"down", "-1"}} {
+		if err := migrate(db, args, &out); err == nil {
+			t.Errorf("expected an error for %v", args)
+		}
+	}
+}
+
+func TestImportCommand(t *testing.T) {
+	s := newIntegrationServer(t)
+	alice := s.addUser("alice")
+
+	archive := filepath.Join(t.TempDir(), "tweets.js")
+	content := `window.YTD.tweets.part0 = [
+  {"tweet": {"id_str": "1", "created_at": "Wed Oct 10 20:19:24 +0000 2018", "full_text": "hello #intro", "entities": {"hashtags": [{"text": "intro"}]}}},
+  {"tweet": {"id_str": "2", "created_at": "Wed Oct 10 21:19:24 +0000 2018", "full_text": "again", "entities": {"hashtags": []}}},
+  {"tweet": {"created_at": "Wed Oct 10 22:19:24 +0000 2018", "full_text": "no ID"}}
+]`
+	if err := os.WriteFile(archive, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{"-user", fmt.Sprint(alice.ID), "-format", "twitter", "-categories", "intro=Introductions", archive}
+
+	var out strings.Builder
+	if err := importPhemes(s.db, args, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "line 3: invalid_fields") || !strings.Contains(out.String(), "imported 2, duplicates 0, failed 1") {
+		t.Errorf("unexpected import output:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := importPhemes(s.db, args, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "imported 0, duplicates 2, failed 1") {
+		t.Errorf("unexpected output importing again:\n%s", out.String())
+	}
+
+	phemes := s.phemes(alice, "/api/v1/pheme/mine")
+	if len(phemes) != 2 || phemes[1].Category != "Introductions" || phemes[1].CreatedAt.Year() != 2018 {
+		t.Errorf("got %+v, want the imported tweets", phemes)
+	}
+
+	for _, args := range [][]string{nil, {"-user", "1"}, {"-user", "99", "-format", "jsonl", archive}, {"-user", "1", "-format", "csv", archive}} {
+		if err := importPhemes(s.db, args, io.Discard); err == nil {
+			t.Errorf("expected an error for %v", args)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/feserr/pheme-user/models"
+	"golang.org/x/exp/slog"
+)
+
+// accountDeletionBatch is the number of accounts deleted at once.
+const accountDeletionBatch = 100
+
+// DeleteAccounts returns the job deleting the accounts whose grace period is
+// over. The accounts that fail to be deleted are logged and retried in the
+// next run.
+func DeleteAccounts(deletions models.AccountDeletionRepository, users models.UserRepository, logger *slog.Logger) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		for {
+			due, err := deletions.DueAccountDeletions(ctx, time.Now(), accountDeletionBatch)
+			if err != nil {
+				return err
+			}
+
+			failed := 0
+			for _, deletion := range due {
+				if err := users.DeleteByID(ctx, deletion.UserID); err != nil {
+					logger.ErrorCtx(ctx, "failed to delete an account", "user", deletion.UserID, "error", err)
+					failed++
+					continue
+				}
+
+				logger.InfoCtx(ctx, "account deleted", "user", deletion.UserID)
+			}
+
+			// The failed deletions are due again, stop instead of retrying them.
+			if len(due) < accountDeletionBatch || failed > 0 {
+				return nil
+			}
+		}
+	}
+}
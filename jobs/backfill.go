@@ -0,0 +1,30 @@
+// Package jobs background jobs of the service
+package jobs
+
+import (
+	"context"
+
+	"github.com/feserr/pheme-user/models"
+	"golang.org/x/exp/slog"
+)
+
+// backfillBatchSize is the number of records upgraded in each transaction.
+const backfillBatchSize = 500
+
+// Backfill upgrades all the users and phemes written with an older version of
+// the schema, reporting the progress after each batch.
+func Backfill(ctx context.Context, store models.Backfiller, report func(models.BackfillProgress)) error {
+	if err := store.BackfillUsers(ctx, backfillBatchSize, report); err != nil {
+		return err
+	}
+
+	return store.BackfillPhemes(ctx, backfillBatchSize, report)
+}
+
+// LogProgress returns the report of the progress of a backfill in the log.
+func LogProgress(logger *slog.Logger) func(models.BackfillProgress) {
+	return func(progress models.BackfillProgress) {
+		logger.Info("backfill progress", "table", progress.Table, "done", progress.Done,
+			"total", progress.Total, "upgraded", progress.Upgraded, "failed", progress.Failed)
+	}
+}
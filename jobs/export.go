@@ -0,0 +1,210 @@
+package jobs
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"html/template"
+	"io"
+	"time"
+
+	"github.com/feserr/pheme-user/models"
+	"golang.org/x/exp/slog"
+)
+
+// exportBatch is the number of pending exports built in each run.
+const exportBatch = 10
+
+// exportClaimTimeout is the time after which a running export is considered
+// lost, e.g. with its replica stopped, and claimed again.
+const exportClaimTimeout = 10 * time.Minute
+
+// exportIndex is the human-readable page of an export.
+var exportIndex = template.Must(template.New("index.html").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Pheme data of {{.User.Name}}</title>
+</head>
+<body>
+<h1>Pheme data of {{.User.Name}}</h1>
+<p>Exported at {{.ExportedAt.Format "2006-01-02 15:04:05 MST"}}.</p>
+
+<h2>Profile</h2>
+<ul>
+<li>ID: {{.User.ID}}</li>
+<li>Name: {{.User.Name}}</li>
+<li>Email: {{.User.Email}}</li>
+<li>Created at: {{.User.CreatedAt.Format "2006-01-02 15:04:05 MST"}}</li>
+{{- range .User.Roles}}
+<li>Role: {{.Role}}</li>
+{{- end}}
+</ul>
+<p>Data: <a href="profile.json">profile.json</a></p>
+
+<h2>Phemes</h2>
+<p>{{len .Phemes}} phemes authored or received. Data: <a href="phemes.json">phemes.json</a></p>
+<table>
+<tr><th>ID</th><th>Created at</th><th>From</th><th>To</th><th>Category</th><th>Text</th><th>Deleted</th></tr>
+{{- range .Phemes}}
+<tr><td>{{.ID}}</td><td>{{.CreatedAt.Format "2006-01-02 15:04:05"}}</td><td>{{.CreatedBy}}</td><td>{{.UserID}}</td><td>{{.Category}}</td><td>{{.Text}}</td><td>{{if .DeletedAt.Valid}}yes{{end}}</td></tr>
+{{- end}}
+</table>
+
+<h2>Relationships</h2>
+<ul>
+<li>Friends: {{range $i, $id := .Friends}}{{if $i}}, {{end}}{{$id}}{{else}}none{{end}}</li>
+<li>Followers: {{range $i, $id := .Followers}}{{if $i}}, {{end}}{{$id}}{{else}}none{{end}}</li>
+</ul>
+<p>Data: <a href="relationships.json">relationships.json</a></p>
+
+<h2>Personal access tokens</h2>
+<ul>
+{{- range .Tokens}}
+<li>{{.Name}} ({{.Prefix}}…), created at {{.CreatedAt.Format "2006-01-02 15:04:05 MST"}}</li>
+{{- else}}
+<li>none</li>
+{{- end}}
+</ul>
+<p>Data: <a href="tokens.json">tokens.json</a></p>
+</body>
+</html>
+`))
+
+// BuildExports returns the job building the archives of the pending exports.
+// The exports are claimed before they are built, so every export is built by
+// a single replica at once: the build of an export claimed again, after it ran
+// for too long, is dropped. The exports that fail are marked as failed, the user has
+// to request a new one.
+func BuildExports(exports models.ExportRepository, users models.UserRepository, phemes models.PhemeRepository, tokens models.TokenRepository, logger *slog.Logger) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		for {
+			now := time.Now()
+			pending, err := exports.ClaimExports(ctx, now, now.Add(-exportClaimTimeout), exportBatch)
+			if err != nil {
+				return err
+			}
+
+			for _, export := range pending {
+				var archive bytes.Buffer
+				data, err := CollectExportData(ctx, users, phemes, tokens, export.UserID)
+				if err == nil {
+					err = WriteExport(&archive, data)
+				}
+
+				completedAt := time.Now()
+				export.CompletedAt = &completedAt
+				export.Status = models.ExportReady
+				export.Archive = archive.Bytes()
+				export.Size = int64(archive.Len())
+				if err != nil {
+					logger.Error("failed to build an export", "export", export.ID, "user", export.UserID, "error", err)
+					export.Status = models.ExportFailed
+					export.Archive = nil
+					export.Size = 0
+				}
+
+				completed, err := exports.CompleteExport(ctx, export)
+				if err != nil {
+					return err
+				}
+
+				if !completed {
+					logger.Warn("export claimed again during its build, dropped", "export", export.ID, "user", export.UserID)
+					continue
+				}
+
+				logger.Info("export built", "export", export.ID, "user", export.UserID, "status", export.Status, "size", export.Size)
+			}
+
+			if len(pending) < exportBatch {
+				return nil
+			}
+		}
+	}
+}
+
+// DeleteExports returns the job removing the exports older than the retention.
+func DeleteExports(exports models.ExportRepository, retention time.Duration, logger *slog.Logger) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		deleted, err := exports.DeleteExports(ctx, time.Now().Add(-retention))
+		if err != nil {
+			return err
+		}
+
+		if deleted > 0 {
+			logger.Info("old exports removed", "deleted", deleted)
+		}
+
+		return nil
+	}
+}
+
+// CollectExportData returns all the data of a user: its profile, phemes
+// authored and received, relationships and tokens.
+func CollectExportData(ctx context.Context, users models.UserRepository, phemes models.PhemeRepository, tokens models.TokenRepository, userID uint) (models.ExportData, error) {
+	data := models.ExportData{ExportedAt: time.Now()}
+
+	var err error
+	if data.User, err = users.FindAuthUser(ctx, userID); err != nil {
+		return data, err
+	}
+
+	if data.Phemes, err = phemes.FetchPersonalPhemes(ctx, userID); err != nil {
+		return data, err
+	}
+
+	if data.Friends, err = users.GetFriends(ctx, userID); err != nil {
+		return data, err
+	}
+
+	if data.Followers, err = users.GetFollowers(ctx, userID); err != nil {
+		return data, err
+	}
+
+	if data.Tokens, err = tokens.FetchTokens(ctx, userID); err != nil {
+		return data, err
+	}
+
+	return data, nil
+}
+
+// WriteExport writes the ZIP archive of the data of a user: a JSON file by
+// kind of data and an HTML index to read them.
+func WriteExport(w io.Writer, data models.ExportData) error {
+	archive := zip.NewWriter(w)
+
+	files := []struct {
+		name    string
+		content interface{}
+	}{
+		{"profile.json", data.User},
+		{"phemes.json", data.Phemes},
+		{"relationships.json", map[string][]uint{"friends": data.Friends, "followers": data.Followers}},
+		{"tokens.json", data.Tokens},
+	}
+	for _, file := range files {
+		f, err := archive.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: data.ExportedAt})
+		if err != nil {
+			return err
+		}
+
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.content); err != nil {
+			return err
+		}
+	}
+
+	f, err := archive.CreateHeader(&zip.FileHeader{Name: "index.html", Method: zip.Deflate, Modified: data.ExportedAt})
+	if err != nil {
+		return err
+	}
+
+	if err := exportIndex.Execute(f, data); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
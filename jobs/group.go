@@ -0,0 +1,77 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// Group runs the background jobs of the service until it is stopped.
+type Group struct {
+	logger *slog.Logger
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewGroup returns an empty group of jobs logging their errors.
+func NewGroup(logger *slog.Logger) *Group {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Group{logger: logger, ctx: ctx, cancel: cancel}
+}
+
+// Go runs the job in the background, its context is canceled when the group
+// is stopped. The errors, besides the cancellation, are logged.
+func (g *Group) Go(name string, job func(ctx context.Context) error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+
+		if err := job(g.ctx); err != nil && !errors.Is(err, context.Canceled) {
+			g.logger.Error("background job failed", "job", name, "error", err)
+		}
+	}()
+}
+
+// Every runs the job in the background at every interval, until the group is
+// stopped. The errors are logged and the job runs again at the next interval.
+func (g *Group) Every(name string, interval time.Duration, job func(ctx context.Context) error) {
+	g.Go(name, func(ctx context.Context) error {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-ticker.C:
+			}
+
+			if err := job(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				g.logger.Error("background job failed", "job", name, "error", err)
+			}
+		}
+	})
+}
+
+// Stop cancels the jobs and waits for them to return, until the context is done.
+func (g *Group) Stop(ctx context.Context) error {
+	g.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for the background jobs: %w", ctx.Err())
+	}
+}
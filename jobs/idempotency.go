@@ -0,0 +1,25 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/feserr/pheme-user/models"
+	"golang.org/x/exp/slog"
+)
+
+// ExpireIdempotencyKeys returns the job removing the expired idempotency keys.
+func ExpireIdempotencyKeys(keys models.IdempotencyRepository, logger *slog.Logger) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		deleted, err := keys.DeleteExpiredIdempotencyKeys(ctx, time.Now())
+		if err != nil {
+			return err
+		}
+
+		if deleted > 0 {
+			logger.Info("expired idempotency keys removed", "deleted", deleted)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,26 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/feserr/pheme-user/models"
+	"golang.org/x/exp/slog"
+)
+
+// PurgeTrash returns the job removing for good the phemes trashed for longer
+// than the retention.
+func PurgeTrash(phemes models.PhemeRepository, retention time.Duration, logger *slog.Logger) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		purged, err := phemes.PurgeTrash(ctx, time.Now().Add(-retention))
+		if err != nil {
+			return err
+		}
+
+		if purged > 0 {
+			logger.Info("trashed phemes purged", "purged", purged)
+		}
+
+		return nil
+	}
+}
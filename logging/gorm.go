@@ -0,0 +1,79 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/exp/slog"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// Gorm logs the queries of GORM with the request ID of their context. The slow
+// queries are warnings, the rest, failed ones included, are debug records:
+// their errors are logged by the callers.
+type Gorm struct {
+	logger *slog.Logger
+	slow   time.Duration
+	level  gormlogger.LogLevel
+}
+
+// NewGorm returns the GORM logger warning about the queries slower than slow,
+// never when it is 0.
+func NewGorm(logger *slog.Logger, slow time.Duration) *Gorm {
+	return &Gorm{logger: logger, slow: slow, level: gormlogger.Info}
+}
+
+// LogMode returns a copy of the logger with the GORM level.
+func (g *Gorm) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	copied := *g
+	copied.level = level
+	return &copied
+}
+
+// Info logs a message of GORM.
+func (g *Gorm) Info(ctx context.Context, msg string, data ...interface{}) {
+	if g.level >= gormlogger.Info {
+		g.logger.InfoCtx(ctx, fmt.Sprintf(msg, data...))
+	}
+}
+
+// Warn logs a warning of GORM.
+func (g *Gorm) Warn(ctx context.Context, msg string, data ...interface{}) {
+	if g.level >= gormlogger.Warn {
+		g.logger.WarnCtx(ctx, fmt.Sprintf(msg, data...))
+	}
+}
+
+// Error logs an error of GORM.
+func (g *Gorm) Error(ctx context.Context, msg string, data ...interface{}) {
+	if g.level >= gormlogger.Error {
+		g.logger.ErrorCtx(ctx, fmt.Sprintf(msg, data...))
+	}
+}
+
+// Trace logs a query.
+func (g *Gorm) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if g.level <= gormlogger.Silent {
+		return
+	}
+
+	elapsed := time.Since(begin)
+	slow := g.slow > 0 && elapsed > g.slow
+	if !slow && !g.logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+
+	sql, rows := fc()
+	args := []any{"sql", sql, "rows", rows, "elapsed", elapsed}
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		g.logger.DebugCtx(ctx, "query failed", append(args, "error", err)...)
+	case slow && g.level >= gormlogger.Warn:
+		g.logger.WarnCtx(ctx, "slow query", args...)
+	default:
+		g.logger.DebugCtx(ctx, "query", args...)
+	}
+}
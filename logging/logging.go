@@ -0,0 +1,91 @@
+// Package logging structured logs of the service
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/exp/slog"
+)
+
+// Formats of the logs.
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// requestIDKey is the context key of the request ID.
+type requestIDKey struct{}
+
+// New returns a logger writing the records of the level, or higher, in the
+// format. The records logged with a request context have its request ID.
+func New(w io.Writer, level string, format string) (*slog.Logger, error) {
+	parsed, err := ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+
+	options := slog.HandlerOptions{Level: parsed}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case FormatJSON:
+		handler = options.NewJSONHandler(w)
+	case FormatText:
+		handler = options.NewTextHandler(w)
+	default:
+		return nil, fmt.Errorf("unknown log format %q, must be json or text", format)
+	}
+
+	return slog.New(contextHandler{handler}), nil
+}
+
+// Discard returns a logger that drops every record.
+func Discard() *slog.Logger {
+	return slog.New(slog.HandlerOptions{Level: slog.LevelError + 1}.NewTextHandler(io.Discard))
+}
+
+// ParseLevel returns the level from its name: debug, info, warn or error.
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return level, fmt.Errorf("unknown log level %q, must be debug, info, warn or error", name)
+	}
+
+	return level, nil
+}
+
+// WithRequestID returns the context of the request with the ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the ID of the request of the context, empty if there is none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// contextHandler adds the request ID of the context to the records.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if ctx != nil {
+		if id := RequestID(ctx); id != "" {
+			record.AddAttrs(slog.String("request_id", id))
+		}
+	}
+
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
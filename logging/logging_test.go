@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := New(&out, "info", FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger.DebugCtx(context.Background(), "hidden")
+	logger.InfoCtx(WithRequestID(context.Background(), "abc-123"), "shown", "user", 1)
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatalf("got %q, want a single JSON record: %v", out.String(), err)
+	}
+	if record["msg"] != "shown" || record["request_id"] != "abc-123" || record["user"] != 1.0 {
+		t.Errorf("got record %v", record)
+	}
+
+	out.Reset()
+	logger, err = New(&out, "debug", FormatText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.With("job", "backfill").DebugCtx(WithRequestID(context.Background(), "abc-123"), "shown")
+	if line := out.String(); !strings.Contains(line, "job=backfill") || !strings.Contains(line, "request_id=abc-123") {
+		t.Errorf("got %q", line)
+	}
+
+	if _, err := New(&out, "verbose", FormatJSON); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+	if _, err := New(&out, "info", "xml"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestGorm(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := New(&out, "warn", FormatText)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queries := NewGorm(logger, 100*time.Millisecond)
+	ctx := WithRequestID(context.Background(), "abc-123")
+	query := func() (string, int64) { return "SELECT 1", 1 }
+
+	queries.Trace(ctx, time.Now(), query, nil)
+	queries.Trace(ctx, time.Now(), query, errors.New("failed"))
+	if out.Len() != 0 {
+		t.Errorf("got %q, want the fast queries and their errors at the debug level", out.String())
+	}
+
+	queries.Trace(ctx, time.Now().Add(-time.Second), query, nil)
+	if line := out.String(); !strings.Contains(line, "slow query") || !strings.Contains(line, "request_id=abc-123") {
+		t.Errorf("got %q, want a slow query warning", line)
+	}
+}
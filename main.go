@@ -1,14 +1,40 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/feserr/pheme-user/auth"
+	"github.com/feserr/pheme-user/config"
+	"github.com/feserr/pheme-user/controllers"
+	"github.com/feserr/pheme-user/database"
 	_ "github.com/feserr/pheme-user/docs"
+	"github.com/feserr/pheme-user/events"
+	"github.com/feserr/pheme-user/jobs"
+	"github.com/feserr/pheme-user/logging"
+	"github.com/feserr/pheme-user/metrics"
+	"github.com/feserr/pheme-user/middleware"
+	"github.com/feserr/pheme-user/migrations"
+	"github.com/feserr/pheme-user/models"
+	"github.com/feserr/pheme-user/notify"
+	"github.com/feserr/pheme-user/problem"
+	"github.com/feserr/pheme-user/ratelimit"
+	"github.com/feserr/pheme-user/repository"
 	"github.com/feserr/pheme-user/routes"
+	"github.com/feserr/pheme-user/tracing"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	fiberSwagger "github.com/swaggo/fiber-swagger"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/exp/slog"
+	"gorm.io/gorm"
 )
 
 // @title Pheme users
@@ -23,24 +49,285 @@ import (
 
 // @BasePath /api/
 func main() {
+	cfg, args, err := config.Load(os.Args[1:], os.Stderr)
+	if len(args) > 0 && args[0] == "config" {
+		if err := cfg.Print(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if len(args) > 0 && args[0] == "config" {
+		return
+	}
+
+	logger, err := logging.New(os.Stderr, cfg.Log.Level, cfg.Log.Format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+
+	connection := cfg.Database.Connection()
+	connection.Logger = logging.NewGorm(logger, cfg.Log.SlowQuery)
+	db, err := database.Open(connection)
+	if err != nil {
+		panic("Couldn't connect to the database: " + err.Error())
+	}
+
+	if len(args) > 0 && args[0] == "migrate" {
+		if err := migrate(db, args[1:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	if len(args) > 0 && args[0] == "import" {
+		if err := importPhemes(db, args[1:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	if len(args) > 0 && args[0] == "backfill" {
+		if err := jobs.Backfill(context.Background(), repository.NewGorm(db), jobs.LogProgress(logger)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	verifier, err := auth.NewVerifier(cfg.JWT.Verification())
+	if err != nil {
+		panic("Couldn't configure the JWT verification: " + err.Error())
+	}
+
+	tracer, flushTraces, err := tracing.Setup(context.Background(), cfg.Tracing.Traces(), os.Stdout)
+	if err != nil {
+		panic("Couldn't configure the tracing: " + err.Error())
+	}
+
+	// The in-memory pub/sub only reaches the users connected to this replica,
+	// a shared one, e.g. Redis, reaches them all.
+	app, health, service, err := newApp(cfg, db, verifier, notify.NewMemory(), logger, tracer)
+	if err != nil {
+		panic("Couldn't migrate DB: " + err.Error())
+	}
+
+	store := repository.NewGorm(db)
+	background := jobs.NewGroup(logger)
+	background.Go("notifications", service.Notifications.Run)
+	background.Every("idempotency keys", time.Hour, jobs.ExpireIdempotencyKeys(store, logger))
+	background.Every("trash", time.Hour, jobs.PurgeTrash(store, cfg.Limits.TrashRetention, logger))
+	// The accounts are deleted through the cached users, so this replica stops
+	// authenticating them at once, the others after LIMITS_USER_CACHE_TTL.
+	background.Every("account deletions", time.Hour, jobs.DeleteAccounts(store, service.Users, logger))
+	background.Every("exports", 10*time.Second, jobs.BuildExports(store, store, store, store, logger))
+	background.Every("old exports", time.Hour, jobs.DeleteExports(store, cfg.Limits.ExportRetention, logger))
+	if cfg.Features.UpgradeBackfill {
+		background.Go("backfill", func(ctx context.Context) error {
+			return jobs.Backfill(ctx, store, jobs.LogProgress(logger))
+		})
+	}
+
+	closeDB := func(context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+
+		return sqlDB.Close()
+	}
+
+	if err := serve(app, cfg.Server, health, logger, background.Stop, flushTraces, closeDB); err != nil {
+		logger.Error("failed to serve", "error", err)
+		os.Exit(1)
+	}
+}
+
+// serve listens until a SIGINT or SIGTERM, then stops accepting connections,
+// waits for the in-flight requests and runs the cleanups in order, all within
+// the shutdown timeout.
+func serve(app *fiber.App, server config.Server, health *controllers.Health, logger *slog.Logger, cleanups ...func(context.Context) error) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	listened := make(chan error, 1)
+	go func() {
+		listened <- app.Listen(server.Address())
+	}()
+
+	select {
+	case err := <-listened:
+		return err
+	case <-ctx.Done():
+	}
+	stop()
+
+	logger.Info("shutting down", "timeout", server.ShutdownTimeout)
+	health.Drain()
+	ctx, cancel := context.WithTimeout(context.Background(), server.ShutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- app.Shutdown()
+	}()
+	select {
+	case err := <-shutdown:
+		if err != nil {
+			errs = append(errs, err)
+		}
+	case <-ctx.Done():
+		errs = append(errs, errors.New("timeout waiting for the in-flight requests"))
+	}
+
+	for _, cleanup := range cleanups {
+		if err := cleanup(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("shutdown: %v", errs)
+	}
+
+	return nil
+}
+
+// newApp returns the app of the service storing the models in the database,
+// after applying its pending migrations, its health probes and the service
+// shared with the background jobs, which must run its notifications hub. The
+// hub carries the notifications between the replicas through the pub/sub.
+func newApp(cfg config.Config, db *gorm.DB, verifier *auth.Verifier, pubsub notify.PubSub, logger *slog.Logger, tracer trace.TracerProvider) (*fiber.App, *controllers.Health, *controllers.Service, error) {
+	migrator, err := migrations.New(db)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if _, err := migrator.Up(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	models.SetAdminEmails(cfg.Admin.Emails)
+
 	app := fiber.New(fiber.Config{
 		Prefork:       false,
 		CaseSensitive: true,
 		StrictRouting: true,
 		ServerHeader:  "Fiber",
 		AppName:       "Pheme users v1.0.0",
+		BodyLimit:     cfg.Limits.BodyLimit,
+		ReadTimeout:   cfg.Server.ReadTimeout,
+		WriteTimeout:  cfg.Server.WriteTimeout,
+		ErrorHandler:  problem.Handler,
+		// The client IP is only read from the header of the trusted proxies.
+		ProxyHeader:             cfg.Server.ProxyHeader,
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          cfg.Server.TrustedProxies,
 	})
 
-	app.Get("/swagger/*", fiberSwagger.WrapHandler)
+	appMetrics := metrics.New()
+	if cfg.Features.Metrics {
+		if err := appMetrics.Instrument(db); err != nil {
+			return nil, nil, nil, err
+		}
+
+		app.Use(appMetrics.Middleware())
+		app.Get("/metrics", appMetrics.Handler())
+	}
+
+	health := &controllers.Health{
+		Checks: map[string]controllers.ReadinessCheck{
+			"database": func(ctx context.Context) error {
+				sqlDB, err := db.DB()
+				if err != nil {
+					return err
+				}
+
+				return sqlDB.PingContext(ctx)
+			},
+			"migrations": func(ctx context.Context) error {
+				pending, err := migrator.Pending(ctx)
+				if err != nil {
+					return err
+				}
+				if len(pending) > 0 {
+					return fmt.Errorf("%d pending migrations", len(pending))
+				}
+
+				return nil
+			},
+		},
+	}
+	routes.HealthSetup(app, health)
+
+	if err := tracing.Instrument(db, tracer); err != nil {
+		return nil, nil, nil, err
+	}
+
+	// The probes and the metrics above are neither traced nor in the access log.
+	app.Use(tracing.Middleware(tracer), middleware.RequestID(), middleware.AccessLog(logger))
+
+	if cfg.Features.Swagger {
+		app.Get("/swagger/*", fiberSwagger.WrapHandler)
+	}
 
 	app.Use(cors.New(cors.Config{
-		AllowCredentials: true,
+		AllowOrigins:     strings.Join(cfg.CORS.AllowOrigins, ","),
+		AllowCredentials: cfg.CORS.AllowCredentials,
 	}))
 
-	routes.Setup(app)
-
-	err := app.Listen(fmt.Sprintf("%v:%v", os.Getenv("SERVER_HOST"), os.Getenv("SERVER_PORT")))
+	policies, err := cfg.RateLimit.Policies()
 	if err != nil {
-		panic(err.Error())
+		return nil, nil, nil, err
 	}
+
+	store := repository.NewGorm(db)
+	store.RewriteUpgraded = cfg.Features.UpgradeRewrite
+	store.Logger = logger
+	service := &controllers.Service{
+		Phemes:       appMetrics.Phemes(store),
+		Users:        repository.NewUserCache(appMetrics.Users(store), cfg.Limits.UserCacheTTL),
+		Tokens:       store,
+		Transactions: store,
+		Logger:       logger,
+		Limiter: ratelimit.Limiter{
+			Store:    ratelimit.NewMemory(),
+			Policies: policies,
+		},
+		IdempotencyKeys: store,
+		IdempotencyTTL:  cfg.Limits.IdempotencyTTL,
+		BatchSize:       cfg.Limits.BatchSize,
+		Deletions:       store,
+		DeletionGrace:   cfg.Limits.DeletionGrace,
+		Reactions:       store,
+		Exports:         store,
+		Events:          events.NewBus(cfg.Stream.Retention, cfg.Stream.Buffer),
+		Heartbeat:       cfg.Stream.Heartbeat,
+		WriteTimeout:    cfg.Server.WriteTimeout,
+		Notifications:   notify.NewHub(pubsub, cfg.Stream.Heartbeat, cfg.Stream.Buffer, logger),
+	}
+	if cfg.CORS.AllowCredentials {
+		service.NotificationOrigins = cfg.CORS.AllowOrigins
+	}
+
+	routes.Setup(app, service, verifier)
+
+	return app, health, service, nil
 }
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"gorm.io/gorm"
+)
+
+// startKey stores the start time of a query in the statement.
+const startKey = "metrics:start"
+
+// Instrument records the latency and errors of the queries of the database and
+// registers the stats of its connection pool.
+func (m *Metrics) Instrument(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	if err := m.registry.Register(collectors.NewDBStatsCollector(sqlDB, db.Dialector.Name())); err != nil {
+		return err
+	}
+
+	callbacks := db.Callback()
+	for _, err := range []error{
+		callbacks.Create().Before("*").Register("metrics:before_create", start),
+		callbacks.Create().After("*").Register("metrics:after_create", m.observe("create")),
+		callbacks.Query().Before("*").Register("metrics:before_query", start),
+		callbacks.Query().After("*").Register("metrics:after_query", m.observe("query")),
+		callbacks.Update().Before("*").Register("metrics:before_update", start),
+		callbacks.Update().After("*").Register("metrics:after_update", m.observe("update")),
+		callbacks.Delete().Before("*").Register("metrics:before_delete", start),
+		callbacks.Delete().After("*").Register("metrics:after_delete", m.observe("delete")),
+		callbacks.Row().Before("*").Register("metrics:before_row", start),
+		callbacks.Row().After("*").Register("metrics:after_row", m.observe("row")),
+		callbacks.Raw().Before("*").Register("metrics:before_raw", start),
+		callbacks.Raw().After("*").Register("metrics:after_raw", m.observe("raw")),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func start(db *gorm.DB) {
+	db.InstanceSet(startKey, time.Now())
+}
+
+// observe returns the callback recording the query of the operation.
+func (m *Metrics) observe(operation string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		value, ok := db.InstanceGet(startKey)
+		if !ok {
+			return
+		}
+
+		table := db.Statement.Table
+		if table == "" {
+			table = "unknown"
+		}
+
+		m.queryDuration.WithLabelValues(operation, table).Observe(time.Since(value.(time.Time)).Seconds())
+		if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+			m.queryErrors.WithLabelValues(operation, table).Inc()
+		}
+	}
+}
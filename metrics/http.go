@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/feserr/pheme-user/problem"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// unmatched is the route label of the requests without a route.
+const unmatched = "unmatched"
+
+// Middleware records the count, status and latency of the requests. The route
+// label is the template the request matched, e.g. /api/v1/pheme/:id<int>, never
+// the raw path, so the number of series is bounded by the registered routes.
+func (m *Metrics) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		mount := c.Route().Path
+		err := c.Next()
+
+		// The error handler writes the status after the middlewares return.
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = problem.Status(err)
+		}
+
+		// The method points to the reused request buffer, the labels are kept.
+		method := utils.CopyString(c.Method())
+		route := c.Route().Path
+		if route == mount {
+			// Only the app middlewares, mounted like this one, ran.
+			route = unmatched
+		}
+		m.requests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+		m.requestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+
+		return err
+	}
+}
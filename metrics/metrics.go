@@ -0,0 +1,107 @@
+// Package metrics Prometheus metrics of the service
+package metrics
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+)
+
+// namespace prefixes the metrics of the service.
+const namespace = "pheme"
+
+// Metrics are the collectors of the service, registered in their own registry
+// so every app has its own.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests             *prometheus.CounterVec
+	requestDuration      *prometheus.HistogramVec
+	queryDuration        *prometheus.HistogramVec
+	queryErrors          *prometheus.CounterVec
+	phemesCreated        prometheus.Counter
+	phemesDeleted        prometheus.Counter
+	relationshipsAdded   *prometheus.CounterVec
+	relationshipsRemoved *prometheus.CounterVec
+}
+
+// New returns the metrics of the service, with the Go runtime and process ones.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by method, route template and status code.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of the HTTP requests by method and route template.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "db_query_duration_seconds",
+			Help:      "Latency of the database queries by operation and table.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation", "table"}),
+		queryErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "db_query_errors_total",
+			Help:      "Failed database queries by operation and table, without the not found ones.",
+		}, []string{"operation", "table"}),
+		phemesCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "phemes_created_total",
+			Help:      "Phemes created.",
+		}),
+		phemesDeleted: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "phemes_deleted_total",
+			Help:      "Phemes deleted.",
+		}),
+		relationshipsAdded: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "relationships_added_total",
+			Help:      "Relationships added by kind, friend or follower.",
+		}, []string{"kind"}),
+		relationshipsRemoved: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "relationships_removed_total",
+			Help:      "Relationships removed by kind, friend or follower.",
+		}, []string{"kind"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.queryDuration,
+		m.queryErrors,
+		m.phemesCreated,
+		m.phemesDeleted,
+		m.relationshipsAdded,
+		m.relationshipsRemoved,
+	)
+
+	return m
+}
+
+// Registry returns the registry of the metrics.
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() fiber.Handler {
+	handler := fasthttpadaptor.NewFastHTTPHandler(promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+
+	return func(c *fiber.Ctx) error {
+		handler(c.Context())
+		return nil
+	}
+}
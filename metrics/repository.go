@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"context"
+
+	"github.com/feserr/pheme-user/models"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Relationship kinds of the relationship counters.
+const (
+	kindFriend   = "friend"
+	kindFollower = "follower"
+)
+
+// Phemes counts the phemes created and deleted in the repository.
+type Phemes struct {
+	models.PhemeRepository
+
+	metrics *Metrics
+}
+
+// Phemes returns the repository counting its created and deleted phemes.
+func (m *Metrics) Phemes(phemes models.PhemeRepository) *Phemes {
+	return &Phemes{PhemeRepository: phemes, metrics: m}
+}
+
+// CreatePheme adds a pheme.
+func (r *Phemes) CreatePheme(ctx context.Context, pheme models.Pheme) (uint, error) {
+	id, err := r.PhemeRepository.CreatePheme(ctx, pheme)
+	if err == nil && id != 0 {
+		r.metrics.phemesCreated.Inc()
+	}
+
+	return id, err
+}
+
+// DeletePheme removes a pheme from a user.
+func (r *Phemes) DeletePheme(ctx context.Context, phemeID uint, userID uint) (models.Pheme, error) {
+	deleted, err := r.PhemeRepository.DeletePheme(ctx, phemeID, userID)
+	if err == nil {
+		r.metrics.phemesDeleted.Inc()
+	}
+
+	return deleted, err
+}
+
+// DeletePhemeByID removes a pheme from any user.
+func (r *Phemes) DeletePhemeByID(ctx context.Context, phemeID uint, moderatorID uint) (models.Pheme, error) {
+	deleted, err := r.PhemeRepository.DeletePhemeByID(ctx, phemeID, moderatorID)
+	if err == nil {
+		r.metrics.phemesDeleted.Inc()
+	}
+
+	return deleted, err
+}
+
+// Users counts the relationships added and removed in the repository.
+type Users struct {
+	models.UserRepository
+
+	metrics *Metrics
+}
+
+// Users returns the repository counting its added and removed relationships.
+func (m *Metrics) Users(users models.UserRepository) *Users {
+	return &Users{UserRepository: users, metrics: m}
+}
+
+// AddFriend adds a friend to a user.
+func (r *Users) AddFriend(ctx context.Context, userID uint, friendID uint) error {
+	return r.count(r.metrics.relationshipsAdded, kindFriend, r.UserRepository.AddFriend(ctx, userID, friendID))
+}
+
+// AddFollower adds a follower to a user.
+func (r *Users) AddFollower(ctx context.Context, userID uint, followerID uint) error {
+	return r.count(r.metrics.relationshipsAdded, kindFollower, r.UserRepository.AddFollower(ctx, userID, followerID))
+}
+
+// RemoveFriend removes a friend of a user.
+func (r *Users) RemoveFriend(ctx context.Context, userID uint, friendID uint) error {
+	return r.count(r.metrics.relationshipsRemoved, kindFriend, r.UserRepository.RemoveFriend(ctx, userID, friendID))
+}
+
+// RemoveFollower removes a follower of a user.
+func (r *Users) RemoveFollower(ctx context.Context, userID uint, followerID uint) error {
+	return r.count(r.metrics.relationshipsRemoved, kindFollower, r.UserRepository.RemoveFollower(ctx, userID, followerID))
+}
+
+// count increments the counter of the kind when the change succeeded.
+func (r *Users) count(counter *prometheus.CounterVec, kind string, err error) error {
+	if err == nil {
+		counter.WithLabelValues(kind).Inc()
+	}
+
+	return err
+}
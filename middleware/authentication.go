@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/feserr/pheme-user/auth"
+	"github.com/feserr/pheme-user/models"
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/exp/slog"
+)
+
+// localUser is the key of the authenticated user in the context locals.
+const localUser = "user"
+
+// localScopes is the key of the scopes of the personal access token in the context locals.
+const localScopes = "scopes"
+
+// localAuthSource is the key of the source of the credentials in the context locals.
+const localAuthSource = "authSource"
+
+// AuthSource is where the credentials of a request were read from.
+type AuthSource string
+
+const (
+	AuthSourceCookie AuthSource = "cookie"
+	AuthSourceBearer AuthSource = "bearer"
+	AuthSourceToken  AuthSource = "token"
+)
+
+var (
+	errInvalidAuthorization = errors.New("invalid Authorization header")
+	errTokenExpired         = errors.New("personal access token is expired")
+	errUnauthenticated      = models.Unauthenticated("unauthenticated", "Unauthenticated")
+)
+
+// AuthConfig defines the config for the authentication middleware.
+type AuthConfig struct {
+	// Verifier used to validate the JWT.
+	Verifier *auth.Verifier
+
+	// Users loads the logged user.
+	Users models.UserRepository
+
+	// Tokens loads the personal access tokens.
+	Tokens models.TokenRepository
+
+	// Logger of the failures to record the use of the tokens.
+	Logger *slog.Logger
+}
+
+// Authenticate validates the JWT or the personal access token once and stores
+// the logged user in the context locals.
+func Authenticate(config AuthConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token, source, err := requestToken(c)
+		if err != nil {
+			return errUnauthenticated
+		}
+
+		var user models.User
+		if source == AuthSourceBearer && strings.HasPrefix(token, models.TokenPrefix) {
+			user, err = tokenUser(c, config, token)
+			source = AuthSourceToken
+		} else {
+			user, err = jwtUser(c, config, token)
+		}
+		if err != nil {
+			return errUnauthenticated
+		}
+
+		c.Locals(localUser, user)
+		c.Locals(localAuthSource, source)
+
+		return c.Next()
+	}
+}
+
+// jwtUser returns the user the JWT was issued for.
+func jwtUser(c *fiber.Ctx, config AuthConfig, token string) (models.User, error) {
+	claims, err := config.Verifier.Verify(token)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	userID, err := claims.UserID()
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return config.Users.FindAuthUser(c.UserContext(), userID)
+}
+
+// tokenUser returns the owner of the personal access token, records its use
+// and stores its scopes in the context locals.
+func tokenUser(c *fiber.Ctx, config AuthConfig, value string) (models.User, error) {
+	token, err := config.Tokens.FindTokenByHash(c.UserContext(), models.HashToken(value))
+	if err != nil {
+		return models.User{}, err
+	}
+
+	now := time.Now()
+	if token.Expired(now) {
+		return models.User{}, errTokenExpired
+	}
+
+	if token.NeedsTouch(now) {
+		if err := config.Tokens.TouchToken(c.UserContext(), token.ID, now); err != nil {
+			config.Logger.WarnCtx(c.UserContext(), "failed to record the use of a token", "token", token.ID, "error", err)
+		}
+	}
+
+	c.Locals(localScopes, token.Scopes)
+
+	return config.Users.FindAuthUser(c.UserContext(), token.UserID)
+}
+
+// requestToken returns the JWT of the request and where it was read from. The
+// Authorization header takes precedence: when it is present the jwt cookie is
+// ignored, even if the header is not a valid bearer token.
+func requestToken(c *fiber.Ctx) (string, AuthSource, error) {
+	authorization := c.Get(fiber.HeaderAuthorization)
+	if authorization == "" {
+		return c.Cookies("jwt"), AuthSourceCookie, nil
+	}
+
+	scheme, token, found := strings.Cut(authorization, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", AuthSourceBearer, errInvalidAuthorization
+	}
+
+	return strings.TrimSpace(token), AuthSourceBearer, nil
+}
+
+// CurrentUser returns the user stored by the authentication middleware.
+func CurrentUser(c *fiber.Ctx) (models.User, bool) {
+	user, ok := c.Locals(localUser).(models.User)
+	return user, ok
+}
+
+// CurrentAuthSource returns where the credentials of the request were read from.
+func CurrentAuthSource(c *fiber.Ctx) AuthSource {
+	source, _ := c.Locals(localAuthSource).(AuthSource)
+	return source
+}
+
+// CurrentScopes returns the scopes of the personal access token of the request.
+func CurrentScopes(c *fiber.Ctx) []models.Permission {
+	scopes, _ := c.Locals(localScopes).([]models.Permission)
+	return scopes
+}
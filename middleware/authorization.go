@@ -0,0 +1,61 @@
+// Package middleware Fiber middlewares
+package middleware
+
+import (
+	"github.com/feserr/pheme-user/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+var errSessionRequired = models.Forbidden("session_required", "Forbidden for personal access tokens")
+
+// RequirePermission only lets through the users whose roles grant all the
+// permissions. Requests authenticated with a personal access token also need
+// the permissions in the token scopes. It must run after Authenticate.
+func RequirePermission(permissions ...models.Permission) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, ok := CurrentUser(c); !ok {
+			return errUnauthenticated
+		}
+
+		for _, permission := range permissions {
+			if !Can(c, permission) {
+				return models.Forbidden("missing_permission", "The user doesn't have the permission "+string(permission))
+			}
+		}
+
+		return c.Next()
+	}
+}
+
+// RequireSession only lets through the requests authenticated with a JWT, so
+// personal access tokens cannot manage other tokens. It must run after Authenticate.
+func RequireSession() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if CurrentAuthSource(c) == AuthSourceToken {
+			return errSessionRequired
+		}
+
+		return c.Next()
+	}
+}
+
+// Can returns if the logged user has the permission, limited by the scopes of
+// the personal access token.
+func Can(c *fiber.Ctx, permission models.Permission) bool {
+	user, ok := CurrentUser(c)
+	return ok && user.Can(permission) && scopeAllows(c, permission)
+}
+
+func scopeAllows(c *fiber.Ctx, permission models.Permission) bool {
+	if CurrentAuthSource(c) != AuthSourceToken {
+		return true
+	}
+
+	for _, scope := range CurrentScopes(c) {
+		if scope == permission {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ClientIP returns the IP of the client of the request. Behind the trusted
+// proxies of the app it is the last address of its proxy header that isn't
+// one of them: the proxies append the address they received the request from,
+// the first ones can be sent by the client itself.
+func ClientIP(c *fiber.Ctx) string {
+	remote := c.Context().RemoteIP().String()
+
+	config := c.App().Config()
+	if config.ProxyHeader == "" || !c.IsProxyTrusted() {
+		return remote
+	}
+
+	addresses := strings.Split(c.Get(config.ProxyHeader), ",")
+	for i := len(addresses) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(addresses[i]))
+		if ip == nil {
+			break
+		}
+
+		if !trustedProxy(ip, config.TrustedProxies) {
+			return ip.String()
+		}
+	}
+
+	return remote
+}
+
+// trustedProxy returns if the IP is one of the proxies, given as IPs or CIDR
+// ranges.
+func trustedProxy(ip net.IP, proxies []string) bool {
+	for _, proxy := range proxies {
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+		} else if trusted := net.ParseIP(proxy); trusted != nil && trusted.Equal(ip) {
+			return true
+		}
+	}
+
+	return false
+}
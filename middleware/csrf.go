@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+
+	"github.com/feserr/pheme-user/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// CSRFCookie is the cookie with the CSRF token.
+	CSRFCookie = "csrf_token"
+	// CSRFHeader is the header where the clients send back the CSRF token.
+	CSRFHeader = "X-CSRF-Token"
+)
+
+var errInvalidCSRF = models.Forbidden("invalid_csrf_token", "Invalid CSRF token")
+
+// CSRF protects the unsafe requests authenticated with the jwt cookie using a
+// double submit cookie: the token of the csrf_token cookie must be sent back
+// in the X-CSRF-Token header. Bearer authenticated requests are not checked,
+// browsers don't attach them automatically. It must run after Authenticate.
+func CSRF() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if CurrentAuthSource(c) != AuthSourceCookie {
+			return c.Next()
+		}
+
+		token := c.Cookies(CSRFCookie)
+
+		switch c.Method() {
+		case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions, fiber.MethodTrace:
+			if token == "" {
+				token, err := newCSRFToken()
+				if err != nil {
+					return err
+				}
+
+				c.Cookie(&fiber.Cookie{
+					Name:     CSRFCookie,
+					Value:    token,
+					Path:     "/",
+					SameSite: fiber.CookieSameSiteStrictMode,
+				})
+			}
+
+			return c.Next()
+		}
+
+		header := c.Get(CSRFHeader)
+		if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(header)) != 1 {
+			return errInvalidCSRF
+		}
+
+		return c.Next()
+	}
+}
+
+func newCSRFToken() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
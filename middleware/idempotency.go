@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/feserr/pheme-user/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// HeaderIdempotencyKey is the header with the key of the retries of a request.
+	HeaderIdempotencyKey = "Idempotency-Key"
+	// HeaderIdempotentReplayed is set on the responses replayed for a retry.
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+)
+
+// maxIdempotencyKeyLength is the maximum length of an Idempotency-Key.
+const maxIdempotencyKeyLength = 255
+
+var (
+	errInvalidIdempotencyKey = models.Invalid("invalid_idempotency_key", "The Idempotency-Key must have between 1 and 255 printable characters")
+	errIdempotencyKeyReused  = models.Unprocessable("idempotency_key_reused", "The Idempotency-Key was used for another request")
+	errIdempotencyInFlight   = models.Conflict("idempotency_key_in_flight", "A request with the same Idempotency-Key is in progress")
+)
+
+// IdempotencyConfig defines the config for the idempotency middleware.
+type IdempotencyConfig struct {
+	// Keys stores the requests and their responses.
+	Keys models.IdempotencyRepository
+
+	// TTL is the time the response of a request is replayed.
+	TTL time.Duration
+
+	// Lease is the time a request in flight keeps its key: a retry takes over
+	// the key of a request not completed in time, lost when the process
+	// stopped during it. Zero keeps the key for the TTL.
+	Lease time.Duration
+
+	// Logger of the failures to store the responses.
+	Logger *slog.Logger
+}
+
+// Idempotency replays the response of the first request of a user with an
+// Idempotency-Key header to its retries, so they don't repeat its effects.
+// A retry while the first request is in flight gets a 409, and the reuse of
+// the key for another request a 422, until the lease of the key ends. Only the successful responses are
+// stored: when the request fails the key is released and can be retried. The
+// requests without the header are not changed. It must run after Authenticate.
+func Idempotency(config IdempotencyConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		value := utils.CopyString(c.Get(HeaderIdempotencyKey))
+		user, ok := CurrentUser(c)
+		if value == "" || !ok {
+			return c.Next()
+		}
+
+		if !validIdempotencyKey(value) {
+			return errInvalidIdempotencyKey
+		}
+
+		now := time.Now()
+		key, reserved, err := config.Keys.ReserveIdempotencyKey(c.UserContext(), models.IdempotencyKey{
+			UserID:      user.ID,
+			Key:         value,
+			Fingerprint: models.RequestFingerprint(c.Method(), c.Path(), c.Body()),
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(config.lease()),
+		})
+		if err != nil {
+			return err
+		}
+
+		if !reserved {
+			return replay(c, key)
+		}
+
+		if err := c.Next(); err != nil {
+			config.release(c, key)
+			return err
+		}
+
+		response := c.Response()
+		if response.StatusCode() >= fiber.StatusBadRequest {
+			config.release(c, key)
+			return nil
+		}
+
+		key.Status = response.StatusCode()
+		key.ContentType = string(response.Header.ContentType())
+		key.Body = append([]byte(nil), response.Body()...)
+		key.ExpiresAt = key.CreatedAt.Add(config.TTL)
+		if err := config.Keys.CompleteIdempotencyKey(c.UserContext(), key); err != nil {
+			config.Logger.WarnCtx(c.UserContext(), "failed to store the response of an idempotency key", "error", err)
+			config.release(c, key)
+		}
+
+		return nil
+	}
+}
+
+// replay answers the retry of a request with the stored response.
+func replay(c *fiber.Ctx, key models.IdempotencyKey) error {
+	if !key.Matches(models.RequestFingerprint(c.Method(), c.Path(), c.Body())) {
+		return errIdempotencyKeyReused
+	}
+
+	if !key.Completed() {
+		return errIdempotencyInFlight
+	}
+
+	c.Set(HeaderIdempotentReplayed, "true")
+	c.Set(fiber.HeaderContentType, key.ContentType)
+	return c.Status(key.Status).Send(key.Body)
+}
+
+// lease returns the time a request in flight keeps its key.
+func (config IdempotencyConfig) lease() time.Duration {
+	if config.Lease <= 0 || config.Lease > config.TTL {
+		return config.TTL
+	}
+
+	return config.Lease
+}
+
+// release removes the key of a failed request, so it can be retried.
+func (config IdempotencyConfig) release(c *fiber.Ctx, key models.IdempotencyKey) {
+	if err := config.Keys.ReleaseIdempotencyKey(c.UserContext(), key.ID); err != nil {
+		config.Logger.WarnCtx(c.UserContext(), "failed to release an idempotency key", "error", err)
+	}
+}
+
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+
+	for _, r := range key {
+		if r < ' ' || r > '~' {
+			return false
+		}
+	}
+
+	return true
+}
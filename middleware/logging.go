@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/feserr/pheme-user/logging"
+	"github.com/feserr/pheme-user/problem"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/google/uuid"
+	"golang.org/x/exp/slog"
+)
+
+// maxRequestIDLength is the maximum length of a X-Request-ID reused from the request.
+const maxRequestIDLength = 128
+
+// RequestID reuses the X-Request-ID of the request, or generates one when it is
+// missing or invalid, sends it back and stores it in the user context so the
+// logs and queries of the request have it.
+func RequestID() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Get(fiber.HeaderXRequestID)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		} else {
+			id = utils.CopyString(id)
+		}
+
+		c.Set(fiber.HeaderXRequestID, id)
+		c.SetUserContext(logging.WithRequestID(c.UserContext(), id))
+
+		return c.Next()
+	}
+}
+
+// validRequestID returns if the ID is short and only has letters, digits and
+// the - _ . : separators, so it's safe to log.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// AccessLog logs every request once it is handled, with the errors returned
+// to the error handler.
+func AccessLog(logger *slog.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		// The error handler writes the status after the middlewares return.
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = problem.Status(err)
+		}
+
+		args := []any{
+			"method", c.Method(),
+			"path", c.Path(),
+			"status", status,
+			"elapsed", time.Since(start),
+		}
+		if err != nil {
+			args = append(args, "error", err)
+		}
+
+		level := slog.LevelInfo
+		if status >= fiber.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		logger.Log(c.UserContext(), level, "request", args...)
+
+		return err
+	}
+}
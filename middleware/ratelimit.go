@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/feserr/pheme-user/models"
+	"github.com/feserr/pheme-user/ratelimit"
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/exp/slog"
+)
+
+// The headers of the rate limits, from the IETF RateLimit header fields draft.
+const (
+	HeaderRateLimitLimit     = "RateLimit-Limit"
+	HeaderRateLimitRemaining = "RateLimit-Remaining"
+	HeaderRateLimitReset     = "RateLimit-Reset"
+	HeaderRateLimitPolicy    = "RateLimit-Policy"
+)
+
+var errRateLimited = models.TooManyRequests("rate_limited", "Too many requests, retry later")
+
+// RateLimitConfig defines the config for the rate limit middleware.
+type RateLimitConfig struct {
+	// Store keeps the buckets of the clients.
+	Store ratelimit.Store
+
+	// Policy of the routes.
+	Policy ratelimit.Policy
+
+	// Cost returns the tokens taken by a request, one when nil.
+	Cost func(c *fiber.Ctx) int
+
+	// Logger of the failures of the store.
+	Logger *slog.Logger
+}
+
+// RateLimit limits the rate of the requests of every client with a token
+// bucket, keyed by the user ID when it runs after Authenticate and the
+// ClientIP before. The requests over the limit are answered with a 429 and a
+// Retry-After. When the store fails the requests are let through.
+func RateLimit(config RateLimitConfig) fiber.Handler {
+	if config.Policy.Unlimited() {
+		return func(c *fiber.Ctx) error {
+			return c.Next()
+		}
+	}
+
+	return func(c *fiber.Ctx) error {
+		key := "ip:" + ClientIP(c)
+		if user, ok := CurrentUser(c); ok {
+			key = "user:" + strconv.FormatUint(uint64(user.ID), 10)
+		}
+
+		cost := 1
+		if config.Cost != nil {
+			cost = config.Cost(c)
+		}
+
+		result, err := config.Store.Take(c.UserContext(), key, config.Policy, cost)
+		if err != nil {
+			config.Logger.WarnCtx(c.UserContext(), "failed to check the rate limit", "policy", config.Policy.Name, "error", err)
+			return c.Next()
+		}
+
+		setRateLimitHeaders(c, config.Policy, result)
+		if !result.Allowed {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds(result.RetryAfter)))
+			return errRateLimited
+		}
+
+		return c.Next()
+	}
+}
+
+// setRateLimitHeaders sets the headers of the policy closest to its limit,
+// when several apply to the route.
+func setRateLimitHeaders(c *fiber.Ctx, policy ratelimit.Policy, result ratelimit.Result) {
+	if current := c.GetRespHeader(HeaderRateLimitRemaining); current != "" {
+		if remaining, err := strconv.Atoi(current); err == nil && remaining <= result.Remaining {
+			return
+		}
+	}
+
+	c.Set(HeaderRateLimitLimit, strconv.Itoa(policy.Limit))
+	c.Set(HeaderRateLimitRemaining, strconv.Itoa(result.Remaining))
+	c.Set(HeaderRateLimitReset, strconv.Itoa(seconds(result.Reset)))
+	c.Set(HeaderRateLimitPolicy, policy.String())
+}
+
+// seconds rounds up the duration to whole seconds.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
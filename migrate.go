@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/feserr/pheme-user/migrations"
+	"gorm.io/gorm"
+)
+
+const migrateUsage = `usage: pheme-user migrate <command>
+
+commands:
+  up            apply the pending migrations
+  down [steps]  roll back the last steps migrations, 1 by default
+  status        show the applied and pending migrations`
+
+// migrate runs the migrate subcommand.
+func migrate(db *gorm.DB, args []string, out io.Writer) error {
+	migrator, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up()
+		for _, migration := range applied {
+			fmt.Fprintf(out, "applied %04d %s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Fprintln(out, "the database is up to date")
+		}
+
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return errors.New("the steps must be a positive number")
+			}
+		}
+
+		rolledBack, err := migrator.Down(steps)
+		for _, migration := range rolledBack {
+			fmt.Fprintf(out, "rolled back %04d %s\n", migration.Version, migration.Name)
+		}
+
+		return err
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = "applied " + status.AppliedAt.Format(time.RFC3339)
+			}
+
+			fmt.Fprintf(out, "%04d %-40s %s\n", status.Version, status.Name, applied)
+		}
+
+		return nil
+	default:
+		return errors.New(migrateUsage)
+	}
+}
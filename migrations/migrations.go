@@ -0,0 +1,363 @@
+// Package migrations versioned schema of the database
+package migrations
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+// lockID identifies the Postgres advisory lock taken by the replicas while
+// they migrate the database.
+const lockID int64 = 0x7068656d65
+
+// Migration is a version of the schema.
+type Migration struct {
+	Version uint
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration and when it was applied, nil if it is pending.
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// schemaMigration is a row of the schema_migrations table.
+type schemaMigration struct {
+	Version   uint `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Migrator applies and rolls back the migrations of a database.
+type Migrator struct {
+	db         *gorm.DB
+	dialect    string
+	migrations []Migration
+}
+
+// New returns the migrator of the database, with the migrations of its SQL dialect.
+func New(db *gorm.DB) (*Migrator, error) {
+	dialect := db.Dialector.Name()
+
+	migrations, err := load(dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, dialect: dialect, migrations: migrations}, nil
+}
+
+// load reads the <version>_<name>.up.sql and .down.sql files of the dialect.
+func load(dialect string) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, dialect)
+	if err != nil {
+		return nil, errors.New("no migrations for the SQL dialect " + dialect)
+	}
+
+	byVersion := map[uint]*Migration{}
+	for _, entry := range entries {
+		base, direction, ok := cutDirection(entry.Name())
+		if !ok {
+			return nil, errors.New("invalid migration file name " + entry.Name())
+		}
+
+		prefix, name, ok := strings.Cut(base, "_")
+		version, err := strconv.ParseUint(prefix, 10, 32)
+		if !ok || err != nil || version == 0 {
+			return nil, errors.New("invalid migration file name " + entry.Name())
+		}
+
+		data, err := files.ReadFile(path.Join(dialect, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[uint(version)]
+		if !ok {
+			migration = &Migration{Version: uint(version), Name: name}
+			byVersion[uint(version)] = migration
+		} else if migration.Name != name {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, name)
+		}
+
+		if direction == "up" {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d needs an up and a down file", migration.Version)
+		}
+
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// cutDirection splits a file name into its base and the up or down direction.
+func cutDirection(name string) (string, string, bool) {
+	for _, direction := range []string{"up", "down"} {
+		suffix := "." + direction + ".sql"
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix), direction, true
+		}
+	}
+
+	return "", "", false
+}
+
+// Migrations returns all the known migrations, ordered by version.
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+// Up applies the pending migrations and returns them.
+func (m *Migrator) Up() ([]Migration, error) {
+	applied := []Migration{}
+
+	err := m.withLock(func(conn *gorm.DB) error {
+		versions, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := versions[migration.Version]; ok {
+				continue
+			}
+
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := execute(tx, migration.Up); err != nil {
+					return err
+				}
+
+				return tx.Create(&schemaMigration{
+					Version:   migration.Version,
+					Name:      migration.Name,
+					AppliedAt: time.Now().UTC(),
+				}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+			}
+
+			applied = append(applied, migration)
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down rolls back the last steps applied migrations and returns them.
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	rolledBack := []Migration{}
+	if steps < 1 {
+		return rolledBack, errors.New("the steps to roll back must be positive")
+	}
+
+	err := m.withLock(func(conn *gorm.DB) error {
+		rows := []schemaMigration{}
+		if err := conn.Order("version desc").Limit(steps).Find(&rows).Error; err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			migration, ok := m.find(row.Version)
+			if !ok {
+				return fmt.Errorf("migration %d %s is applied but unknown", row.Version, row.Name)
+			}
+
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := execute(tx, migration.Down); err != nil {
+					return err
+				}
+
+				return tx.Delete(&schemaMigration{}, row.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+			}
+
+			rolledBack = append(rolledBack, migration)
+		}
+
+		return nil
+	})
+
+	return rolledBack, err
+}
+
+// Status returns the known migrations and the applied ones missing from this
+// build, ordered by version.
+func (m *Migrator) Status() ([]Status, error) {
+	statuses := []Status{}
+
+	err := m.withLock(func(conn *gorm.DB) error {
+		versions, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			status := Status{Migration: migration}
+			if row, ok := versions[migration.Version]; ok {
+				status.AppliedAt = &row.AppliedAt
+				delete(versions, migration.Version)
+			}
+
+			statuses = append(statuses, status)
+		}
+
+		for _, row := range versions {
+			appliedAt := row.AppliedAt
+			statuses = append(statuses, Status{
+				Migration: Migration{Version: row.Version, Name: row.Name},
+				AppliedAt: &appliedAt,
+			})
+		}
+
+		return nil
+	})
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+
+	return statuses, err
+}
+
+// Pending returns the migrations that are not applied. It doesn't wait for the
+// migrations lock, so it can be used by the readiness checks.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	db := m.db.WithContext(ctx)
+
+	pending := []Migration{}
+	if !db.Migrator().HasTable(&schemaMigration{}) {
+		return append(pending, m.migrations...), nil
+	}
+
+	versions, err := appliedVersions(db)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, migration := range m.migrations {
+		if _, ok := versions[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+
+	return pending, nil
+}
+
+func (m *Migrator) find(version uint) (Migration, bool) {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration, true
+		}
+	}
+
+	return Migration{}, false
+}
+
+// withLock runs fn in a single connection holding the migrations lock, with
+// the schema_migrations table created. Postgres uses an advisory lock so only
+// one replica migrates at a time, SQLite already serializes the writes.
+func (m *Migrator) withLock(fn func(conn *gorm.DB) error) error {
+	return m.db.Connection(func(conn *gorm.DB) error {
+		conn = conn.Session(&gorm.Session{NewDB: true})
+
+		if m.dialect == "postgres" {
+			if err := conn.Exec("SELECT pg_advisory_lock(?)", lockID).Error; err != nil {
+				return err
+			}
+
+			defer conn.Exec("SELECT pg_advisory_unlock(?)", lockID)
+		}
+
+		err := conn.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version bigint PRIMARY KEY,
+			name text NOT NULL,
+			applied_at timestamp NOT NULL
+		)`).Error
+		if err != nil {
+			return err
+		}
+
+		return fn(conn)
+	})
+}
+
+// appliedVersions returns the rows of the applied migrations by version.
+func appliedVersions(conn *gorm.DB) (map[uint]schemaMigration, error) {
+	rows := []schemaMigration{}
+	if err := conn.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	versions := map[uint]schemaMigration{}
+	for _, row := range rows {
+		versions[row.Version] = row
+	}
+
+	return versions, nil
+}
+
+// execute runs the statements of a migration file one by one, the drivers
+// don't agree on running several statements in a single call.
+func execute(tx *gorm.DB, script string) error {
+	for _, statement := range strings.Split(script, ";") {
+		if isBlank(statement) {
+			continue
+		}
+
+		if err := tx.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isBlank returns if the statement only has whitespace and comments.
+func isBlank(statement string) bool {
+	for _, line := range strings.Split(statement, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,166 @@
+package migrations
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/feserr/pheme-user/database"
+	"github.com/feserr/pheme-user/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+func openSQLite(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := database.Open(database.Config{
+		DSN: "sqlite:" + filepath.Join(t.TempDir(), "pheme.db"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestLoad(t *testing.T) {
+	postgres, err := load("postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sqlite, err := load("sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(postgres) == 0 || len(postgres) != len(sqlite) {
+		t.Fatalf("got %d postgres and %d sqlite migrations", len(postgres), len(sqlite))
+	}
+
+	for i := range postgres {
+		if postgres[i].Version != sqlite[i].Version || postgres[i].Name != sqlite[i].Name {
+			t.Errorf("migration %d differs: %d %s and %d %s", i,
+				postgres[i].Version, postgres[i].Name, sqlite[i].Version, sqlite[i].Name)
+		}
+	}
+
+	if _, err := load("mysql"); err == nil {
+		t.Error("expected an error for an unknown dialect")
+	}
+}
+
+func TestUpDown(t *testing.T) {
+	db := openSQLite(t)
+
+	migrator, err := New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	all := len(migrator.Migrations())
+
+	pending, err := migrator.Pending(context.Background())
+	if err != nil || len(pending) != all {
+		t.Errorf("got %d pending migrations, %v, want %d", len(pending), err, all)
+	}
+
+	applied, err := migrator.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != all {
+		t.Errorf("applied %d migrations, want %d", len(applied), all)
+	}
+
+	applied, err = migrator.Up()
+	if err != nil || len(applied) != 0 {
+		t.Errorf("applied %d migrations again, %v", len(applied), err)
+	}
+
+	pending, err = migrator.Pending(context.Background())
+	if err != nil || len(pending) != 0 {
+		t.Errorf("got %d pending migrations, %v, want none", len(pending), err)
+	}
+
+	statuses, err := migrator.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			t.Errorf("migration %d is pending", status.Version)
+		}
+	}
+
+	rolledBack, err := migrator.Down(1)
+	if err != nil || len(rolledBack) != 1 || rolledBack[0].Version != migrator.Migrations()[all-1].Version {
+		t.Fatalf("rolled back %+v, %v, want the last migration", rolledBack, err)
+	}
+
+	statuses, err = migrator.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statuses[all-1].AppliedAt != nil {
+		t.Errorf("migration %d is applied after the roll back", statuses[all-1].Version)
+	}
+
+	if _, err := migrator.Down(all); err != nil {
+		t.Fatal(err)
+	}
+
+	if db.Migrator().HasTable("phemes") {
+		t.Error("the tables still exist after rolling back all the migrations")
+	}
+
+	// The tables shared with the pheme-auth service are kept.
+	for _, table := range []string{"users", "friendship", "followship"} {
+		if !db.Migrator().HasTable(table) {
+			t.Errorf("the shared table %s was dropped by rolling back the migrations", table)
+		}
+	}
+
+	if _, err := migrator.Down(0); err == nil {
+		t.Error("expected an error rolling back 0 steps")
+	}
+}
+
+// TestModelsSchema checks that the migrations create every column of the models.
+func TestModelsSchema(t *testing.T) {
+	db := openSQLite(t)
+
+	migrator, err := New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, model := range []interface{}{&models.User{}, &models.Pheme{}, &models.UserRole{}, &models.PersonalAccessToken{}, &models.IdempotencyKey{}, &models.AccountDeletion{}, &models.Export{}} {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			t.Fatal(err)
+		}
+
+		if !db.Migrator().HasTable(stmt.Schema.Table) {
+			t.Errorf("missing table %s", stmt.Schema.Table)
+			continue
+		}
+
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName != "" && !db.Migrator().HasColumn(model, field.DBName) {
+				t.Errorf("missing column %s.%s", stmt.Schema.Table, field.DBName)
+			}
+		}
+
+		for _, relationship := range stmt.Schema.Relationships.Relations {
+			if relationship.Type == schema.Many2Many && !db.Migrator().HasTable(relationship.JoinTable.Table) {
+				t.Errorf("missing join table %s", relationship.JoinTable.Table)
+			}
+		}
+	}
+}
@@ -0,0 +1,10 @@
+-- The users are shared with the pheme-auth service, the table may already exist.
+CREATE TABLE IF NOT EXISTS users (
+    id bigserial PRIMARY KEY,
+    version bigint NOT NULL,
+    name text NOT NULL,
+    email text NOT NULL UNIQUE,
+    password bytea NOT NULL,
+    password_date timestamptz NOT NULL,
+    created_at timestamptz NOT NULL
+);
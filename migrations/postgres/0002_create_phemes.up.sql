@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS phemes (
+    id bigserial PRIMARY KEY,
+    version bigint NOT NULL,
+    created_at timestamptz NOT NULL,
+    updated_at timestamptz,
+    visibility smallint NOT NULL,
+    category text NOT NULL,
+    text text NOT NULL,
+    created_by bigint NOT NULL,
+    user_id bigint NOT NULL
+);
@@ -0,0 +1,2 @@
+-- The friendships and followships are shared with the pheme-auth service,
+-- rolling back this service keeps them.
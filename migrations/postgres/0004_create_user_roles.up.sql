@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id bigint,
+    role varchar(32),
+    granted_by bigint NOT NULL,
+    created_at timestamptz NOT NULL,
+    PRIMARY KEY (user_id, role),
+    CONSTRAINT fk_users_roles FOREIGN KEY (user_id) REFERENCES users(id)
+);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_followship_follower;
+DROP INDEX IF EXISTS idx_followship_user_follower;
+DROP INDEX IF EXISTS idx_friendship_friend;
+DROP INDEX IF EXISTS idx_friendship_user_friend;
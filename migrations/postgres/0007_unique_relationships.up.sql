@@ -0,0 +1,12 @@
+-- The join tables created by the pheme-auth service, before these migrations,
+-- may lack their primary key and have repeated rows.
+DELETE FROM friendship a USING friendship b
+WHERE a.ctid > b.ctid AND a.user_id = b.user_id AND a.friend_id = b.friend_id;
+
+DELETE FROM followship a USING followship b
+WHERE a.ctid > b.ctid AND a.user_id = b.user_id AND a.follower_id = b.follower_id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_friendship_user_friend ON friendship (user_id, friend_id);
+CREATE INDEX IF NOT EXISTS idx_friendship_friend ON friendship (friend_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_followship_user_follower ON followship (user_id, follower_id);
+CREATE INDEX IF NOT EXISTS idx_followship_follower ON followship (follower_id);
@@ -0,0 +1,3 @@
+-- The trashed phemes are visible again.
+DROP INDEX IF EXISTS idx_phemes_deleted_at;
+ALTER TABLE phemes DROP COLUMN IF EXISTS deleted_at;
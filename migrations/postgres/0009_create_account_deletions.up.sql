@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS account_deletions (
+    user_id bigint PRIMARY KEY,
+    requested_at timestamptz NOT NULL,
+    scheduled_at timestamptz NOT NULL,
+    CONSTRAINT fk_account_deletions_user FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_account_deletions_scheduled_at ON account_deletions (scheduled_at);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_phemes_created_by;
+DROP INDEX IF EXISTS idx_phemes_user_id;
+
+ALTER TABLE idempotency_keys DROP CONSTRAINT IF EXISTS fk_idempotency_keys_user;
+ALTER TABLE personal_access_tokens DROP CONSTRAINT IF EXISTS fk_personal_access_tokens_user;
+ALTER TABLE phemes DROP CONSTRAINT IF EXISTS fk_phemes_created_by;
+ALTER TABLE phemes DROP CONSTRAINT IF EXISTS fk_phemes_user;
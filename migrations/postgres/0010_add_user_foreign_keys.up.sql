@@ -0,0 +1,15 @@
+-- Remove the rows left by the users deleted before there were foreign keys,
+-- they would fail the constraints.
+DELETE FROM phemes
+WHERE user_id NOT IN (SELECT id FROM users) OR created_by NOT IN (SELECT id FROM users);
+
+DELETE FROM personal_access_tokens WHERE user_id NOT IN (SELECT id FROM users);
+DELETE FROM idempotency_keys WHERE user_id NOT IN (SELECT id FROM users);
+
+ALTER TABLE phemes ADD CONSTRAINT fk_phemes_user FOREIGN KEY (user_id) REFERENCES users(id);
+ALTER TABLE phemes ADD CONSTRAINT fk_phemes_created_by FOREIGN KEY (created_by) REFERENCES users(id);
+ALTER TABLE personal_access_tokens ADD CONSTRAINT fk_personal_access_tokens_user FOREIGN KEY (user_id) REFERENCES users(id);
+ALTER TABLE idempotency_keys ADD CONSTRAINT fk_idempotency_keys_user FOREIGN KEY (user_id) REFERENCES users(id);
+
+CREATE INDEX IF NOT EXISTS idx_phemes_user_id ON phemes (user_id);
+CREATE INDEX IF NOT EXISTS idx_phemes_created_by ON phemes (created_by);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS exports (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    status text NOT NULL,
+    size bigint NOT NULL DEFAULT 0,
+    created_at timestamptz NOT NULL,
+    completed_at timestamptz,
+    archive bytea,
+    CONSTRAINT fk_exports_user FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_exports_user_id ON exports (user_id);
+CREATE INDEX IF NOT EXISTS idx_exports_status ON exports (status);
+CREATE INDEX IF NOT EXISTS idx_exports_created_at ON exports (created_at);
@@ -0,0 +1,2 @@
+UPDATE exports SET status = 'pending' WHERE status = 'running';
+ALTER TABLE exports DROP COLUMN claimed_at;
@@ -0,0 +1 @@
+ALTER TABLE phemes DROP COLUMN IF EXISTS deleted_by;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS pheme_reactions;
+DROP INDEX IF EXISTS idx_phemes_reply_to;
+ALTER TABLE phemes DROP COLUMN IF EXISTS reply_to;
@@ -0,0 +1,18 @@
+-- The pheme a pheme replies to, left dangling when it is purged.
+ALTER TABLE phemes ADD COLUMN IF NOT EXISTS reply_to bigint;
+
+CREATE INDEX IF NOT EXISTS idx_phemes_reply_to ON phemes (reply_to);
+
+-- The reactions of the users to the phemes, one by user and pheme, removed
+-- with the pheme.
+CREATE TABLE IF NOT EXISTS pheme_reactions (
+    pheme_id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    emoji text NOT NULL,
+    created_at timestamptz NOT NULL,
+    PRIMARY KEY (pheme_id, user_id),
+    CONSTRAINT fk_pheme_reactions_pheme FOREIGN KEY (pheme_id) REFERENCES phemes(id) ON DELETE CASCADE,
+    CONSTRAINT fk_pheme_reactions_user FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_pheme_reactions_user_id ON pheme_reactions (user_id);
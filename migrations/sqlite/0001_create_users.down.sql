@@ -0,0 +1,2 @@
+-- The users are shared with the pheme-auth service, rolling back this service
+-- keeps them.
@@ -0,0 +1,10 @@
+-- The users are shared with the pheme-auth service, the table may already exist.
+CREATE TABLE IF NOT EXISTS users (
+    id integer PRIMARY KEY,
+    version integer NOT NULL,
+    name text NOT NULL,
+    email text NOT NULL UNIQUE,
+    password blob NOT NULL,
+    password_date datetime NOT NULL,
+    created_at datetime NOT NULL
+);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS phemes (
+    id integer PRIMARY KEY,
+    version integer NOT NULL,
+    created_at datetime NOT NULL,
+    updated_at datetime,
+    visibility integer NOT NULL,
+    category text NOT NULL,
+    text text NOT NULL,
+    created_by integer NOT NULL,
+    user_id integer NOT NULL
+);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS friendship (
+    user_id integer,
+    friend_id integer,
+    PRIMARY KEY (user_id, friend_id),
+    CONSTRAINT fk_friendship_user FOREIGN KEY (user_id) REFERENCES users(id),
+    CONSTRAINT fk_friendship_friends FOREIGN KEY (friend_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS followship (
+    user_id integer,
+    follower_id integer,
+    PRIMARY KEY (user_id, follower_id),
+    CONSTRAINT fk_followship_user FOREIGN KEY (user_id) REFERENCES users(id),
+    CONSTRAINT fk_followship_followers FOREIGN KEY (follower_id) REFERENCES users(id)
+);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id integer,
+    role varchar(32),
+    granted_by integer NOT NULL,
+    created_at datetime NOT NULL,
+    PRIMARY KEY (user_id, role),
+    CONSTRAINT fk_users_roles FOREIGN KEY (user_id) REFERENCES users(id)
+);
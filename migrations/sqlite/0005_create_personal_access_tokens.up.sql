@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS personal_access_tokens (
+    id integer PRIMARY KEY,
+    user_id integer NOT NULL,
+    name text NOT NULL,
+    prefix text NOT NULL,
+    hash blob NOT NULL,
+    scopes text NOT NULL,
+    created_at datetime NOT NULL,
+    expires_at datetime,
+    last_used_at datetime
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_personal_access_tokens_hash ON personal_access_tokens (hash);
+CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user_id ON personal_access_tokens (user_id);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    id integer PRIMARY KEY,
+    user_id integer NOT NULL,
+    key text NOT NULL,
+    fingerprint blob NOT NULL,
+    status integer NOT NULL,
+    content_type text NOT NULL,
+    body blob,
+    created_at datetime NOT NULL,
+    expires_at datetime NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_idempotency_keys_user_key ON idempotency_keys (user_id, key);
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys (expires_at);
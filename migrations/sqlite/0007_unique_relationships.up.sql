@@ -0,0 +1,12 @@
+-- The join tables created by the pheme-auth service, before these migrations,
+-- may lack their primary key and have repeated rows.
+DELETE FROM friendship
+WHERE rowid NOT IN (SELECT min(rowid) FROM friendship GROUP BY user_id, friend_id);
+
+DELETE FROM followship
+WHERE rowid NOT IN (SELECT min(rowid) FROM followship GROUP BY user_id, follower_id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_friendship_user_friend ON friendship (user_id, friend_id);
+CREATE INDEX IF NOT EXISTS idx_friendship_friend ON friendship (friend_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_followship_user_follower ON followship (user_id, follower_id);
+CREATE INDEX IF NOT EXISTS idx_followship_follower ON followship (follower_id);
@@ -0,0 +1,3 @@
+ALTER TABLE phemes ADD COLUMN deleted_at datetime;
+
+CREATE INDEX IF NOT EXISTS idx_phemes_deleted_at ON phemes (deleted_at);
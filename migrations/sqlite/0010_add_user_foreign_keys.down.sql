@@ -0,0 +1,54 @@
+-- The tables are copied back to ones without the foreign keys.
+CREATE TABLE phemes_old (
+    id integer PRIMARY KEY,
+    version integer NOT NULL,
+    created_at datetime NOT NULL,
+    updated_at datetime,
+    visibility integer NOT NULL,
+    category text NOT NULL,
+    text text NOT NULL,
+    created_by integer NOT NULL,
+    user_id integer NOT NULL,
+    deleted_at datetime
+);
+
+INSERT INTO phemes_old SELECT id, version, created_at, updated_at, visibility, category, text, created_by, user_id, deleted_at FROM phemes;
+DROP TABLE phemes;
+ALTER TABLE phemes_old RENAME TO phemes;
+CREATE INDEX IF NOT EXISTS idx_phemes_deleted_at ON phemes (deleted_at);
+
+CREATE TABLE personal_access_tokens_old (
+    id integer PRIMARY KEY,
+    user_id integer NOT NULL,
+    name text NOT NULL,
+    prefix text NOT NULL,
+    hash blob NOT NULL,
+    scopes text NOT NULL,
+    created_at datetime NOT NULL,
+    expires_at datetime,
+    last_used_at datetime
+);
+
+INSERT INTO personal_access_tokens_old SELECT id, user_id, name, prefix, hash, scopes, created_at, expires_at, last_used_at FROM personal_access_tokens;
+DROP TABLE personal_access_tokens;
+ALTER TABLE personal_access_tokens_old RENAME TO personal_access_tokens;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_personal_access_tokens_hash ON personal_access_tokens (hash);
+CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user_id ON personal_access_tokens (user_id);
+
+CREATE TABLE idempotency_keys_old (
+    id integer PRIMARY KEY,
+    user_id integer NOT NULL,
+    key text NOT NULL,
+    fingerprint blob NOT NULL,
+    status integer NOT NULL,
+    content_type text NOT NULL,
+    body blob,
+    created_at datetime NOT NULL,
+    expires_at datetime NOT NULL
+);
+
+INSERT INTO idempotency_keys_old SELECT id, user_id, key, fingerprint, status, content_type, body, created_at, expires_at FROM idempotency_keys;
+DROP TABLE idempotency_keys;
+ALTER TABLE idempotency_keys_old RENAME TO idempotency_keys;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_idempotency_keys_user_key ON idempotency_keys (user_id, key);
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys (expires_at);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_phemes_user_import_key;
+ALTER TABLE phemes DROP COLUMN import_key;
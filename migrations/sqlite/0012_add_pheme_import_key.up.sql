@@ -0,0 +1,4 @@
+-- The key of the imported phemes, unique by user to skip them when imported again.
+ALTER TABLE phemes ADD COLUMN import_key text;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_phemes_user_import_key ON phemes (user_id, import_key);
@@ -0,0 +1,3 @@
+-- When the running exports were claimed, to claim again the ones whose build
+-- was lost.
+ALTER TABLE exports ADD COLUMN claimed_at datetime;
@@ -0,0 +1 @@
+ALTER TABLE phemes DROP COLUMN deleted_by;
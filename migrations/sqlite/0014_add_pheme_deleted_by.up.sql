@@ -0,0 +1,5 @@
+-- Who moved the phemes to the trash, the owners can only restore the ones they
+-- deleted. The phemes already trashed are left to their owners.
+ALTER TABLE phemes ADD COLUMN deleted_by integer;
+
+UPDATE phemes SET deleted_by = user_id WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// AccountDeletion model info
+// @Description Deletion of the account of a user, scheduled after a grace period
+type AccountDeletion struct {
+	UserID      uint      `json:"userID" gorm:"primaryKey;autoIncrement:false"`
+	RequestedAt time.Time `json:"requestedAt" gorm:"not null"`
+	ScheduledAt time.Time `json:"scheduledAt" gorm:"not null;index"`
+}
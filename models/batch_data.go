@@ -0,0 +1,59 @@
+package models
+
+// The actions and relations of the relationship operations.
+const (
+	ActionAdd    = "add"
+	ActionRemove = "remove"
+
+	RelationFriend   = "friend"
+	RelationFollower = "follower"
+)
+
+// PhemeBatchPost batch of phemes params.
+// @Description batch of phemes, created all or none when atomic
+type PhemeBatchPost struct {
+	Phemes []PhemeParamsPost `json:"phemes" validate:"required,min=1"`
+	Atomic bool              `json:"atomic"`
+}
+
+// PhemeBatchQuery ids of the phemes of a batch.
+type PhemeBatchQuery struct {
+	IDs []uint `query:"ids" validate:"required,min=1"`
+}
+
+// PhemeBatch phemes of a batch.
+// @Description phemes of a batch, and the IDs not found or not visible
+type PhemeBatch struct {
+	Phemes   []Pheme `json:"phemes"`
+	NotFound []uint  `json:"notFound"`
+}
+
+// RelationshipOperation relationship operation params.
+// @Description add or remove a friend or follower
+type RelationshipOperation struct {
+	Action   string `json:"action" validate:"required,oneof=add remove" example:"add"`
+	Relation string `json:"relation" validate:"required,oneof=friend follower" example:"friend"`
+	UserID   uint   `json:"userID" validate:"required"`
+}
+
+// RelationshipBatch batch of relationship operations params.
+// @Description batch of relationship operations, done all or none when atomic
+type RelationshipBatch struct {
+	Operations []RelationshipOperation `json:"operations" validate:"required,min=1"`
+	Atomic     bool                    `json:"atomic"`
+}
+
+// BatchResult results of the items of a batch.
+// @Description results of the items of a batch, in their order
+type BatchResult struct {
+	Results []BatchItem `json:"results"`
+}
+
+// BatchItem result of an item of a batch.
+// @Description result of an item of a batch, with the problem when it failed
+type BatchItem struct {
+	Index  int      `json:"index"`
+	Status int      `json:"status" example:"200"`
+	ID     uint     `json:"id,omitempty"`
+	Error  *Problem `json:"error,omitempty"`
+}
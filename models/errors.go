@@ -0,0 +1,98 @@
+package models
+
+import "errors"
+
+// The kinds of the domain errors, matched with errors.Is.
+var (
+	// ErrNotFound is returned when the record doesn't exist or is not visible for the user.
+	ErrNotFound = errors.New("not found")
+	// ErrUnauthenticated is returned when the request has no valid credentials.
+	ErrUnauthenticated = errors.New("unauthenticated")
+	// ErrForbidden is returned when the user is not allowed to do the operation.
+	ErrForbidden = errors.New("forbidden")
+	// ErrConflict is returned when the operation conflicts with the current state.
+	ErrConflict = errors.New("conflict")
+	// ErrValidation is returned when the input of the operation is not valid.
+	ErrValidation = errors.New("validation failed")
+	// ErrUnprocessable is returned when the input is valid but can't be processed.
+	ErrUnprocessable = errors.New("unprocessable")
+	// ErrTooManyRequests is returned when the client is over its rate limit.
+	ErrTooManyRequests = errors.New("too many requests")
+)
+
+// The domain errors with a stable code.
+var (
+	ErrPhemeNotFound     = NotFound("pheme_not_found", "The pheme doesn't exist or is not visible for the user")
+	ErrTokenNotFound     = NotFound("token_not_found", "The token doesn't exist")
+	ErrRoleNotGranted    = NotFound("role_not_granted", "The user doesn't have the role")
+	ErrDeletionNotFound  = NotFound("deletion_not_found", "The account is not scheduled for deletion")
+	ErrExportNotFound    = NotFound("export_not_found", "The export doesn't exist")
+	ErrReactionNotFound  = NotFound("reaction_not_found", "The user didn't react to the pheme")
+	ErrReplyNotFound     = Unprocessable("reply_not_found", "The pheme replied to doesn't exist or is not visible for the user")
+	ErrInvalidBody       = Invalid("invalid_body", "Invalid JSON body")
+	ErrInvalidParameters = Invalid("invalid_parameters", "Wrong parameters")
+	ErrNotFriends        = Forbidden("not_friends", "Cannot create phemes for non-friends users")
+	ErrPhemeModerated    = Forbidden("pheme_moderated", "The pheme was deleted by a moderator and can't be restored")
+)
+
+// Error is a domain error with a stable code for the clients and, for the
+// validation errors, the fields that failed.
+type Error struct {
+	// Kind is one of the ErrNotFound, ErrUnauthenticated, ErrForbidden,
+	// ErrConflict, ErrValidation, ErrUnprocessable or ErrTooManyRequests kinds.
+	Kind    error
+	Code    string
+	Message string
+	Fields  []FieldError
+}
+
+// FieldError is a field of the input that failed the validation.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// NotFound returns an error of the ErrNotFound kind.
+func NotFound(code string, message string) *Error {
+	return &Error{Kind: ErrNotFound, Code: code, Message: message}
+}
+
+// Unauthenticated returns an error of the ErrUnauthenticated kind.
+func Unauthenticated(code string, message string) *Error {
+	return &Error{Kind: ErrUnauthenticated, Code: code, Message: message}
+}
+
+// Forbidden returns an error of the ErrForbidden kind.
+func Forbidden(code string, message string) *Error {
+	return &Error{Kind: ErrForbidden, Code: code, Message: message}
+}
+
+// Conflict returns an error of the ErrConflict kind.
+func Conflict(code string, message string) *Error {
+	return &Error{Kind: ErrConflict, Code: code, Message: message}
+}
+
+// Invalid returns an error of the ErrValidation kind with the fields that failed.
+func Invalid(code string, message string, fields ...FieldError) *Error {
+	return &Error{Kind: ErrValidation, Code: code, Message: message, Fields: fields}
+}
+
+// Unprocessable returns an error of the ErrUnprocessable kind.
+func Unprocessable(code string, message string) *Error {
+	return &Error{Kind: ErrUnprocessable, Code: code, Message: message}
+}
+
+// TooManyRequests returns an error of the ErrTooManyRequests kind.
+func TooManyRequests(code string, message string) *Error {
+	return &Error{Kind: ErrTooManyRequests, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the kind of the error.
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
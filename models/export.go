@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// ExportStatus is the progress of an export.
+type ExportStatus string
+
+const (
+	// ExportPending exports are waiting for the background job to build them.
+	ExportPending ExportStatus = "pending"
+	// ExportRunning exports are claimed by the background job of a replica,
+	// which is building them.
+	ExportRunning ExportStatus = "running"
+	// ExportReady exports have their archive ready to download.
+	ExportReady ExportStatus = "ready"
+	// ExportFailed exports couldn't be built, a new one must be requested.
+	ExportFailed ExportStatus = "failed"
+)
+
+// Export model info
+// @Description Copy of the data of a user, built in the background as a ZIP archive
+type Export struct {
+	ID          uint         `json:"id"`
+	UserID      uint         `json:"userID" gorm:"not null;index"`
+	Status      ExportStatus `json:"status" gorm:"not null;index"`
+	Size        int64        `json:"size" gorm:"not null"`
+	CreatedAt   time.Time    `json:"createdAt" gorm:"not null;index"`
+	CompletedAt *time.Time   `json:"completedAt"`
+	// ClaimedAt is when the build started, the builds running for too long
+	// are claimed again.
+	ClaimedAt *time.Time `json:"-"`
+	Archive   []byte     `json:"-"`
+}
+
+// ExportParamsID parameter with the ID of an export
+type ExportParamsID struct {
+	ID uint `params:"id" validate:"required"`
+}
+
+// ExportData is the data of a user in an export.
+type ExportData struct {
+	User       User                  `json:"user"`
+	Phemes     []Pheme               `json:"phemes"`
+	Friends    []uint                `json:"friends"`
+	Followers  []uint                `json:"followers"`
+	Tokens     []PersonalAccessToken `json:"tokens"`
+	ExportedAt time.Time             `json:"exportedAt"`
+}
@@ -1,8 +0,0 @@
-package models
-
-import (
-	"github.com/feserr/pheme-user/database"
-)
-
-// Db global db var
-var Db = database.Connect()
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"time"
+)
+
+// IdempotencyKey is a request of a user with an Idempotency-Key header and,
+// once completed, its response, replayed to the retries until it expires.
+type IdempotencyKey struct {
+	ID          uint
+	UserID      uint   `gorm:"not null;uniqueIndex:idx_idempotency_keys_user_key"`
+	Key         string `gorm:"not null;uniqueIndex:idx_idempotency_keys_user_key"`
+	Fingerprint []byte `gorm:"not null"`
+	Status      int    `gorm:"not null"`
+	ContentType string `gorm:"not null"`
+	Body        []byte
+	CreatedAt   time.Time `gorm:"not null"`
+	ExpiresAt   time.Time `gorm:"not null;index"`
+}
+
+// RequestFingerprint returns the hash of a request, the retries with the same
+// key must have the same one.
+func RequestFingerprint(method string, path string, body []byte) []byte {
+	hash := sha256.New()
+	hash.Write([]byte(method + " " + path + "\n"))
+	hash.Write(body)
+	return hash.Sum(nil)
+}
+
+// Completed returns if the response of the request is stored.
+func (k IdempotencyKey) Completed() bool {
+	return k.Status != 0
+}
+
+// Expired returns if the key can be used again for another request.
+func (k IdempotencyKey) Expired(now time.Time) bool {
+	return !now.Before(k.ExpiresAt)
+}
+
+// Matches returns if the request has the fingerprint of the key.
+func (k IdempotencyKey) Matches(fingerprint []byte) bool {
+	return bytes.Equal(k.Fingerprint, fingerprint)
+}
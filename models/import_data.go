@@ -0,0 +1,36 @@
+package models
+
+// The formats of the imported archives.
+const (
+	ImportJSONLines = "jsonl"
+	ImportTwitter   = "twitter"
+)
+
+// ImportQuery options of an import.
+type ImportQuery struct {
+	// Format of the archive, jsonl or twitter.
+	Format string `query:"format"`
+	// Category of the phemes without one.
+	Category string `query:"category"`
+	// Categories renames the categories of the archive, e.g. news=News,dev=Development.
+	Categories string `query:"categories"`
+	// Visibility of the phemes without one, public, protected or private.
+	Visibility string `query:"visibility"`
+}
+
+// ImportReport result of an import.
+// @Description phemes imported, skipped as imported before and failed, with the error of every failed line
+type ImportReport struct {
+	Imported   int           `json:"imported"`
+	Duplicates int           `json:"duplicates"`
+	Failed     int           `json:"failed"`
+	Errors     []ImportError `json:"errors"`
+}
+
+// ImportError error of a line of an import.
+// @Description line of the archive that couldn't be imported, the position of the item for the JSON archives
+type ImportError struct {
+	Line    int    `json:"line"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
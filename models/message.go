@@ -5,6 +5,17 @@ type Message struct {
 	Message string `json:"message"`
 }
 
+// Problem JSON model of the errors, the RFC 7807 problem details
+type Problem struct {
+	Type     string       `json:"type" example:"about:blank"`
+	Title    string       `json:"title" example:"Not Found"`
+	Status   int          `json:"status" example:"404"`
+	Detail   string       `json:"detail,omitempty" example:"The pheme doesn't exist or is not visible for the user"`
+	Instance string       `json:"instance,omitempty" example:"/api/v1/pheme/1"`
+	Code     string       `json:"code" example:"pheme_not_found"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
 // StandardClaims from jwt
 type StandardClaims struct {
 	Audience  string `json:"aud,omitempty"`
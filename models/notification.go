@@ -0,0 +1,76 @@
+package models
+
+import "time"
+
+// NotificationType is the kind of a notification.
+type NotificationType string
+
+const (
+	// NotificationFriend notifies the user added as a friend.
+	NotificationFriend NotificationType = "friend"
+	// NotificationFollow notifies the user added as a follower.
+	NotificationFollow NotificationType = "follow"
+	// NotificationMention notifies the users mentioned by a pheme they can see.
+	NotificationMention NotificationType = "mention"
+	// NotificationReply notifies the author of a pheme replied to by a pheme
+	// they can see.
+	NotificationReply NotificationType = "reply"
+	// NotificationReaction notifies the author of a pheme a user reacted to.
+	NotificationReaction NotificationType = "reaction"
+)
+
+// NotificationTypes are the types the clients can subscribe to.
+var NotificationTypes = []NotificationType{
+	NotificationFriend,
+	NotificationFollow,
+	NotificationMention,
+	NotificationReply,
+	NotificationReaction,
+}
+
+// Notification model info
+// @Description Event pushed to the connected users
+type Notification struct {
+	Type NotificationType `json:"type"`
+	// UserID is the notified user.
+	UserID uint `json:"userID"`
+	// ActorID is the user that caused the notification.
+	ActorID uint   `json:"actorID"`
+	Pheme   *Pheme `json:"pheme,omitempty"`
+	// Reaction is the emoji of the reaction notifications.
+	Reaction  string    `json:"reaction,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// The actions of the notification requests.
+const (
+	NotificationSubscribe   = "subscribe"
+	NotificationUnsubscribe = "unsubscribe"
+)
+
+// NotificationRequest is a message of the clients, subscribing to or
+// unsubscribing from the types of notifications.
+type NotificationRequest struct {
+	Action string             `json:"action"`
+	Types  []NotificationType `json:"types"`
+}
+
+// The types of the notification messages.
+const (
+	// NotificationMessageNotification carries a notification.
+	NotificationMessageNotification = "notification"
+	// NotificationMessageSubscribed answers the requests with the types the
+	// client is subscribed to.
+	NotificationMessageSubscribed = "subscribed"
+	// NotificationMessageError answers the requests that failed.
+	NotificationMessageError = "error"
+)
+
+// NotificationMessage is a message of the server to the clients.
+type NotificationMessage struct {
+	Type         string             `json:"type"`
+	Notification *Notification      `json:"notification,omitempty"`
+	Types        []NotificationType `json:"types,omitempty"`
+	Code         string             `json:"code,omitempty"`
+	Message      string             `json:"message,omitempty"`
+}
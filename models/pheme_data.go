@@ -7,6 +7,15 @@ type PhemeParamsPost struct {
 	Category  string `json:"category" validate:"required"`
 	Text      string `json:"text" validate:"required"`
 	UserID    uint   `json:"userID" validate:"required"`
+	// ReplyTo is the pheme replied to, visible for the user. It is only set
+	// when the pheme is posted.
+	ReplyTo *uint `json:"replyTo,omitempty"`
+}
+
+// ReactionParams params
+// @Description reaction params
+type ReactionParams struct {
+	Emoji string `json:"emoji" validate:"required,max=32"`
 }
 
 // PhemeParamsID param
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Reaction model info
+// @Description Reaction of a user to a pheme
+type Reaction struct {
+	PhemeID   uint      `json:"phemeID" gorm:"primaryKey;autoIncrement:false"`
+	UserID    uint      `json:"userID" gorm:"primaryKey;autoIncrement:false;index"`
+	Emoji     string    `json:"emoji" gorm:"not null"`
+	CreatedAt time.Time `json:"createdAt" gorm:"not null"`
+}
+
+// TableName returns the table of the reactions.
+func (Reaction) TableName() string {
+	return "pheme_reactions"
+}
@@ -0,0 +1,166 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// PhemeRepository stores the phemes.
+type PhemeRepository interface {
+	// FetchAllPhemes returns all the phemes of a user, friends and followers with equal or higher visibility.
+	FetchAllPhemes(ctx context.Context, userID uint) ([]Pheme, error)
+	// FetchUserPhemes returns all the phemes of the user with equal or higher visibility.
+	FetchUserPhemes(ctx context.Context, userID uint, visibility byte) ([]Pheme, error)
+	// FetchPheme returns the pheme if is visible for the user.
+	FetchPheme(ctx context.Context, phemeID uint, userID uint) (Pheme, error)
+	// FindPheme returns the pheme of any user, unless it is trashed.
+	FindPheme(ctx context.Context, phemeID uint) (Pheme, error)
+	// FetchPhemes returns the phemes of the IDs visible for the user, skipping the others.
+	FetchPhemes(ctx context.Context, phemeIDs []uint, userID uint) ([]Pheme, error)
+	// CreatePheme adds a pheme, returns 0 if the author is not a friend of the user.
+	CreatePheme(ctx context.Context, pheme Pheme) (uint, error)
+	// DeletePheme moves a pheme of a user to the trash, returns the trashed pheme.
+	DeletePheme(ctx context.Context, phemeID uint, userID uint) (Pheme, error)
+	// DeletePhemeByID moves a pheme of any user to the trash for the moderator,
+	// returns the trashed pheme.
+	DeletePhemeByID(ctx context.Context, phemeID uint, moderatorID uint) (Pheme, error)
+	// FetchTrash returns the trashed phemes of a user, the last trashed first.
+	FetchTrash(ctx context.Context, userID uint) ([]Pheme, error)
+	// RestorePheme moves a pheme of a user out of the trash, unless another
+	// user moved it there.
+	RestorePheme(ctx context.Context, phemeID uint, userID uint) (Pheme, error)
+	// PurgeTrash removes for good the phemes trashed before the time.
+	PurgeTrash(ctx context.Context, before time.Time) (int64, error)
+	// ImportPhemes adds the imported phemes, skipping the ones with the import
+	// key of a pheme of the user, returns the number of added phemes.
+	ImportPhemes(ctx context.Context, phemes []Pheme) (int, error)
+	// FetchPersonalPhemes returns all the phemes authored or received by a
+	// user, the trashed ones included.
+	FetchPersonalPhemes(ctx context.Context, userID uint) ([]Pheme, error)
+	// UpdatePheme updates the data of a pheme created by the user.
+	UpdatePheme(ctx context.Context, pheme PhemeParamsPost, phemeID uint, userID uint) (Pheme, error)
+}
+
+// UserRepository stores the users, their relationships and roles.
+type UserRepository interface {
+	// FindAuthUser returns the user with its roles.
+	FindAuthUser(ctx context.Context, userID uint) (User, error)
+	// FindByID returns the user from the ID.
+	FindByID(ctx context.Context, userID uint) (User, error)
+	// FindByName returns the users that contains the name.
+	FindByName(ctx context.Context, userName string) ([]User, error)
+	// DeleteByID deletes the user by the ID with all its phemes, authored and
+	// received, reactions, relationships, roles, tokens, idempotency keys and
+	// exports.
+	DeleteByID(ctx context.Context, userID uint) error
+	// IsFriend returns if it is friend or not.
+	IsFriend(ctx context.Context, userID uint, friendID uint) (bool, error)
+	// GetFriends returns the friends of a user.
+	GetFriends(ctx context.Context, userID uint) ([]uint, error)
+	// GetFollowers returns the followers of a user.
+	GetFollowers(ctx context.Context, userID uint) ([]uint, error)
+	// AddFriend adds a friend to a user.
+	AddFriend(ctx context.Context, userID uint, friendID uint) error
+	// AddFollower adds a follower to a user.
+	AddFollower(ctx context.Context, userID uint, followerID uint) error
+	// RemoveFriend removes a friend of a user.
+	RemoveFriend(ctx context.Context, userID uint, friendID uint) error
+	// RemoveFollower removes a follower of a user.
+	RemoveFollower(ctx context.Context, userID uint, followerID uint) error
+	// GetRoles returns the roles granted to a user.
+	GetRoles(ctx context.Context, userID uint) ([]UserRole, error)
+	// GrantRole grants a role to a user.
+	GrantRole(ctx context.Context, userID uint, role Role, grantedBy uint) error
+	// RevokeRole revokes a role from a user.
+	RevokeRole(ctx context.Context, userID uint, role Role) error
+}
+
+// TokenRepository stores the personal access tokens.
+type TokenRepository interface {
+	// CreateToken adds a personal access token.
+	CreateToken(ctx context.Context, token PersonalAccessToken) (PersonalAccessToken, error)
+	// FetchTokens returns the personal access tokens of a user.
+	FetchTokens(ctx context.Context, userID uint) ([]PersonalAccessToken, error)
+	// FindTokenByHash returns the personal access token with the hash.
+	FindTokenByHash(ctx context.Context, hash []byte) (PersonalAccessToken, error)
+	// TouchToken records the last time the token was used.
+	TouchToken(ctx context.Context, tokenID uint, usedAt time.Time) error
+	// DeleteToken revokes a personal access token of a user.
+	DeleteToken(ctx context.Context, tokenID uint, userID uint) (uint, error)
+}
+
+// IdempotencyRepository stores the requests with an Idempotency-Key and their responses.
+type IdempotencyRepository interface {
+	// ReserveIdempotencyKey stores the key of a request in flight, unless the
+	// user has it and it is not expired: then it returns that one and false.
+	// The key of a request in flight expires at the end of its lease.
+	ReserveIdempotencyKey(ctx context.Context, key IdempotencyKey) (IdempotencyKey, bool, error)
+	// CompleteIdempotencyKey stores the response of the request of the key
+	// and its expiration.
+	CompleteIdempotencyKey(ctx context.Context, key IdempotencyKey) error
+	// ReleaseIdempotencyKey removes the key, so the request can be retried.
+	ReleaseIdempotencyKey(ctx context.Context, keyID uint) error
+	// DeleteExpiredIdempotencyKeys removes the keys expired at the time.
+	DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error)
+}
+
+// AccountDeletionRepository stores the scheduled deletions of the accounts.
+type AccountDeletionRepository interface {
+	// ScheduleAccountDeletion schedules the deletion of the account of a user,
+	// unless it is already scheduled: then it returns that one.
+	ScheduleAccountDeletion(ctx context.Context, deletion AccountDeletion) (AccountDeletion, error)
+	// FindAccountDeletion returns the scheduled deletion of the account of a user.
+	FindAccountDeletion(ctx context.Context, userID uint) (AccountDeletion, error)
+	// CancelAccountDeletion cancels the scheduled deletion of the account of a user.
+	CancelAccountDeletion(ctx context.Context, userID uint) error
+	// DueAccountDeletions returns up to limit deletions scheduled before the time.
+	DueAccountDeletions(ctx context.Context, now time.Time, limit int) ([]AccountDeletion, error)
+}
+
+// ReactionRepository stores the reactions of the users to the phemes.
+type ReactionRepository interface {
+	// SetReaction adds the reaction of the user to the pheme or replaces the
+	// previous one, returns false if the user already had that one.
+	SetReaction(ctx context.Context, reaction Reaction) (bool, error)
+	// DeleteReaction removes the reaction of the user to the pheme.
+	DeleteReaction(ctx context.Context, phemeID uint, userID uint) error
+	// FetchReactions returns the reactions to the pheme, the oldest first.
+	FetchReactions(ctx context.Context, phemeID uint) ([]Reaction, error)
+}
+
+// ExportRepository stores the exports of the data of the users.
+type ExportRepository interface {
+	// CreateExport adds an export of a user, unless one is pending or
+	// running: then it returns that one.
+	CreateExport(ctx context.Context, export Export) (Export, error)
+	// FindExport returns an export of a user, without its archive.
+	FindExport(ctx context.Context, exportID uint, userID uint) (Export, error)
+	// FetchExportArchive returns the archive of a ready export of a user.
+	FetchExportArchive(ctx context.Context, exportID uint, userID uint) ([]byte, error)
+	// ClaimExports marks up to limit exports as running since now and returns
+	// them, the oldest first: the pending ones and the running ones claimed
+	// before stale, whose build was lost. An export is only claimed by one
+	// caller at once.
+	ClaimExports(ctx context.Context, now time.Time, stale time.Time, limit int) ([]Export, error)
+	// CompleteExport stores the status, size and archive of an export, unless
+	// it was claimed again since its claim: then it returns false.
+	CompleteExport(ctx context.Context, export Export) (bool, error)
+	// DeleteExports removes the exports created before the time.
+	DeleteExports(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Transactor runs the operations of the repositories in a transaction.
+type Transactor interface {
+	// Transaction runs fn in a transaction, committed if it returns nil and
+	// rolled back otherwise. The repositories called with the context of fn
+	// take part in the transaction.
+	Transaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// Backfiller upgrades all the records written with an older version of the schema.
+type Backfiller interface {
+	// BackfillPhemes upgrades the phemes in batches and reports the progress after each one.
+	BackfillPhemes(ctx context.Context, batchSize int, report func(BackfillProgress)) error
+	// BackfillUsers upgrades the users in batches and reports the progress after each one.
+	BackfillUsers(ctx context.Context, batchSize int, report func(BackfillProgress)) error
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// Role of a user.
+type Role string
+
+// Permission granted by a role.
+type Permission string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+const (
+	PermissionPhemesRead         Permission = "phemes:read"
+	PermissionPhemesWrite        Permission = "phemes:write"
+	PermissionPhemesModerate     Permission = "phemes:moderate"
+	PermissionUsersRead          Permission = "users:read"
+	PermissionRelationshipsWrite Permission = "relationships:write"
+	PermissionRolesManage        Permission = "roles:manage"
+)
+
+// rolePermissions maps every role to the permissions it grants.
+var rolePermissions = map[Role][]Permission{
+	RoleUser: {
+		PermissionPhemesRead,
+		PermissionPhemesWrite,
+		PermissionUsersRead,
+		PermissionRelationshipsWrite,
+	},
+	RoleModerator: {
+		PermissionPhemesModerate,
+	},
+	RoleAdmin: {
+		PermissionPhemesModerate,
+		PermissionRolesManage,
+	},
+}
+
+// adminEmails are the emails of the users that are always admins.
+var adminEmails = []string{}
+
+// SetAdminEmails sets the emails of the users that are always admins.
+func SetAdminEmails(emails []string) {
+	adminEmails = emails
+}
+
+// UserRole model info
+// @Description Role granted to a user
+type UserRole struct {
+	UserID    uint      `json:"userID" gorm:"primaryKey"`
+	Role      Role      `json:"role" gorm:"primaryKey;type:varchar(32)"`
+	GrantedBy uint      `json:"grantedBy" gorm:"not null"`
+	CreatedAt time.Time `json:"createdAt" gorm:"not null"`
+}
+
+// ParseRole returns the role with that name.
+func ParseRole(name string) (Role, error) {
+	role := Role(name)
+	if _, ok := rolePermissions[role]; !ok {
+		return role, errors.New("unknown role")
+	}
+
+	return role, nil
+}
+
+// RoleList returns the roles of the user, including the implicit user role.
+func (u User) RoleList() []Role {
+	roles := []Role{RoleUser}
+	for _, userRole := range u.Roles {
+		if userRole.Role != RoleUser {
+			roles = append(roles, userRole.Role)
+		}
+	}
+
+	if u.Email != "" {
+		for _, email := range adminEmails {
+			if email == u.Email {
+				roles = append(roles, RoleAdmin)
+				break
+			}
+		}
+	}
+
+	return roles
+}
+
+// Can returns if any of the roles of the user grants the permission.
+func (u User) Can(permission Permission) bool {
+	for _, role := range u.RoleList() {
+		for _, granted := range rolePermissions[role] {
+			if granted == permission {
+				return true
+			}
+		}
+	}
+
+	return false
+}
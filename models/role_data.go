@@ -0,0 +1,8 @@
+package models
+
+// RoleParams user id and role params.
+// @Description role params
+type RoleParams struct {
+	ID   uint   `query:"id" validate:"required"`
+	Role string `query:"role" validate:"required"`
+}
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TokenPrefix starts every personal access token, to tell them apart from JWTs.
+const TokenPrefix = "pheme_"
+
+// tokenLastUsedInterval is the minimum time between two updates of the last used time.
+const tokenLastUsedInterval = time.Minute
+
+// TokenScopes are the permissions that can be granted to a personal access token.
+var TokenScopes = []Permission{
+	PermissionPhemesRead,
+	PermissionPhemesWrite,
+	PermissionUsersRead,
+	PermissionRelationshipsWrite,
+}
+
+// PersonalAccessToken model info
+// @Description Long-lived token of a user
+type PersonalAccessToken struct {
+	ID         uint         `json:"id"`
+	UserID     uint         `json:"userID" gorm:"not null;index"`
+	Name       string       `json:"name" gorm:"not null"`
+	Prefix     string       `json:"prefix" gorm:"not null"`
+	Hash       []byte       `json:"-" gorm:"not null;uniqueIndex"`
+	ScopeList  string       `json:"-" gorm:"column:scopes;not null"`
+	Scopes     []Permission `json:"scopes" gorm:"-"`
+	CreatedAt  time.Time    `json:"createdAt" gorm:"not null"`
+	ExpiresAt  *time.Time   `json:"expiresAt"`
+	LastUsedAt *time.Time   `json:"lastUsedAt"`
+}
+
+// BeforeSave stores the scopes as a comma separated list.
+func (t *PersonalAccessToken) BeforeSave(tx *gorm.DB) error {
+	scopes := make([]string, len(t.Scopes))
+	for i, scope := range t.Scopes {
+		scopes[i] = string(scope)
+	}
+
+	t.ScopeList = strings.Join(scopes, ",")
+	return nil
+}
+
+// AfterFind loads the scopes from the comma separated list.
+func (t *PersonalAccessToken) AfterFind(tx *gorm.DB) error {
+	t.Scopes = []Permission{}
+	for _, scope := range strings.Split(t.ScopeList, ",") {
+		if scope != "" {
+			t.Scopes = append(t.Scopes, Permission(scope))
+		}
+	}
+
+	return nil
+}
+
+// ParseScope returns the token scope with that name.
+func ParseScope(name string) (Permission, error) {
+	for _, scope := range TokenScopes {
+		if string(scope) == name {
+			return scope, nil
+		}
+	}
+
+	return Permission(name), errors.New("unknown scope")
+}
+
+// HashToken returns the hash stored for a personal access token value.
+func HashToken(value string) []byte {
+	hash := sha256.Sum256([]byte(value))
+	return hash[:]
+}
+
+// Generate sets a new random value to the token and returns it, only its hash
+// and prefix are stored.
+func (t *PersonalAccessToken) Generate() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+
+	value := TokenPrefix + base64.RawURLEncoding.EncodeToString(bytes)
+	t.Hash = HashToken(value)
+	t.Prefix = value[:len(TokenPrefix)+6]
+
+	return value, nil
+}
+
+// Expired returns if the token can't be used anymore.
+func (t PersonalAccessToken) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && now.After(*t.ExpiresAt)
+}
+
+// NeedsTouch returns if the last used time of the token is stale.
+func (t PersonalAccessToken) NeedsTouch(now time.Time) bool {
+	return t.LastUsedAt == nil || now.Sub(*t.LastUsedAt) > tokenLastUsedInterval
+}
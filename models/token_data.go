@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// TokenParamsNew new personal access token params.
+// @Description token params
+type TokenParamsNew struct {
+	Name      string     `json:"name" validate:"required"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// TokenParamsID token id param.
+// @Description id param
+type TokenParamsID struct {
+	ID uint `json:"id" query:"id" validate:"required"`
+}
+
+// TokenCreated new personal access token, the only time its value is returned.
+// @Description created token
+type TokenCreated struct {
+	PersonalAccessToken
+	Token string `json:"token"`
+}
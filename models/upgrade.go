@@ -0,0 +1,58 @@
+package models
+
+import "fmt"
+
+// Upgrades transform the records written with an older version of the
+// schema, with a step from each version to the next one.
+type Upgrades[T any] struct {
+	base  uint
+	steps []func(record *T) error
+}
+
+// NewUpgrades returns the upgrades of the records starting at the base version.
+func NewUpgrades[T any](base uint) *Upgrades[T] {
+	return &Upgrades[T]{base: base}
+}
+
+// Register adds the step upgrading the records from the latest version to the
+// next one, which becomes the latest.
+func (u *Upgrades[T]) Register(step func(record *T) error) {
+	u.steps = append(u.steps, step)
+}
+
+// Latest returns the current version of the records.
+func (u *Upgrades[T]) Latest() uint {
+	return u.base + uint(len(u.steps))
+}
+
+// Apply runs the steps from the version of the record to the latest one and
+// updates the version, returns if the record was upgraded. The records without
+// version are upgraded from the base one.
+func (u *Upgrades[T]) Apply(record *T, version *uint) (bool, error) {
+	if *version >= u.Latest() {
+		return false, nil
+	}
+
+	from := *version
+	if from < u.base {
+		from = u.base
+	}
+
+	for v := from; v < u.Latest(); v++ {
+		if err := u.steps[v-u.base](record); err != nil {
+			return false, fmt.Errorf("upgrade from version %d: %w", v, err)
+		}
+	}
+
+	*version = u.Latest()
+	return true, nil
+}
+
+// BackfillProgress is the progress of the upgrade of the records of a table.
+type BackfillProgress struct {
+	Table    string
+	Total    int64
+	Done     int64
+	Upgraded int64
+	Failed   int64
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestUpgrades(t *testing.T) {
+	upgrades := NewUpgrades[Pheme](1)
+	upgrades.Register(func(pheme *Pheme) error {
+		pheme.Category = strings.ToLower(pheme.Category)
+		return nil
+	})
+	upgrades.Register(func(pheme *Pheme) error {
+		pheme.Text = strings.TrimSpace(pheme.Text)
+		return nil
+	})
+
+	if upgrades.Latest() != 3 {
+		t.Fatalf("got latest version %d, want 3", upgrades.Latest())
+	}
+
+	tests := []struct {
+		name     string
+		pheme    Pheme
+		upgraded bool
+		want     Pheme
+	}{
+		{"base", Pheme{Version: 1, Category: "News", Text: " hi "}, true, Pheme{Version: 3, Category: "news", Text: "hi"}},
+		{"middle", Pheme{Version: 2, Category: "News", Text: " hi "}, true, Pheme{Version: 3, Category: "News", Text: "hi"}},
+		{"latest", Pheme{Version: 3, Category: "News", Text: " hi "}, false, Pheme{Version: 3, Category: "News", Text: " hi "}},
+		{"without version", Pheme{Category: "News", Text: " hi "}, true, Pheme{Version: 3, Category: "news", Text: "hi"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pheme := test.pheme
+			upgraded, err := upgrades.Apply(&pheme, &pheme.Version)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if upgraded != test.upgraded || pheme != test.want {
+				t.Errorf("got %v %+v, want %v %+v", upgraded, pheme, test.upgraded, test.want)
+			}
+		})
+	}
+}
+
+func TestUpgradesError(t *testing.T) {
+	errStep := errors.New("broken")
+
+	upgrades := NewUpgrades[User](1)
+	upgrades.Register(func(user *User) error { return errStep })
+
+	user := User{Version: 1}
+	if _, err := upgrades.Apply(&user, &user.Version); !errors.Is(err, errStep) {
+		t.Errorf("got error %v, want %v", err, errStep)
+	}
+
+	if user.Version != 1 {
+		t.Errorf("got version %d after a failed upgrade, want 1", user.Version)
+	}
+}
@@ -7,3 +7,16 @@ const (
 	PROTECTED visibilty = 175
 	PRIVATE   visibilty = 0
 )
+
+// visibilities are the visibilities by name.
+var visibilities = map[string]visibilty{
+	"public":    PUBLIC,
+	"protected": PROTECTED,
+	"private":   PRIVATE,
+}
+
+// ParseVisibility returns the visibility with the name.
+func ParseVisibility(name string) (byte, bool) {
+	visibility, ok := visibilities[name]
+	return byte(visibility), ok
+}
@@ -0,0 +1,346 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	"github.com/feserr/pheme-user/models"
+	"golang.org/x/exp/slog"
+)
+
+// topic is the topic of the pub/sub carrying the notifications.
+const topic = "notifications"
+
+// maxRequestSize is the maximum size of the messages of the clients.
+const maxRequestSize = 4096
+
+// maxQueuedJobs is the maximum jobs waiting to prepare notifications.
+const maxQueuedJobs = 1024
+
+// The close codes of the connections closed by the hub.
+const (
+	// closeLagging closes the clients not reading their notifications.
+	closeLagging = 4008
+)
+
+// Hub delivers the notifications published by every replica to the users
+// connected to this one, on any number of connections per user.
+type Hub struct {
+	pubsub PubSub
+	logger *slog.Logger
+	// ping is the time between the pings, the clients not answering them or
+	// not reading a write for two are dropped.
+	ping time.Duration
+	// buffer is the number of notifications queued for every connection.
+	buffer int
+	// jobs prepare notifications in the background of Run, so the requests
+	// don't wait for them.
+	jobs chan func(ctx context.Context)
+
+	mu      sync.RWMutex
+	clients map[uint]map[*client]bool
+}
+
+// NewHub returns a hub delivering the notifications of the pub/sub.
+func NewHub(pubsub PubSub, ping time.Duration, buffer int, logger *slog.Logger) *Hub {
+	return &Hub{
+		pubsub:  pubsub,
+		logger:  logger,
+		ping:    ping,
+		buffer:  buffer,
+		jobs:    make(chan func(ctx context.Context), maxQueuedJobs),
+		clients: map[uint]map[*client]bool{},
+	}
+}
+
+// Run delivers the notifications to the connected clients and runs the queued
+// jobs until the context is done, then closes their connections.
+func (h *Hub) Run(ctx context.Context) error {
+	worked := make(chan struct{})
+	go func() {
+		defer close(worked)
+		h.work(ctx)
+	}()
+
+	err := h.pubsub.Subscribe(ctx, topic, h.deliver)
+	<-worked
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, clients := range h.clients {
+		for client := range clients {
+			client.close(websocket.CloseGoingAway, "The server is shutting down")
+		}
+	}
+
+	return err
+}
+
+// Notify publishes the notification to the hubs of all the replicas.
+func (h *Hub) Notify(ctx context.Context, notification models.Notification) error {
+	message, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	return h.pubsub.Publish(ctx, topic, message)
+}
+
+// Queue runs the job in the background of Run with its context, returns false
+// when too many jobs are waiting: then the job is dropped.
+func (h *Hub) Queue(job func(ctx context.Context)) bool {
+	select {
+	case h.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// work runs the queued jobs, one at a time, until the context is done.
+func (h *Hub) work(ctx context.Context) {
+	for {
+		select {
+		case job := <-h.jobs:
+			job(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// deliver queues the published notification to the clients of its user
+// subscribed to its type. The clients with a full queue are dropped instead
+// of blocking the others.
+func (h *Hub) deliver(message []byte) {
+	var notification models.Notification
+	if err := json.Unmarshal(message, &notification); err != nil {
+		h.logger.Error("failed to decode the notification", "error", err)
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var encoded []byte
+	for client := range h.clients[notification.UserID] {
+		if !client.subscribed(notification.Type) {
+			continue
+		}
+
+		if encoded == nil {
+			var err error
+			encoded, err = json.Marshal(models.NotificationMessage{Type: models.NotificationMessageNotification, Notification: &notification})
+			if err != nil {
+				h.logger.Error("failed to encode the notification", "error", err)
+				return
+			}
+		}
+
+		if !client.send(encoded) {
+			client.close(closeLagging, "The notifications were not read")
+		}
+	}
+}
+
+// Serve pushes the notifications of the user to the connection and answers
+// its requests, until it is closed.
+func (h *Hub) Serve(conn *websocket.Conn, userID uint) {
+	c := &client{
+		types: map[models.NotificationType]bool{},
+		queue: make(chan []byte, h.buffer),
+		done:  make(chan struct{}),
+	}
+
+	h.mu.Lock()
+	if h.clients[userID] == nil {
+		h.clients[userID] = map[*client]bool{}
+	}
+	h.clients[userID][c] = true
+	h.mu.Unlock()
+
+	defer func() {
+		h.mu.Lock()
+		delete(h.clients[userID], c)
+		if len(h.clients[userID]) == 0 {
+			delete(h.clients, userID)
+		}
+		h.mu.Unlock()
+	}()
+
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		h.write(conn, c)
+	}()
+
+	h.read(conn, c)
+	c.close(websocket.CloseNormalClosure, "")
+	<-written
+}
+
+// read answers the requests of the client until the connection fails.
+func (h *Hub) read(conn *websocket.Conn, client *client) {
+	conn.SetReadLimit(maxRequestSize)
+	conn.SetReadDeadline(time.Now().Add(2 * h.ping))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * h.ping))
+	})
+
+	for {
+		var request models.NotificationRequest
+		if err := conn.ReadJSON(&request); err != nil {
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			if !errors.As(err, &syntaxErr) && !errors.As(err, &typeErr) {
+				return
+			}
+
+			client.answer(h.logger, models.NotificationMessage{Type: models.NotificationMessageError, Code: "invalid_message", Message: "The message must be a JSON request"})
+			continue
+		}
+
+		client.answer(h.logger, client.handle(request))
+	}
+}
+
+// write sends the queued messages and the pings to the client until it is
+// closed, then closes the connection.
+func (h *Hub) write(conn *websocket.Conn, client *client) {
+	ping := time.NewTicker(h.ping)
+	defer ping.Stop()
+
+	for {
+		select {
+		case message := <-client.queue:
+			conn.SetWriteDeadline(time.Now().Add(2 * h.ping))
+			if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				conn.Close()
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(2*h.ping)); err != nil {
+				conn.Close()
+				return
+			}
+		case <-client.done:
+			code, reason := client.closeReason()
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+			conn.Close()
+			return
+		}
+	}
+}
+
+// client is a connection of a user.
+type client struct {
+	queue chan []byte
+	done  chan struct{}
+
+	mu     sync.Mutex
+	types  map[models.NotificationType]bool
+	closed bool
+	code   int
+	reason string
+}
+
+// handle changes the subscriptions of the client, returns the answer.
+func (c *client) handle(request models.NotificationRequest) models.NotificationMessage {
+	if request.Action != models.NotificationSubscribe && request.Action != models.NotificationUnsubscribe {
+		return models.NotificationMessage{Type: models.NotificationMessageError, Code: "invalid_action", Message: "The action must be subscribe or unsubscribe"}
+	}
+
+	for _, notificationType := range request.Types {
+		if !knownType(notificationType) {
+			return models.NotificationMessage{Type: models.NotificationMessageError, Code: "invalid_type", Message: "Unknown notification type " + string(notificationType)}
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, notificationType := range request.Types {
+		if request.Action == models.NotificationSubscribe {
+			c.types[notificationType] = true
+		} else {
+			delete(c.types, notificationType)
+		}
+	}
+
+	types := []models.NotificationType{}
+	for _, notificationType := range models.NotificationTypes {
+		if c.types[notificationType] {
+			types = append(types, notificationType)
+		}
+	}
+
+	return models.NotificationMessage{Type: models.NotificationMessageSubscribed, Types: types}
+}
+
+// subscribed returns if the client is subscribed to the type.
+func (c *client) subscribed(notificationType models.NotificationType) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.types[notificationType]
+}
+
+// answer queues the answer to a request of the client.
+func (c *client) answer(logger *slog.Logger, message models.NotificationMessage) {
+	encoded, err := json.Marshal(message)
+	if err != nil {
+		logger.Error("failed to encode the answer", "error", err)
+		return
+	}
+
+	if !c.send(encoded) {
+		c.close(closeLagging, "The notifications were not read")
+	}
+}
+
+// send queues the message, returns false when the queue is full.
+func (c *client) send(message []byte) bool {
+	select {
+	case c.queue <- message:
+		return true
+	default:
+		return false
+	}
+}
+
+// close stops the client, the first reason is sent in the close message.
+func (c *client) close(code int, reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.closed {
+		c.closed = true
+		c.code = code
+		c.reason = reason
+		close(c.done)
+	}
+}
+
+// closeReason returns the reason the client was closed with.
+func (c *client) closeReason() (int, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.code, c.reason
+}
+
+// knownType returns if the notification type exists.
+func knownType(notificationType models.NotificationType) bool {
+	for _, known := range models.NotificationTypes {
+		if known == notificationType {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,48 @@
+package notify
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/feserr/pheme-user/logging"
+)
+
+func TestHubQueue(t *testing.T) {
+	hub := NewHub(NewMemory(), time.Second, 8, logging.Discard())
+
+	// The jobs wait for Run, up to the maximum.
+	ran := make(chan error, maxQueuedJobs)
+	for i := 0; i < maxQueuedJobs; i++ {
+		if !hub.Queue(func(ctx context.Context) { ran <- ctx.Err() }) {
+			t.Fatalf("job %d dropped, want it queued", i)
+		}
+	}
+	if hub.Queue(func(ctx context.Context) {}) {
+		t.Error("got the job queued, want it dropped with a full queue")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- hub.Run(ctx)
+	}()
+
+	for i := 0; i < maxQueuedJobs; i++ {
+		select {
+		case err := <-ran:
+			if err != nil {
+				t.Fatalf("got the job context done: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("ran %d jobs, want %d", i, maxQueuedJobs)
+		}
+	}
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Error("the hub is still running after the context is done")
+	}
+}
@@ -0,0 +1,76 @@
+// Package notify pushes the notifications to the users connected by WebSocket.
+package notify
+
+import (
+	"context"
+	"sync"
+)
+
+// PubSub carries the notifications between the hubs of the replicas. The
+// client of go-redis satisfies it with:
+//
+//	func (p pubSub) Publish(ctx context.Context, topic string, message []byte) error {
+//		return p.client.Publish(ctx, topic, message).Err()
+//	}
+//
+//	func (p pubSub) Subscribe(ctx context.Context, topic string, handler func(message []byte)) error {
+//		subscription := p.client.Subscribe(ctx, topic)
+//		defer subscription.Close()
+//		for {
+//			message, err := subscription.ReceiveMessage(ctx)
+//			if err != nil {
+//				return err
+//			}
+//			handler([]byte(message.Payload))
+//		}
+//	}
+type PubSub interface {
+	// Publish sends the message to the subscribers of the topic.
+	Publish(ctx context.Context, topic string, message []byte) error
+	// Subscribe calls the handler with the messages published to the topic,
+	// until the context is done.
+	Subscribe(ctx context.Context, topic string, handler func(message []byte)) error
+}
+
+// Memory delivers the messages within the process, to the hub of a single
+// replica.
+type Memory struct {
+	mu       sync.RWMutex
+	handlers map[string]map[*func(message []byte)]bool
+}
+
+// NewMemory returns an empty pub/sub.
+func NewMemory() *Memory {
+	return &Memory{handlers: map[string]map[*func(message []byte)]bool{}}
+}
+
+// Publish calls the handlers subscribed to the topic.
+func (m *Memory) Publish(ctx context.Context, topic string, message []byte) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for handler := range m.handlers[topic] {
+		(*handler)(message)
+	}
+
+	return nil
+}
+
+// Subscribe calls the handler with the messages of the topic until the
+// context is done.
+func (m *Memory) Subscribe(ctx context.Context, topic string, handler func(message []byte)) error {
+	m.mu.Lock()
+	if m.handlers[topic] == nil {
+		m.handlers[topic] = map[*func(message []byte)]bool{}
+	}
+	m.handlers[topic][&handler] = true
+	m.mu.Unlock()
+
+	<-ctx.Done()
+
+	m.mu.Lock()
+	delete(m.handlers[topic], &handler)
+	m.mu.Unlock()
+
+	return ctx.Err()
+}
@@ -0,0 +1,50 @@
+package notify
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemory(t *testing.T) {
+	pubsub := NewMemory()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	received := make(chan string, 2)
+	subscribed := make(chan error, 1)
+	go func() {
+		subscribed <- pubsub.Subscribe(ctx, "topic", func(message []byte) {
+			received <- string(message)
+		})
+	}()
+
+	// The subscription is registered in the background.
+	deadline := time.Now().Add(time.Second)
+	for {
+		if err := pubsub.Publish(context.Background(), "topic", []byte("first")); err != nil {
+			t.Fatal(err)
+		}
+		if len(received) > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if message := <-received; message != "first" {
+		t.Errorf("got %q, want first", message)
+	}
+
+	if err := pubsub.Publish(context.Background(), "other", []byte("other")); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 0 {
+		t.Errorf("got %q, want only the messages of the topic", <-received)
+	}
+
+	cancel()
+	if err := <-subscribed; err != context.Canceled {
+		t.Errorf("got %v, want the subscription canceled", err)
+	}
+	if err := pubsub.Publish(context.Background(), "topic", []byte("late")); err != nil || len(received) != 0 {
+		t.Errorf("got %d messages, %v, want none after the cancellation", len(received), err)
+	}
+}
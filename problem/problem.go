@@ -0,0 +1,102 @@
+// Package problem writes the errors as RFC 7807 problem details
+package problem
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/feserr/pheme-user/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// ContentType is the media type of the problem details.
+const ContentType = "application/problem+json"
+
+// kinds maps the kinds of the domain errors to their status and default code.
+var kinds = []struct {
+	kind   error
+	status int
+	code   string
+}{
+	{models.ErrNotFound, fiber.StatusNotFound, "not_found"},
+	{models.ErrUnauthenticated, fiber.StatusUnauthorized, "unauthenticated"},
+	{models.ErrForbidden, fiber.StatusForbidden, "forbidden"},
+	{models.ErrConflict, fiber.StatusConflict, "conflict"},
+	{models.ErrValidation, fiber.StatusBadRequest, "validation_failed"},
+	{models.ErrUnprocessable, fiber.StatusUnprocessableEntity, "unprocessable"},
+	{models.ErrTooManyRequests, fiber.StatusTooManyRequests, "too_many_requests"},
+}
+
+// Status returns the HTTP status of the error: the one of its kind for the
+// domain errors, the code of the Fiber errors and 500 for the rest.
+func Status(err error) int {
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return fiberErr.Code
+	}
+
+	for _, kind := range kinds {
+		if errors.Is(err, kind.kind) {
+			return kind.status
+		}
+	}
+
+	return fiber.StatusInternalServerError
+}
+
+// New returns the problem details of the error of the request. The message of
+// the unexpected errors is not disclosed.
+func New(c *fiber.Ctx, err error) models.Problem {
+	problem := Of(err)
+	problem.Instance = c.Path()
+
+	return problem
+}
+
+// Of returns the problem details of the error without the request, e.g. for
+// the items of a batch.
+func Of(err error) models.Problem {
+	status := Status(err)
+	problem := models.Problem{
+		Type:   "about:blank",
+		Title:  utils.StatusMessage(status),
+		Status: status,
+		Code:   "internal_error",
+	}
+
+	var domainErr *models.Error
+	var fiberErr *fiber.Error
+	switch {
+	case errors.As(err, &domainErr):
+		problem.Code = domainErr.Code
+		problem.Detail = domainErr.Message
+		problem.Errors = domainErr.Fields
+	case errors.As(err, &fiberErr):
+		// e.g. method_not_allowed or request_entity_too_large.
+		problem.Code = strings.ReplaceAll(strings.ToLower(problem.Title), " ", "_")
+		problem.Detail = fiberErr.Message
+	default:
+		for _, kind := range kinds {
+			if errors.Is(err, kind.kind) {
+				problem.Code = kind.code
+				problem.Detail = err.Error()
+				break
+			}
+		}
+	}
+
+	return problem
+}
+
+// Handler is the error handler of the app, it writes the errors returned by
+// the handlers and middlewares as problem details.
+func Handler(c *fiber.Ctx, err error) error {
+	problem := New(c, err)
+	if err := c.Status(problem.Status).JSON(problem); err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, ContentType)
+
+	return nil
+}
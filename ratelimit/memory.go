@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is the minimum time between two removals of the full buckets.
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	policy  Policy
+}
+
+// Memory keeps the buckets in memory, they are not shared by the replicas.
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemory returns an empty in-memory store.
+func NewMemory() *Memory {
+	return &Memory{buckets: map[string]*bucket{}, lastSweep: time.Now(), now: time.Now}
+}
+
+var _ Store = (*Memory)(nil)
+
+// Take takes the tokens of the bucket of the key for the policy.
+func (m *Memory) Take(ctx context.Context, key string, policy Policy, tokens int) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	key = policy.Name + ":" + key
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(policy.Limit), updated: now, policy: policy}
+		m.buckets[key] = b
+	}
+
+	var result Result
+	b.tokens, result = take(b.tokens, b.updated, now, policy, tokens)
+	b.updated = now
+
+	return result, nil
+}
+
+// sweep removes the buckets that are full again, they are the same as new ones.
+func (m *Memory) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+
+	for key, b := range m.buckets {
+		if refill(b.tokens, b.updated, now, b.policy) >= float64(b.policy.Limit) {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+// Len returns the number of buckets kept.
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.buckets)
+}
@@ -0,0 +1,138 @@
+// Package ratelimit token buckets that limit the rate of the requests
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy allows bursts of up to Limit requests, refilled at Limit requests
+// per Period. The zero policy doesn't limit the requests.
+type Policy struct {
+	// Name identifies the buckets of the policy, the policies with the same
+	// name share them.
+	Name   string
+	Limit  int
+	Period time.Duration
+}
+
+// ParsePolicy parses a policy written as limit/period, e.g. 30/1m. An empty
+// value is the zero policy.
+func ParsePolicy(name string, value string) (Policy, error) {
+	if value == "" {
+		return Policy{Name: name}, nil
+	}
+
+	limit, period, found := strings.Cut(value, "/")
+	if !found {
+		return Policy{}, fmt.Errorf("rate limit %q is not limit/period", value)
+	}
+
+	policy := Policy{Name: name}
+	var err error
+	if policy.Limit, err = strconv.Atoi(limit); err != nil || policy.Limit <= 0 {
+		return Policy{}, fmt.Errorf("rate limit %q must have a positive limit", value)
+	}
+	if policy.Period, err = time.ParseDuration(period); err != nil || policy.Period <= 0 {
+		return Policy{}, fmt.Errorf("rate limit %q must have a positive period", value)
+	}
+
+	return policy, nil
+}
+
+// Unlimited returns if the policy doesn't limit the requests.
+func (p Policy) Unlimited() bool {
+	return p.Limit <= 0 || p.Period <= 0
+}
+
+// String returns the policy as the RateLimit-Policy header, e.g. 30;w=60.
+func (p Policy) String() string {
+	return fmt.Sprintf("%d;w=%d", p.Limit, int(math.Ceil(p.Period.Seconds())))
+}
+
+// Result is the state of a bucket after taking a token.
+type Result struct {
+	// Allowed is false when the bucket was empty.
+	Allowed bool
+	// Remaining are the tokens left in the bucket.
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next token, when not allowed.
+	RetryAfter time.Duration
+}
+
+// Store keeps the buckets of the clients.
+type Store interface {
+	// Take takes the tokens of the bucket of the key for the policy, all or
+	// none. The tokens over the limit of the policy are not taken.
+	Take(ctx context.Context, key string, policy Policy, tokens int) (Result, error)
+}
+
+// Policies are the rate limits of the routes of the API.
+type Policies struct {
+	// IP limits all the requests to the API of every IP, before they are
+	// authenticated.
+	IP Policy
+	// Default limits all the requests to the API.
+	Default Policy
+	// Phemes limits the phemes posted.
+	Phemes Policy
+	// Relationships limits the friends and followers added.
+	Relationships Policy
+}
+
+// Limiter applies the policies with the buckets of the store.
+type Limiter struct {
+	Store    Store
+	Policies Policies
+}
+
+// refill returns the tokens of a bucket that had tokens at updated.
+func refill(tokens float64, updated time.Time, now time.Time, policy Policy) float64 {
+	if elapsed := now.Sub(updated); elapsed > 0 {
+		tokens += float64(elapsed) * rate(policy)
+	}
+
+	return math.Min(float64(policy.Limit), tokens)
+}
+
+// take takes the cost from a bucket that had tokens at updated, returning
+// the tokens left.
+func take(tokens float64, updated time.Time, now time.Time, policy Policy, cost int) (float64, Result) {
+	tokens = refill(tokens, updated, now, policy)
+	needed := float64(capCost(cost, policy))
+
+	result := Result{Allowed: tokens >= needed}
+	if result.Allowed {
+		tokens -= needed
+	} else {
+		result.RetryAfter = time.Duration(math.Ceil((needed - tokens) / rate(policy)))
+	}
+	result.Remaining = int(tokens)
+	result.Reset = time.Duration(math.Ceil((float64(policy.Limit) - tokens) / rate(policy)))
+
+	return tokens, result
+}
+
+// capCost returns the tokens taken by a cost, at least one and at most the
+// limit of the policy, so the costs over it still pass with a full bucket.
+func capCost(cost int, policy Policy) int {
+	if cost < 1 {
+		return 1
+	}
+	if cost > policy.Limit {
+		return policy.Limit
+	}
+
+	return cost
+}
+
+// rate returns the tokens refilled per nanosecond.
+func rate(policy Policy) float64 {
+	return float64(policy.Limit) / float64(policy.Period)
+}
@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParsePolicy(t *testing.T) {
+	policy, err := ParsePolicy("phemes", "30/1m")
+	if err != nil || policy != (Policy{Name: "phemes", Limit: 30, Period: time.Minute}) {
+		t.Errorf("got %+v, %v, want 30 per minute", policy, err)
+	}
+	if policy.String() != "30;w=60" {
+		t.Errorf("got the header %q, want 30;w=60", policy.String())
+	}
+
+	policy, err = ParsePolicy("phemes", "")
+	if err != nil || !policy.Unlimited() {
+		t.Errorf("got %+v, %v, want an unlimited policy", policy, err)
+	}
+
+	for _, value := range []string{"30", "0/1m", "a/1m", "30/0s", "30/minute"} {
+		if _, err := ParsePolicy("phemes", value); err == nil {
+			t.Errorf("expected an error parsing %q", value)
+		}
+	}
+}
+
+func TestMemory(t *testing.T) {
+	now := time.Now()
+	store := NewMemory()
+	store.now = func() time.Time { return now }
+	policy := Policy{Name: "test", Limit: 2, Period: time.Minute}
+	ctx := context.Background()
+
+	for i, want := range []Result{
+		{Allowed: true, Remaining: 1, Reset: 30 * time.Second},
+		{Allowed: true, Remaining: 0, Reset: time.Minute},
+		{Allowed: false, Remaining: 0, Reset: time.Minute, RetryAfter: 30 * time.Second},
+	} {
+		if result, err := store.Take(ctx, "alice", policy, 1); err != nil || result != want {
+			t.Errorf("take %d: got %+v, %v, want %+v", i, result, err, want)
+		}
+	}
+
+	if result, _ := store.Take(ctx, "bob", policy, 1); !result.Allowed {
+		t.Error("the bucket of bob is empty, want its own bucket")
+	}
+
+	now = now.Add(30 * time.Second)
+	if result, _ := store.Take(ctx, "alice", policy, 1); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("got %+v after refilling a token, want it allowed", result)
+	}
+
+	now = now.Add(2 * sweepInterval)
+	store.Take(ctx, "carol", policy, 1)
+	if store.Len() != 1 {
+		t.Errorf("got %d buckets, want the full ones removed", store.Len())
+	}
+}
+
+func TestMemoryTokens(t *testing.T) {
+	now := time.Now()
+	store := NewMemory()
+	store.now = func() time.Time { return now }
+	policy := Policy{Name: "test", Limit: 4, Period: time.Minute}
+	ctx := context.Background()
+
+	if result, _ := store.Take(ctx, "alice", policy, 3); !result.Allowed || result.Remaining != 1 {
+		t.Errorf("got %+v, want 3 tokens taken", result)
+	}
+	if result, _ := store.Take(ctx, "alice", policy, 2); result.Allowed || result.RetryAfter != 15*time.Second {
+		t.Errorf("got %+v, want 2 tokens refused until the second one is refilled", result)
+	}
+
+	// The costs over the limit take the whole bucket.
+	if result, _ := store.Take(ctx, "bob", policy, 10); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("got %+v, want the full bucket taken", result)
+	}
+}
+
+type fakeEvaler struct {
+	keys  []string
+	args  []interface{}
+	reply interface{}
+	err   error
+}
+
+func (f *fakeEvaler) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	f.keys = keys
+	f.args = args
+	return f.reply, f.err
+}
+
+func TestRedis(t *testing.T) {
+	client := &fakeEvaler{reply: []interface{}{int64(0), int64(0), int64(60000000), int64(30000000)}}
+	store := NewRedis(client, "pheme:")
+	policy := Policy{Name: "phemes", Limit: 2, Period: time.Minute}
+
+	result, err := store.Take(context.Background(), "user:1", policy, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Result{Allowed: false, Remaining: 0, Reset: time.Minute, RetryAfter: 30 * time.Second}
+	if result != want {
+		t.Errorf("got %+v, want %+v", result, want)
+	}
+	if len(client.keys) != 1 || client.keys[0] != "pheme:phemes:user:1" {
+		t.Errorf("got keys %v, want the prefixed key of the policy", client.keys)
+	}
+	if len(client.args) != 3 || client.args[0] != 2 || client.args[1] != int64(60000000) || client.args[2] != 1 {
+		t.Errorf("got args %v, want the limit, the period in microseconds and the tokens", client.args)
+	}
+
+	client.reply = []interface{}{"1"}
+	if _, err := store.Take(context.Background(), "user:1", policy, 1); err == nil {
+		t.Error("expected an error for an unexpected reply")
+	}
+
+	client.err = errors.New("connection refused")
+	if _, err := store.Take(context.Background(), "user:1", policy, 1); err == nil {
+		t.Error("expected the error of the client")
+	}
+}
@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Evaler runs the Lua scripts of a Redis compatible server, e.g. Redis,
+// Valkey or KeyDB. The client of go-redis satisfies it with:
+//
+//	func (e evaler) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+//		return e.client.Eval(ctx, script, keys, args...).Result()
+//	}
+type Evaler interface {
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
+}
+
+// takeScript is the token bucket of the Redis store. The bucket is a hash
+// with the tokens and the time they were updated, in microseconds of the
+// server clock so the replicas agree. It expires once it is full again.
+const takeScript = `
+local limit = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local cost = tonumber(ARGV[3])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+local rate = limit / period
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(bucket[1]) or limit
+local updated = tonumber(bucket[2]) or now
+if now > updated then
+	tokens = math.min(limit, tokens + (now - updated) * rate)
+end
+
+local allowed = 0
+local retry = 0
+if tokens >= cost then
+	tokens = tokens - cost
+	allowed = 1
+else
+	retry = math.ceil((cost - tokens) / rate)
+end
+local reset = math.ceil((limit - tokens) / rate)
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(reset / 1000))
+return {allowed, math.floor(tokens), reset, retry}
+`
+
+// Redis keeps the buckets in a Redis compatible server, shared by all the
+// replicas of the service.
+type Redis struct {
+	client Evaler
+	prefix string
+}
+
+// NewRedis returns the store of the buckets in the server, its keys start
+// with the prefix.
+func NewRedis(client Evaler, prefix string) *Redis {
+	return &Redis{client: client, prefix: prefix}
+}
+
+var _ Store = (*Redis)(nil)
+
+// Take takes the tokens of the bucket of the key for the policy.
+func (r *Redis) Take(ctx context.Context, key string, policy Policy, tokens int) (Result, error) {
+	reply, err := r.client.Eval(ctx, takeScript, []string{r.prefix + policy.Name + ":" + key},
+		policy.Limit, policy.Period.Microseconds(), capCost(tokens, policy))
+	if err != nil {
+		return Result{}, err
+	}
+
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 4 {
+		return Result{}, fmt.Errorf("unexpected reply of the rate limit script: %v", reply)
+	}
+
+	var numbers [4]int64
+	for i, value := range values {
+		if numbers[i], ok = value.(int64); !ok {
+			return Result{}, fmt.Errorf("unexpected reply of the rate limit script: %v", reply)
+		}
+	}
+
+	return Result{
+		Allowed:    numbers[0] == 1,
+		Remaining:  int(numbers[1]),
+		Reset:      time.Duration(numbers[2]) * time.Microsecond,
+		RetryAfter: time.Duration(numbers[3]) * time.Microsecond,
+	}, nil
+}
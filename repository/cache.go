@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/feserr/pheme-user/models"
+)
+
+// userCacheSize is the number of users after which the expired ones are pruned.
+const userCacheSize = 1024
+
+type cachedUser struct {
+	user    models.User
+	expires time.Time
+}
+
+// UserCache caches the users loaded for the authentication of the requests.
+type UserCache struct {
+	models.UserRepository
+
+	ttl   time.Duration
+	mu    sync.Mutex
+	users map[uint]cachedUser
+}
+
+// NewUserCache returns the repository caching its authenticated users for the ttl.
+func NewUserCache(users models.UserRepository, ttl time.Duration) *UserCache {
+	return &UserCache{
+		UserRepository: users,
+		ttl:            ttl,
+		users:          map[uint]cachedUser{},
+	}
+}
+
+// FindAuthUser returns the user with its roles, using a short lived cache.
+func (r *UserCache) FindAuthUser(ctx context.Context, userID uint) (models.User, error) {
+	r.mu.Lock()
+	cached, ok := r.users[userID]
+	r.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.user, nil
+	}
+
+	user, err := r.UserRepository.FindAuthUser(ctx, userID)
+	if err != nil {
+		return user, err
+	}
+
+	now := time.Now()
+	r.mu.Lock()
+	if len(r.users) >= userCacheSize {
+		for id, entry := range r.users {
+			if now.After(entry.expires) {
+				delete(r.users, id)
+			}
+		}
+	}
+	r.users[userID] = cachedUser{user: user, expires: now.Add(r.ttl)}
+	r.mu.Unlock()
+
+	return user, nil
+}
+
+// Invalidate removes the user from the cache.
+func (r *UserCache) Invalidate(userID uint) {
+	r.mu.Lock()
+	delete(r.users, userID)
+	r.mu.Unlock()
+}
+
+// DeleteByID deletes the user and removes it from the cache.
+func (r *UserCache) DeleteByID(ctx context.Context, userID uint) error {
+	defer r.Invalidate(userID)
+	return r.UserRepository.DeleteByID(ctx, userID)
+}
+
+// GrantRole grants a role to a user and removes it from the cache.
+func (r *UserCache) GrantRole(ctx context.Context, userID uint, role models.Role, grantedBy uint) error {
+	defer r.Invalidate(userID)
+	return r.UserRepository.GrantRole(ctx, userID, role, grantedBy)
+}
+
+// RevokeRole revokes a role from a user and removes it from the cache.
+func (r *UserCache) RevokeRole(ctx context.Context, userID uint, role models.Role) error {
+	defer r.Invalidate(userID)
+	return r.UserRepository.RevokeRole(ctx, userID, role)
+}
@@ -0,0 +1,70 @@
+// Package repository storage of the models
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/feserr/pheme-user/models"
+	"golang.org/x/exp/slog"
+	"gorm.io/gorm"
+)
+
+// Gorm stores the models in a SQL database.
+type Gorm struct {
+	db *gorm.DB
+
+	// RewriteUpgraded stores back the records upgraded when they are read
+	// with an older version of the schema.
+	RewriteUpgraded bool
+
+	// Logger of the records that fail to upgrade.
+	Logger *slog.Logger
+}
+
+// NewGorm returns the repositories backed by the database.
+func NewGorm(db *gorm.DB) *Gorm {
+	return &Gorm{db: db, Logger: slog.Default()}
+}
+
+// txKey is the context key of the transaction in progress.
+type txKey struct{}
+
+// conn returns the connection of the context: its transaction, if it has one,
+// or the database.
+func (r *Gorm) conn(ctx context.Context) *gorm.DB {
+	if tx, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		return tx.WithContext(ctx)
+	}
+
+	return r.db.WithContext(ctx)
+}
+
+// Transaction runs fn in a transaction, the nested ones are savepoints of the
+// transaction in progress.
+func (r *Gorm) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return r.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(context.WithValue(ctx, txKey{}, tx))
+	})
+}
+
+// notFound maps the GORM not found error to the models one.
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.ErrNotFound
+	}
+
+	return err
+}
+
+var (
+	_ models.PhemeRepository           = (*Gorm)(nil)
+	_ models.UserRepository            = (*Gorm)(nil)
+	_ models.TokenRepository           = (*Gorm)(nil)
+	_ models.IdempotencyRepository     = (*Gorm)(nil)
+	_ models.AccountDeletionRepository = (*Gorm)(nil)
+	_ models.ExportRepository          = (*Gorm)(nil)
+	_ models.ReactionRepository        = (*Gorm)(nil)
+	_ models.Transactor                = (*Gorm)(nil)
+	_ models.Backfiller                = (*Gorm)(nil)
+)
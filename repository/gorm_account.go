@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/feserr/pheme-user/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ScheduleAccountDeletion schedules the deletion of the account of a user,
+// unless it is already scheduled: then it returns that one.
+func (r *Gorm) ScheduleAccountDeletion(ctx context.Context, deletion models.AccountDeletion) (models.AccountDeletion, error) {
+	err := r.Transaction(ctx, func(ctx context.Context) error {
+		if err := r.lockUsers(ctx, deletion.UserID); err != nil {
+			return err
+		}
+
+		if err := r.conn(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&deletion).Error; err != nil {
+			return err
+		}
+
+		return r.conn(ctx).First(&deletion, "user_id = ?", deletion.UserID).Error
+	})
+
+	return deletion, err
+}
+
+// FindAccountDeletion returns the scheduled deletion of the account of a user.
+func (r *Gorm) FindAccountDeletion(ctx context.Context, userID uint) (models.AccountDeletion, error) {
+	deletion := models.AccountDeletion{}
+	if err := r.conn(ctx).First(&deletion, "user_id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return deletion, models.ErrDeletionNotFound
+		}
+
+		return deletion, err
+	}
+
+	return deletion, nil
+}
+
+// CancelAccountDeletion cancels the scheduled deletion of the account of a user.
+func (r *Gorm) CancelAccountDeletion(ctx context.Context, userID uint) error {
+	canceled := r.conn(ctx).Delete(&models.AccountDeletion{}, "user_id = ?", userID)
+	if canceled.Error != nil {
+		return canceled.Error
+	}
+
+	if canceled.RowsAffected < 1 {
+		return models.ErrDeletionNotFound
+	}
+
+	return nil
+}
+
+// DueAccountDeletions returns up to limit deletions scheduled before the time.
+func (r *Gorm) DueAccountDeletions(ctx context.Context, now time.Time, limit int) ([]models.AccountDeletion, error) {
+	deletions := []models.AccountDeletion{}
+	dueDeletions := r.conn(ctx).Order("scheduled_at").Limit(limit).Find(&deletions, "scheduled_at <= ?", now)
+
+	return deletions, dueDeletions.Error
+}
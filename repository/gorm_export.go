@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/feserr/pheme-user/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CreateExport adds an export of a user, unless one is pending or running:
+// then it returns that one.
+func (r *Gorm) CreateExport(ctx context.Context, export models.Export) (models.Export, error) {
+	err := r.Transaction(ctx, func(ctx context.Context) error {
+		if err := r.lockUsers(ctx, export.UserID); err != nil {
+			return err
+		}
+
+		pending := []models.Export{}
+		pendingExports := r.conn(ctx).Omit("archive").Limit(1).Find(&pending, "user_id = ? AND status IN ?", export.UserID, []models.ExportStatus{models.ExportPending, models.ExportRunning})
+		if pendingExports.Error != nil {
+			return pendingExports.Error
+		}
+
+		if len(pending) > 0 {
+			export = pending[0]
+			return nil
+		}
+
+		return r.conn(ctx).Create(&export).Error
+	})
+
+	return export, err
+}
+
+// FindExport returns an export of a user, without its archive.
+func (r *Gorm) FindExport(ctx context.Context, exportID uint, userID uint) (models.Export, error) {
+	export := models.Export{}
+	if err := r.conn(ctx).Omit("archive").First(&export, "id = ? AND user_id = ?", exportID, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return export, models.ErrExportNotFound
+		}
+
+		return export, err
+	}
+
+	return export, nil
+}
+
+// FetchExportArchive returns the archive of a ready export of a user.
+func (r *Gorm) FetchExportArchive(ctx context.Context, exportID uint, userID uint) ([]byte, error) {
+	export := models.Export{}
+	if err := r.conn(ctx).Select("archive").First(&export, "id = ? AND user_id = ? AND status = ?", exportID, userID, models.ExportReady).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, models.ErrExportNotFound
+		}
+
+		return nil, err
+	}
+
+	return export.Archive, nil
+}
+
+// ClaimExports marks up to limit exports as running since now and returns
+// them, the oldest first: the pending ones and the running ones claimed before
+// stale. The claim is a single update, and Postgres skips the rows claimed by
+// the other replicas instead of waiting for them.
+func (r *Gorm) ClaimExports(ctx context.Context, now time.Time, stale time.Time, limit int) ([]models.Export, error) {
+	claimable := r.conn(ctx).Model(&models.Export{}).Select("id").
+		Where("status = ? OR (status = ? AND claimed_at < ?)", models.ExportPending, models.ExportRunning, stale).
+		Order("created_at, id").Limit(limit).
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+
+	exports := []models.Export{}
+	claimedExports := r.conn(ctx).Model(&exports).Clauses(clause.Returning{Columns: exportColumns}).Where("id IN (?)", claimable).Updates(map[string]interface{}{
+		"status":     models.ExportRunning,
+		"claimed_at": now,
+	})
+	if claimedExports.Error != nil {
+		return nil, claimedExports.Error
+	}
+
+	// The rows returned by the update have no order.
+	sort.Slice(exports, func(i, j int) bool {
+		if !exports[i].CreatedAt.Equal(exports[j].CreatedAt) {
+			return exports[i].CreatedAt.Before(exports[j].CreatedAt)
+		}
+
+		return exports[i].ID < exports[j].ID
+	})
+
+	return exports, nil
+}
+
+// exportColumns are the columns of the exports without their archive.
+var exportColumns = []clause.Column{
+	{Name: "id"}, {Name: "user_id"}, {Name: "status"}, {Name: "size"},
+	{Name: "created_at"}, {Name: "completed_at"}, {Name: "claimed_at"},
+}
+
+// CompleteExport stores the status, size and archive of an export, unless it
+// was claimed again since its claim: then it returns false.
+func (r *Gorm) CompleteExport(ctx context.Context, export models.Export) (bool, error) {
+	completedExport := r.conn(ctx).Model(&models.Export{}).Where("id = ? AND status = ? AND claimed_at = ?", export.ID, models.ExportRunning, export.ClaimedAt).Updates(map[string]interface{}{
+		"status":       export.Status,
+		"size":         export.Size,
+		"completed_at": export.CompletedAt,
+		"archive":      export.Archive,
+	})
+	if completedExport.Error != nil {
+		return false, completedExport.Error
+	}
+
+	return completedExport.RowsAffected == 1, nil
+}
+
+// DeleteExports removes the exports created before the time.
+func (r *Gorm) DeleteExports(ctx context.Context, before time.Time) (int64, error) {
+	deletedExports := r.conn(ctx).Delete(&models.Export{}, "created_at < ?", before)
+	return deletedExports.RowsAffected, deletedExports.Error
+}
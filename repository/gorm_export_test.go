@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/feserr/pheme-user/models"
+	"gorm.io/gorm"
+)
+
+func TestClaimExports(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		repo := NewGorm(db)
+		ids := insertUsers(t, db, "alice", "bob", "carol")
+		ctx := context.Background()
+
+		created := map[uint]bool{}
+		for _, id := range ids {
+			export, err := repo.CreateExport(ctx, models.Export{UserID: id, Status: models.ExportPending, CreatedAt: time.Now()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			created[export.ID] = true
+		}
+
+		// The replicas claim every export once.
+		now := time.Now()
+		var wg sync.WaitGroup
+		claims := make(chan []models.Export, 10)
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				claimed, err := repo.ClaimExports(ctx, now, now.Add(-time.Minute), 1)
+				if err != nil {
+					t.Errorf("claiming the exports concurrently: %v", err)
+				}
+				claims <- claimed
+			}()
+		}
+		wg.Wait()
+		close(claims)
+
+		claimed := map[uint]bool{}
+		for exports := range claims {
+			for _, export := range exports {
+				if claimed[export.ID] || !created[export.ID] || export.Status != models.ExportRunning {
+					t.Errorf("got the claimed export %+v, want the pending ones claimed once", export)
+				}
+				claimed[export.ID] = true
+			}
+		}
+		if len(claimed) != len(created) {
+			t.Errorf("claimed %d exports, want %d", len(claimed), len(created))
+		}
+
+		// A running export is returned instead of a new one.
+		export, err := repo.CreateExport(ctx, models.Export{UserID: ids[0], Status: models.ExportPending, CreatedAt: time.Now()})
+		if err != nil || !created[export.ID] {
+			t.Errorf("got %+v, %v, want the running export", export, err)
+		}
+
+		if exports, err := repo.ClaimExports(ctx, now, now.Add(-time.Minute), 10); err != nil || len(exports) != 0 {
+			t.Errorf("got %+v, %v, want the running exports not claimed again", exports, err)
+		}
+
+		// The exports running for too long were lost, they are claimed again.
+		exports, err := repo.ClaimExports(ctx, now.Add(time.Hour), now.Add(time.Second), 10)
+		if err != nil || len(exports) != len(created) {
+			t.Errorf("got %+v, %v, want the lost exports claimed again", exports, err)
+		}
+
+		// Only the last claim of an export completes it.
+		lost := exports[0]
+		lost.ClaimedAt = &now
+		lost.Status = models.ExportFailed
+		if completed, err := repo.CompleteExport(ctx, lost); err != nil || completed {
+			t.Errorf("got %t, %v, want the lost build dropped", completed, err)
+		}
+
+		built := exports[0]
+		built.Status = models.ExportReady
+		built.Archive = []byte("archive")
+		built.Size = int64(len(built.Archive))
+		if completed, err := repo.CompleteExport(ctx, built); err != nil || !completed {
+			t.Errorf("got %t, %v, want the export completed", completed, err)
+		}
+
+		export, err = repo.FindExport(ctx, built.ID, built.UserID)
+		if err != nil || export.Status != models.ExportReady || export.Size != built.Size {
+			t.Errorf("got %+v, %v, want the export built by the last claim", export, err)
+		}
+
+		if completed, err := repo.CompleteExport(ctx, lost); err != nil || completed {
+			t.Errorf("got %t, %v, want the completed export kept", completed, err)
+		}
+	})
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/feserr/pheme-user/models"
+	"gorm.io/gorm/clause"
+)
+
+// ReserveIdempotencyKey stores the key of a request in flight, unless the user
+// has it and it is not expired: then it returns that one and false.
+func (r *Gorm) ReserveIdempotencyKey(ctx context.Context, key models.IdempotencyKey) (models.IdempotencyKey, bool, error) {
+	expired := r.conn(ctx).Delete(&models.IdempotencyKey{}, "user_id = ? AND key = ? AND expires_at <= ?", key.UserID, key.Key, key.CreatedAt)
+	if expired.Error != nil {
+		return key, false, expired.Error
+	}
+
+	// The unique index of the user and key lets a single request reserve it.
+	reserved := r.conn(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&key)
+	if reserved.Error != nil {
+		return key, false, reserved.Error
+	}
+
+	if reserved.RowsAffected == 1 {
+		return key, true, nil
+	}
+
+	existing := models.IdempotencyKey{}
+	if err := r.conn(ctx).First(&existing, "user_id = ? AND key = ?", key.UserID, key.Key).Error; err != nil {
+		return existing, false, notFound(err)
+	}
+
+	return existing, false, nil
+}
+
+// CompleteIdempotencyKey stores the response of the request of the key and
+// its expiration.
+func (r *Gorm) CompleteIdempotencyKey(ctx context.Context, key models.IdempotencyKey) error {
+	completed := r.conn(ctx).Model(&models.IdempotencyKey{}).Where("id = ?", key.ID).Updates(map[string]interface{}{
+		"status":       key.Status,
+		"content_type": key.ContentType,
+		"body":         key.Body,
+		"expires_at":   key.ExpiresAt,
+	})
+	if completed.Error != nil {
+		return completed.Error
+	}
+
+	return nil
+}
+
+// ReleaseIdempotencyKey removes the key, so the request can be retried.
+func (r *Gorm) ReleaseIdempotencyKey(ctx context.Context, keyID uint) error {
+	if err := r.conn(ctx).Delete(&models.IdempotencyKey{}, keyID).Error; err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteExpiredIdempotencyKeys removes the keys expired at the time.
+func (r *Gorm) DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error) {
+	deleted := r.conn(ctx).Delete(&models.IdempotencyKey{}, "expires_at <= ?", now)
+	if deleted.Error != nil {
+		return 0, deleted.Error
+	}
+
+	return deleted.RowsAffected, nil
+}
@@ -0,0 +1,271 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/feserr/pheme-user/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FetchAllPhemes returns all the phemes of a user, friends and followers with equal or higher visibility.
+func (r *Gorm) FetchAllPhemes(ctx context.Context, userID uint) ([]models.Pheme, error) {
+	phemes := []models.Pheme{}
+	allUserPhemes := r.conn(ctx).Model(&models.Pheme{}).Order("created_at desc").Find(&phemes, "user_id = ? and visibility >= ?", userID, byte(models.PRIVATE))
+	if allUserPhemes.Error != nil {
+		return phemes, allUserPhemes.Error
+	}
+
+	friends, err := r.GetFriends(ctx, userID)
+	if err == nil && len(friends) > 0 {
+		friendsPhemes := []models.Pheme{}
+		allFriendsPhemes := r.conn(ctx).Model(&models.Pheme{}).Order("created_at desc").Find(&friendsPhemes, "user_id in ? and visibility >= ?", friends, byte(models.PROTECTED))
+		if allFriendsPhemes.Error == nil {
+			phemes = append(phemes, friendsPhemes...)
+		}
+	}
+
+	followers, err := r.GetFollowers(ctx, userID)
+	if err == nil && len(followers) > 0 {
+		followersPhemes := []models.Pheme{}
+		allFollowersPhemes := r.conn(ctx).Model(&models.Pheme{}).Order("created_at desc").Find(&followersPhemes, "user_id in ? and visibility >= ?", followers, byte(models.PUBLIC))
+		if allFollowersPhemes.Error == nil {
+			phemes = append(phemes, followersPhemes...)
+		}
+	}
+
+	return phemes, r.upgradePhemes(ctx, phemes)
+}
+
+// FetchUserPhemes returns all the phemes of the logged user with equal or higher visibility.
+func (r *Gorm) FetchUserPhemes(ctx context.Context, userID uint, visibility byte) ([]models.Pheme, error) {
+	phemes := []models.Pheme{}
+	allPhemes := r.conn(ctx).Model(&models.Pheme{}).Order("created_at desc").Find(&phemes, "user_id = ? and visibility >= ?", userID, visibility)
+	if allPhemes.Error != nil {
+		return phemes, allPhemes.Error
+	}
+
+	return phemes, r.upgradePhemes(ctx, phemes)
+}
+
+// FetchPheme returns the pheme if is visible for the user.
+func (r *Gorm) FetchPheme(ctx context.Context, phemeID uint, userID uint) (models.Pheme, error) {
+	pheme := models.Pheme{}
+	thePheme := r.conn(ctx).Model(&models.Pheme{}).Find(&pheme, phemeID)
+	if thePheme.Error != nil {
+		return pheme, thePheme.Error
+	}
+
+	if pheme.CreatedBy != userID || pheme.UserID != userID {
+		return models.Pheme{}, models.ErrPhemeNotFound
+	}
+
+	return pheme, r.upgrade(ctx, &pheme, models.PhemeVersion())
+}
+
+// FindPheme returns the pheme of any user, unless it is trashed.
+func (r *Gorm) FindPheme(ctx context.Context, phemeID uint) (models.Pheme, error) {
+	pheme := models.Pheme{}
+	if err := r.conn(ctx).First(&pheme, phemeID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return pheme, models.ErrPhemeNotFound
+		}
+
+		return pheme, err
+	}
+
+	return pheme, r.upgrade(ctx, &pheme, models.PhemeVersion())
+}
+
+// FetchPhemes returns the phemes of the IDs visible for the user, skipping the others.
+func (r *Gorm) FetchPhemes(ctx context.Context, phemeIDs []uint, userID uint) ([]models.Pheme, error) {
+	phemes := []models.Pheme{}
+	if len(phemeIDs) == 0 {
+		return phemes, nil
+	}
+
+	somePhemes := r.conn(ctx).Model(&models.Pheme{}).Order("id").Find(&phemes, "id in ? and created_by = ? and user_id = ?", phemeIDs, userID, userID)
+	if somePhemes.Error != nil {
+		return phemes, somePhemes.Error
+	}
+
+	return phemes, r.upgradePhemes(ctx, phemes)
+}
+
+// CreatePheme adds a pheme to the DB. The friendship of the author is locked
+// until the pheme is inserted, so it can't be removed in between.
+func (r *Gorm) CreatePheme(ctx context.Context, pheme models.Pheme) (uint, error) {
+	err := r.Transaction(ctx, func(ctx context.Context) error {
+		if pheme.CreatedBy != pheme.UserID {
+			locked := r.conn(ctx).Clauses(clause.Locking{Strength: "SHARE"})
+			res, err := r.related(locked, "friendship", "friend_id", pheme.CreatedBy, pheme.UserID)
+			if err != nil {
+				return err
+			}
+
+			if !res {
+				return models.ErrNotFriends
+			}
+		}
+
+		return r.conn(ctx).Create(&pheme).Error
+	})
+	if errors.Is(err, models.ErrNotFriends) {
+		return 0, nil
+	}
+
+	return pheme.ID, err
+}
+
+// trash moves the pheme matching the conditions to the trash for the user,
+// returns it.
+func (r *Gorm) trash(ctx context.Context, userID uint, conditions ...interface{}) (models.Pheme, error) {
+	pheme := models.Pheme{}
+	err := r.Transaction(ctx, func(ctx context.Context) error {
+		if err := r.conn(ctx).First(&pheme, conditions...).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return models.ErrPhemeNotFound
+			}
+
+			return err
+		}
+
+		pheme.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+		pheme.DeletedBy = &userID
+		trashedPheme := r.conn(ctx).Model(&pheme).Updates(map[string]interface{}{
+			"deleted_at": pheme.DeletedAt,
+			"deleted_by": userID,
+		})
+		if trashedPheme.Error != nil {
+			return trashedPheme.Error
+		}
+
+		if trashedPheme.RowsAffected < 1 {
+			return models.ErrPhemeNotFound
+		}
+
+		return nil
+	})
+	if err != nil {
+		return models.Pheme{}, err
+	}
+
+	return pheme, r.upgrade(ctx, &pheme, models.PhemeVersion())
+}
+
+// DeletePheme moves a pheme of a user to the trash, returns the trashed pheme.
+func (r *Gorm) DeletePheme(ctx context.Context, phemeID uint, userID uint) (models.Pheme, error) {
+	return r.trash(ctx, userID, "id = ? AND user_id = ?", phemeID, userID)
+}
+
+// DeletePhemeByID moves a pheme of any user to the trash for the moderator,
+// returns the trashed pheme.
+func (r *Gorm) DeletePhemeByID(ctx context.Context, phemeID uint, moderatorID uint) (models.Pheme, error) {
+	return r.trash(ctx, moderatorID, "id = ?", phemeID)
+}
+
+// FetchTrash returns the trashed phemes of a user, the last trashed first.
+func (r *Gorm) FetchTrash(ctx context.Context, userID uint) ([]models.Pheme, error) {
+	phemes := []models.Pheme{}
+	trashedPhemes := r.conn(ctx).Unscoped().Model(&models.Pheme{}).Order("deleted_at desc, id desc").Find(&phemes, "user_id = ? and deleted_at is not null", userID)
+	if trashedPhemes.Error != nil {
+		return phemes, trashedPhemes.Error
+	}
+
+	return phemes, r.upgradePhemes(ctx, phemes)
+}
+
+// RestorePheme moves a pheme of a user out of the trash, unless another user
+// moved it there.
+func (r *Gorm) RestorePheme(ctx context.Context, phemeID uint, userID uint) (models.Pheme, error) {
+	pheme := models.Pheme{}
+	err := r.Transaction(ctx, func(ctx context.Context) error {
+		restoredPheme := r.conn(ctx).Unscoped().Model(&models.Pheme{}).Where("id = ? AND user_id = ? AND deleted_at is not null AND deleted_by = ?", phemeID, userID, userID).Updates(map[string]interface{}{
+			"deleted_at": nil,
+			"deleted_by": nil,
+		})
+		if restoredPheme.Error != nil {
+			return restoredPheme.Error
+		}
+
+		if restoredPheme.RowsAffected < 1 {
+			var moderated int64
+			if err := r.conn(ctx).Unscoped().Model(&models.Pheme{}).Where("id = ? AND user_id = ? AND deleted_at is not null", phemeID, userID).Count(&moderated).Error; err != nil {
+				return err
+			}
+
+			if moderated > 0 {
+				return models.ErrPhemeModerated
+			}
+
+			return models.ErrPhemeNotFound
+		}
+
+		return r.conn(ctx).First(&pheme, phemeID).Error
+	})
+	if err != nil {
+		return models.Pheme{}, err
+	}
+
+	return pheme, r.upgrade(ctx, &pheme, models.PhemeVersion())
+}
+
+// PurgeTrash removes for good the phemes trashed before the time.
+func (r *Gorm) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	purgedPhemes := r.conn(ctx).Unscoped().Delete(&models.Pheme{}, "deleted_at < ?", before)
+	return purgedPhemes.RowsAffected, purgedPhemes.Error
+}
+
+// ImportPhemes adds the imported phemes, skipping the ones with the import key
+// of a pheme of the user, returns the number of added phemes.
+func (r *Gorm) ImportPhemes(ctx context.Context, phemes []models.Pheme) (int, error) {
+	if len(phemes) == 0 {
+		return 0, nil
+	}
+
+	importedPhemes := r.conn(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&phemes)
+	return int(importedPhemes.RowsAffected), importedPhemes.Error
+}
+
+// FetchPersonalPhemes returns all the phemes authored or received by a user,
+// the trashed ones included.
+func (r *Gorm) FetchPersonalPhemes(ctx context.Context, userID uint) ([]models.Pheme, error) {
+	phemes := []models.Pheme{}
+	personalPhemes := r.conn(ctx).Unscoped().Order("created_at, id").Find(&phemes, "user_id = ? OR created_by = ?", userID, userID)
+	if personalPhemes.Error != nil {
+		return phemes, personalPhemes.Error
+	}
+
+	return phemes, r.upgradePhemes(ctx, phemes)
+}
+
+// UpdatePheme updates the data of a pheme.
+func (r *Gorm) UpdatePheme(ctx context.Context, pheme models.PhemeParamsPost, phemeID uint, userID uint) (models.Pheme, error) {
+	oldPheme := models.Pheme{}
+	updatedPost := r.conn(ctx).First(&oldPheme, "id = ? AND created_by = ?", phemeID, userID)
+	if updatedPost.Error != nil {
+		if errors.Is(updatedPost.Error, gorm.ErrRecordNotFound) {
+			return oldPheme, models.ErrPhemeNotFound
+		}
+
+		return oldPheme, updatedPost.Error
+	}
+
+	if _, err := oldPheme.Upgrade(); err != nil {
+		return oldPheme, err
+	}
+
+	oldPheme.Version = models.PhemeVersion()
+	oldPheme.UpdatedAt = time.Now()
+	oldPheme.Visibility = pheme.Visibilty
+	oldPheme.Category = pheme.Category
+	oldPheme.Text = pheme.Text
+	updatedPost = r.conn(ctx).Save(&oldPheme)
+	if updatedPost.Error != nil {
+		return oldPheme, updatedPost.Error
+	}
+
+	return oldPheme, nil
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/feserr/pheme-user/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SetReaction adds the reaction of the user to the pheme or replaces the
+// previous one, returns false if the user already had that one.
+func (r *Gorm) SetReaction(ctx context.Context, reaction models.Reaction) (bool, error) {
+	// The conflicting reaction is only updated when its emoji changes.
+	setReaction := r.conn(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "pheme_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"emoji", "created_at"}),
+		Where:     clause.Where{Exprs: []clause.Expression{gorm.Expr("pheme_reactions.emoji <> excluded.emoji")}},
+	}).Create(&reaction)
+	if setReaction.Error != nil {
+		return false, setReaction.Error
+	}
+
+	return setReaction.RowsAffected > 0, nil
+}
+
+// DeleteReaction removes the reaction of the user to the pheme.
+func (r *Gorm) DeleteReaction(ctx context.Context, phemeID uint, userID uint) error {
+	deletedReaction := r.conn(ctx).Delete(&models.Reaction{}, "pheme_id = ? AND user_id = ?", phemeID, userID)
+	if deletedReaction.Error != nil {
+		return deletedReaction.Error
+	}
+
+	if deletedReaction.RowsAffected < 1 {
+		return models.ErrReactionNotFound
+	}
+
+	return nil
+}
+
+// FetchReactions returns the reactions to the pheme, the oldest first.
+func (r *Gorm) FetchReactions(ctx context.Context, phemeID uint) ([]models.Reaction, error) {
+	reactions := []models.Reaction{}
+	allReactions := r.conn(ctx).Order("created_at, user_id").Find(&reactions, "pheme_id = ?", phemeID)
+	if allReactions.Error != nil {
+		return reactions, allReactions.Error
+	}
+
+	return reactions, nil
+}
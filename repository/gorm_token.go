@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/feserr/pheme-user/models"
+)
+
+// CreateToken adds a personal access token to the DB.
+func (r *Gorm) CreateToken(ctx context.Context, token models.PersonalAccessToken) (models.PersonalAccessToken, error) {
+	if err := r.conn(ctx).Create(&token).Error; err != nil {
+		return token, err
+	}
+
+	return token, nil
+}
+
+// FetchTokens returns the personal access tokens of a user.
+func (r *Gorm) FetchTokens(ctx context.Context, userID uint) ([]models.PersonalAccessToken, error) {
+	tokens := []models.PersonalAccessToken{}
+	allTokens := r.conn(ctx).Model(&models.PersonalAccessToken{}).Order("created_at desc").Find(&tokens, "user_id = ?", userID)
+	if allTokens.Error != nil {
+		return tokens, allTokens.Error
+	}
+
+	return tokens, nil
+}
+
+// FindTokenByHash returns the personal access token with the hash.
+func (r *Gorm) FindTokenByHash(ctx context.Context, hash []byte) (models.PersonalAccessToken, error) {
+	token := models.PersonalAccessToken{}
+	if err := r.conn(ctx).First(&token, "hash = ?", hash).Error; err != nil {
+		return token, notFound(err)
+	}
+
+	return token, nil
+}
+
+// TouchToken records the last time the token was used.
+func (r *Gorm) TouchToken(ctx context.Context, tokenID uint, usedAt time.Time) error {
+	touchedToken := r.conn(ctx).Model(&models.PersonalAccessToken{}).Where("id = ?", tokenID).UpdateColumn("last_used_at", usedAt)
+	if touchedToken.Error != nil {
+		return touchedToken.Error
+	}
+
+	return nil
+}
+
+// DeleteToken revokes a personal access token of a user.
+func (r *Gorm) DeleteToken(ctx context.Context, tokenID uint, userID uint) (uint, error) {
+	deletedToken := r.conn(ctx).Delete(&models.PersonalAccessToken{}, "id = ? AND user_id = ?", tokenID, userID)
+	if deletedToken.Error != nil {
+		return tokenID, deletedToken.Error
+	}
+
+	if deletedToken.RowsAffected < 1 {
+		return tokenID, models.ErrTokenNotFound
+	}
+
+	return tokenID, nil
+}
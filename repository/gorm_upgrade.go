@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/feserr/pheme-user/models"
+	"golang.org/x/exp/slog"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// upgradable is a record that can be written with an older version of the schema.
+type upgradable interface {
+	Upgrade() (bool, error)
+}
+
+// upgrade upgrades a record read with an older version of the schema and, when
+// RewriteUpgraded is set, stores it back.
+func (r *Gorm) upgrade(ctx context.Context, record upgradable, latest uint) error {
+	upgraded, err := record.Upgrade()
+	if err != nil || !upgraded || !r.RewriteUpgraded {
+		return err
+	}
+
+	if err := rewrite(r.conn(ctx), record, latest); err != nil {
+		r.Logger.WarnCtx(ctx, "failed to rewrite an upgraded record", "error", err)
+	}
+
+	return nil
+}
+
+func (r *Gorm) upgradePhemes(ctx context.Context, phemes []models.Pheme) error {
+	for i := range phemes {
+		if err := r.upgrade(ctx, &phemes[i], models.PhemeVersion()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Gorm) upgradeUser(ctx context.Context, user *models.User) error {
+	return r.upgrade(ctx, user, models.UserVersion())
+}
+
+// rewrite stores the upgraded record unless it was already rewritten with the
+// latest version by someone else. The trashed records are rewritten too.
+func rewrite(tx *gorm.DB, record interface{}, latest uint) error {
+	return tx.Unscoped().Model(record).Select("*").Omit(clause.Associations).Where("version < ?", latest).Updates(record).Error
+}
+
+// BackfillPhemes upgrades all the phemes written with an older version of the
+// schema, in batches, and reports the progress after each one.
+func (r *Gorm) BackfillPhemes(ctx context.Context, batchSize int, report func(models.BackfillProgress)) error {
+	return backfill(ctx, r.db, r.Logger, "phemes", models.PhemeVersion(), batchSize, report,
+		func(pheme *models.Pheme) uint { return pheme.ID })
+}
+
+// BackfillUsers upgrades all the users written with an older version of the
+// schema, in batches, and reports the progress after each one.
+func (r *Gorm) BackfillUsers(ctx context.Context, batchSize int, report func(models.BackfillProgress)) error {
+	return backfill(ctx, r.db, r.Logger, "users", models.UserVersion(), batchSize, report,
+		func(user *models.User) uint { return user.ID })
+}
+
+// backfill upgrades the records of the table older than the latest version,
+// walking them by ID so the ones that fail to upgrade are not read again.
+func backfill[T any, P interface {
+	*T
+	upgradable
+}](ctx context.Context, db *gorm.DB, logger *slog.Logger, table string, latest uint, batchSize int, report func(models.BackfillProgress), id func(*T) uint) error {
+	// The trashed records are upgraded too, they may be restored.
+	db = db.WithContext(ctx).Unscoped()
+	progress := models.BackfillProgress{Table: table}
+
+	if err := db.Model(new(T)).Where("version < ?", latest).Count(&progress.Total).Error; err != nil {
+		return err
+	}
+
+	var lastID uint
+	for {
+		records := []T{}
+		err := db.Where("version < ? AND id > ?", latest, lastID).Order("id").Limit(batchSize).Find(&records).Error
+		if err != nil {
+			return err
+		}
+
+		if len(records) == 0 {
+			return nil
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			for i := range records {
+				record := P(&records[i])
+				if _, err := record.Upgrade(); err != nil {
+					logger.WarnCtx(ctx, "failed to upgrade a record", "table", table, "id", id(&records[i]), "error", err)
+					progress.Failed++
+					continue
+				}
+
+				if err := rewrite(tx, record, latest); err != nil {
+					return err
+				}
+				progress.Upgraded++
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		lastID = id(&records[len(records)-1])
+		progress.Done += int64(len(records))
+		if report != nil {
+			report(progress)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/feserr/pheme-user/database"
+	"github.com/feserr/pheme-user/migrations"
+	"github.com/feserr/pheme-user/models"
+	"gorm.io/gorm"
+)
+
+func openSQLite(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := database.Open(database.Config{
+		DSN: "sqlite:" + filepath.Join(t.TempDir(), "pheme.db"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrate(t, db)
+	return db
+}
+
+// postgresDSNEnv is the variable with the DSN of the Postgres database of the
+// tests that depend on its locks, they are skipped when it is empty.
+const postgresDSNEnv = "TEST_POSTGRES_DSN"
+
+// openPostgres opens the Postgres database of the tests in a schema of its
+// own, dropped at the end of the test, so the tests don't share rows.
+func openPostgres(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv(postgresDSNEnv)
+	if dsn == "" {
+		t.Skip(postgresDSNEnv + " is not set")
+	}
+
+	admin, err := database.Open(database.Config{Driver: database.DriverPostgres, DSN: dsn})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := admin.Exec("DROP SCHEMA " + schema + " CASCADE").Error; err != nil {
+			t.Error(err)
+		}
+		closeDB(t, admin)
+	})
+
+	db, err := database.Open(database.Config{Driver: database.DriverPostgres, DSN: withSearchPath(dsn, schema)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { closeDB(t, db) })
+
+	migrate(t, db)
+	return db
+}
+
+// withSearchPath returns the DSN, as a URL or keywords, using the schema.
+func withSearchPath(dsn string, schema string) string {
+	if !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://") {
+		return dsn + " search_path=" + schema
+	}
+
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+
+	return dsn + separator + "search_path=" + schema
+}
+
+// forEachDatabase runs the test against SQLite and, when it is set, Postgres.
+func forEachDatabase(t *testing.T, test func(t *testing.T, db *gorm.DB)) {
+	t.Run("sqlite", func(t *testing.T) { test(t, openSQLite(t)) })
+	t.Run("postgres", func(t *testing.T) { test(t, openPostgres(t)) })
+}
+
+// migrate applies all the migrations to the database.
+func migrate(t *testing.T, db *gorm.DB) {
+	t.Helper()
+
+	migrator, err := migrations.New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// closeDB closes the connections of the database.
+func closeDB(t *testing.T, db *gorm.DB) {
+	t.Helper()
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sqlDB.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+// registerPhemeUpgrade adds a version to the phemes upgrading the category to
+// lower case for the duration of the test.
+func registerPhemeUpgrade(t *testing.T) {
+	saved := *models.PhemeUpgrades
+	t.Cleanup(func() { *models.PhemeUpgrades = saved })
+
+	models.PhemeUpgrades.Register(func(pheme *models.Pheme) error {
+		pheme.Category = strings.ToLower(pheme.Category)
+		return nil
+	})
+}
+
+// insertPhemes adds a user with the ID 1 and its phemes.
+func insertPhemes(t *testing.T, db *gorm.DB, count int) {
+	t.Helper()
+
+	insertUsers(t, db, "alice")
+	for i := 0; i < count; i++ {
+		pheme := models.Pheme{
+			Version:   1,
+			CreatedAt: time.Now(),
+			Category:  "News",
+			Text:      "old",
+			CreatedBy: 1,
+			UserID:    1,
+		}
+		if err := db.Create(&pheme).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func storedVersions(t *testing.T, db *gorm.DB) []uint {
+	t.Helper()
+
+	versions := []uint{}
+	if err := db.Model(&models.Pheme{}).Order("id").Pluck("version", &versions).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	return versions
+}
+
+func TestUpgradeOnRead(t *testing.T) {
+	db := openSQLite(t)
+	insertPhemes(t, db, 1)
+	registerPhemeUpgrade(t)
+
+	store := NewGorm(db)
+
+	phemes, err := store.FetchUserPhemes(context.Background(), 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if phemes[0].Version != 2 || phemes[0].Category != "news" {
+		t.Errorf("got pheme %+v, want it upgraded", phemes[0])
+	}
+	if versions := storedVersions(t, db); versions[0] != 1 {
+		t.Errorf("got stored version %d without rewrite, want 1", versions[0])
+	}
+
+	store.RewriteUpgraded = true
+	if _, err := store.FetchPheme(context.Background(), phemes[0].ID, 1); err != nil {
+		t.Fatal(err)
+	}
+	if versions := storedVersions(t, db); versions[0] != 2 {
+		t.Errorf("got stored version %d with rewrite, want 2", versions[0])
+	}
+}
+
+func TestBackfill(t *testing.T) {
+	db := openSQLite(t)
+	insertPhemes(t, db, 5)
+	registerPhemeUpgrade(t)
+
+	reports := []models.BackfillProgress{}
+	err := NewGorm(db).BackfillPhemes(context.Background(), 2, func(progress models.BackfillProgress) {
+		reports = append(reports, progress)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reports) != 3 {
+		t.Fatalf("got %d reports, want 3", len(reports))
+	}
+
+	last := reports[len(reports)-1]
+	if last.Total != 5 || last.Done != 5 || last.Upgraded != 5 || last.Failed != 0 {
+		t.Errorf("got progress %+v", last)
+	}
+
+	for _, version := range storedVersions(t, db) {
+		if version != 2 {
+			t.Errorf("got stored version %d, want 2", version)
+		}
+	}
+
+	phemes := []models.Pheme{}
+	if err := db.Find(&phemes, "category = ?", "news").Error; err != nil || len(phemes) != 5 {
+		t.Errorf("got %d upgraded phemes, %v, want 5", len(phemes), err)
+	}
+}
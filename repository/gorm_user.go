@@ -0,0 +1,224 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/feserr/pheme-user/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FindAuthUser returns the user with its roles.
+func (r *Gorm) FindAuthUser(ctx context.Context, userID uint) (models.User, error) {
+	user := models.User{}
+	if err := r.conn(ctx).Preload("Roles").First(&user, userID).Error; err != nil {
+		return user, notFound(err)
+	}
+
+	return user, r.upgradeUser(ctx, &user)
+}
+
+// userColumns are the columns referencing the users, by table.
+var userColumns = []struct {
+	table   string
+	columns []string
+}{
+	{"pheme_reactions", []string{"user_id"}},
+	{"phemes", []string{"user_id", "created_by"}},
+	{"friendship", []string{"user_id", "friend_id"}},
+	{"followship", []string{"user_id", "follower_id"}},
+	{"user_roles", []string{"user_id"}},
+	{"personal_access_tokens", []string{"user_id"}},
+	{"idempotency_keys", []string{"user_id"}},
+	{"account_deletions", []string{"user_id"}},
+	{"exports", []string{"user_id"}},
+}
+
+// DeleteByID deletes the user by the ID with all its phemes, authored and
+// received, reactions, relationships, roles, tokens, idempotency keys and
+// exports, in a transaction: the foreign keys don't let the user go with any
+// of them left. The reactions of the others to its phemes go with them.
+func (r *Gorm) DeleteByID(ctx context.Context, userID uint) error {
+	return r.Transaction(ctx, func(ctx context.Context) error {
+		for _, references := range userColumns {
+			conditions := make([]string, len(references.columns))
+			args := make([]interface{}, len(references.columns))
+			for i, column := range references.columns {
+				conditions[i] = column + " = ?"
+				args[i] = userID
+			}
+
+			query := "DELETE FROM " + references.table + " WHERE " + strings.Join(conditions, " OR ")
+			if err := r.conn(ctx).Exec(query, args...).Error; err != nil {
+				return err
+			}
+		}
+
+		deletedUser := r.conn(ctx).Delete(&models.User{}, userID)
+		if deletedUser.Error != nil {
+			return deletedUser.Error
+		}
+
+		if deletedUser.RowsAffected < 1 {
+			return models.ErrNotFound
+		}
+
+		return nil
+	})
+}
+
+// FindByID returns the user from the ID.
+func (r *Gorm) FindByID(ctx context.Context, userID uint) (models.User, error) {
+	user := models.User{}
+	if err := r.conn(ctx).First(&user, userID).Error; err != nil {
+		return user, notFound(err)
+	}
+
+	return user, r.upgradeUser(ctx, &user)
+}
+
+// FindByName returns the users that contains the name.
+func (r *Gorm) FindByName(ctx context.Context, userName string) ([]models.User, error) {
+	users := []models.User{}
+	usersByName := r.conn(ctx).Model(&models.User{}).Select("id, name").Order("created_at desc").Find(&users, "name LIKE ?", "%"+userName+"%")
+	if usersByName.Error != nil {
+		return users, usersByName.Error
+	}
+
+	return users, nil
+}
+
+// IsFriend returns if it is friend or not.
+func (r *Gorm) IsFriend(ctx context.Context, userID uint, friendID uint) (bool, error) {
+	return r.related(r.conn(ctx), "friendship", "friend_id", userID, friendID)
+}
+
+// related returns if the other user is in the relationship table of the user.
+func (r *Gorm) related(db *gorm.DB, table string, column string, userID uint, otherID uint) (bool, error) {
+	ids := []uint{}
+	if err := db.Table(table).Select(column).Limit(1).Find(&ids, "user_id = ? AND "+column+" = ?", userID, otherID).Error; err != nil {
+		return false, err
+	}
+
+	return len(ids) > 0, nil
+}
+
+// GetFriends returns the friends of a user.
+func (r *Gorm) GetFriends(ctx context.Context, userID uint) ([]uint, error) {
+	friends := []uint{}
+	allFriends := r.conn(ctx).Table("friendship").Select("friend_id").Find(&friends, "user_id = ?", userID)
+	if allFriends.Error != nil {
+		return friends, allFriends.Error
+	}
+
+	return friends, nil
+}
+
+// GetFollowers returns the followers of a user.
+func (r *Gorm) GetFollowers(ctx context.Context, userID uint) ([]uint, error) {
+	followers := []uint{}
+	allFollowers := r.conn(ctx).Table("followship").Select("follower_id").Find(&followers, "user_id = ?", userID)
+	if allFollowers.Error != nil {
+		return followers, allFollowers.Error
+	}
+
+	return followers, nil
+}
+
+// lockUsers locks the users until the end of the transaction, so they can't
+// be removed, failing if any of them doesn't exist.
+func (r *Gorm) lockUsers(ctx context.Context, userIDs ...uint) error {
+	for _, userID := range userIDs {
+		user := models.User{}
+		if err := r.conn(ctx).Clauses(clause.Locking{Strength: "SHARE"}).Select("id").First(&user, userID).Error; err != nil {
+			return notFound(err)
+		}
+	}
+
+	return nil
+}
+
+// relate adds or removes the other user to the relationship table of the user
+// in a transaction with both users locked. Adding an existing relationship
+// does nothing, the unique index of the table prevents the repeated rows.
+func (r *Gorm) relate(ctx context.Context, table string, column string, userID uint, otherID uint, related bool) error {
+	return r.Transaction(ctx, func(ctx context.Context) error {
+		if err := r.lockUsers(ctx, userID, otherID); err != nil {
+			return err
+		}
+
+		if !related {
+			return r.conn(ctx).Exec("DELETE FROM "+table+" WHERE user_id = ? AND "+column+" = ?", userID, otherID).Error
+		}
+
+		row := map[string]interface{}{"user_id": userID, column: otherID}
+		return r.conn(ctx).Table(table).Clauses(clause.OnConflict{DoNothing: true}).Create(row).Error
+	})
+}
+
+// AddFriend adds a friends to a user.
+func (r *Gorm) AddFriend(ctx context.Context, userID uint, friendID uint) error {
+	return r.relate(ctx, "friendship", "friend_id", userID, friendID, true)
+}
+
+// AddFollower adds a follower to a user.
+func (r *Gorm) AddFollower(ctx context.Context, userID uint, followerID uint) error {
+	return r.relate(ctx, "followship", "follower_id", userID, followerID, true)
+}
+
+// RemoveFriend removes a friends for a user.
+func (r *Gorm) RemoveFriend(ctx context.Context, userID uint, friendID uint) error {
+	return r.relate(ctx, "friendship", "friend_id", userID, friendID, false)
+}
+
+// RemoveFollower removes a follower for a user.
+func (r *Gorm) RemoveFollower(ctx context.Context, userID uint, followerID uint) error {
+	return r.relate(ctx, "followship", "follower_id", userID, followerID, false)
+}
+
+// GetRoles returns the roles granted to a user.
+func (r *Gorm) GetRoles(ctx context.Context, userID uint) ([]models.UserRole, error) {
+	roles := []models.UserRole{}
+	allRoles := r.conn(ctx).Model(&models.UserRole{}).Order("created_at").Find(&roles, "user_id = ?", userID)
+	if allRoles.Error != nil {
+		return roles, allRoles.Error
+	}
+
+	return roles, nil
+}
+
+// GrantRole grants a role to a user.
+func (r *Gorm) GrantRole(ctx context.Context, userID uint, role models.Role, grantedBy uint) error {
+	if _, err := r.FindByID(ctx, userID); err != nil {
+		return err
+	}
+
+	userRole := models.UserRole{
+		UserID:    userID,
+		Role:      role,
+		GrantedBy: grantedBy,
+		CreatedAt: time.Now(),
+	}
+
+	if err := r.conn(ctx).FirstOrCreate(&userRole, models.UserRole{UserID: userID, Role: role}).Error; err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RevokeRole revokes a role from a user.
+func (r *Gorm) RevokeRole(ctx context.Context, userID uint, role models.Role) error {
+	revokedRole := r.conn(ctx).Delete(&models.UserRole{}, "user_id = ? AND role = ?", userID, role)
+	if revokedRole.Error != nil {
+		return revokedRole.Error
+	}
+
+	if revokedRole.RowsAffected < 1 {
+		return models.ErrRoleNotGranted
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/feserr/pheme-user/models"
+	"gorm.io/gorm"
+)
+
+func insertUsers(t *testing.T, db *gorm.DB, names ...string) []uint {
+	t.Helper()
+
+	ids := []uint{}
+	for _, name := range names {
+		user := models.User{
+			Version:      models.UserVersion(),
+			Name:         name,
+			Email:        name + "@user.com",
+			Password:     []byte("password"),
+			PasswordDate: time.Now(),
+			CreatedAt:    time.Now(),
+		}
+		if err := db.Create(&user).Error; err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, user.ID)
+	}
+
+	return ids
+}
+
+func countRows(t *testing.T, db *gorm.DB, table string) int64 {
+	t.Helper()
+
+	var count int64
+	if err := db.Table(table).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	return count
+}
+
+func TestConcurrentRelationships(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		repo := NewGorm(db)
+		ids := insertUsers(t, db, "alice", "bob")
+		ctx := context.Background()
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 40)
+		for i := 0; i < 20; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				errs <- repo.AddFriend(ctx, ids[0], ids[1])
+			}()
+			go func() {
+				defer wg.Done()
+				errs <- repo.AddFollower(ctx, ids[0], ids[1])
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			if err != nil {
+				t.Errorf("adding a relationship concurrently: %v", err)
+			}
+		}
+
+		if friends, followers := countRows(t, db, "friendship"), countRows(t, db, "followship"); friends != 1 || followers != 1 {
+			t.Errorf("got %d friendships and %d followships, want 1 of each", friends, followers)
+		}
+
+		if err := repo.AddFriend(ctx, 99, ids[1]); !errors.Is(err, models.ErrNotFound) {
+			t.Errorf("got %v adding a friend to an unknown user, want not found", err)
+		}
+		if err := repo.AddFollower(ctx, ids[0], 99); !errors.Is(err, models.ErrNotFound) {
+			t.Errorf("got %v adding an unknown follower, want not found", err)
+		}
+		if friends := countRows(t, db, "friendship"); friends != 1 {
+			t.Errorf("got %d friendships, want the unknown users not related", friends)
+		}
+	})
+}
+
+func TestCreatePhemeWhileUnfriended(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		repo := NewGorm(db)
+		ids := insertUsers(t, db, "alice", "bob")
+		ctx := context.Background()
+
+		if err := repo.AddFriend(ctx, ids[0], ids[1]); err != nil {
+			t.Fatal(err)
+		}
+
+		// Remove the friendship between the check and the insert of the pheme: it
+		// must wait for the pheme, created while they were friends.
+		removed := make(chan error, 1)
+		var once sync.Once
+		err := db.Callback().Create().Before("gorm:begin_transaction").Register("test:unfriend", func(tx *gorm.DB) {
+			if tx.Statement.Table != "phemes" {
+				return
+			}
+
+			once.Do(func() {
+				go func() { removed <- repo.RemoveFriend(ctx, ids[0], ids[1]) }()
+
+				select {
+				case err := <-removed:
+					t.Errorf("the friendship was removed during the creation of the pheme: %v", err)
+				case <-time.After(100 * time.Millisecond):
+				}
+			})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pheme := models.Pheme{Version: 1, CreatedAt: time.Now(), Category: "test", Text: "for a friend", CreatedBy: ids[0], UserID: ids[1]}
+		id, err := repo.CreatePheme(ctx, pheme)
+		if err != nil || id == 0 {
+			t.Fatalf("got %d, %v creating the pheme for a friend", id, err)
+		}
+
+		select {
+		case err := <-removed:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("the friendship was not removed after the creation of the pheme")
+		}
+
+		if id, err := repo.CreatePheme(ctx, pheme); err != nil || id != 0 {
+			t.Errorf("got %d, %v creating a pheme for a former friend, want 0", id, err)
+		}
+		if phemes := countRows(t, db, "phemes"); phemes != 1 {
+			t.Errorf("got %d phemes, want 1", phemes)
+		}
+	})
+}
@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/feserr/pheme-user/models"
+)
+
+// Memory stores the models in memory, for tests and local development.
+type Memory struct {
+	mu         sync.RWMutex
+	users      map[uint]models.User
+	phemes     map[uint]models.Pheme
+	friendship map[uint]map[uint]bool
+	followship map[uint]map[uint]bool
+	roles      map[uint]map[models.Role]models.UserRole
+	tokens     map[uint]models.PersonalAccessToken
+	keys       map[uint]models.IdempotencyKey
+	deletions  map[uint]models.AccountDeletion
+	exports    map[uint]models.Export
+	reactions  map[reactionKey]models.Reaction
+	lastID     uint
+}
+
+// NewMemory returns empty in-memory repositories.
+func NewMemory() *Memory {
+	return &Memory{
+		users:      map[uint]models.User{},
+		phemes:     map[uint]models.Pheme{},
+		friendship: map[uint]map[uint]bool{},
+		followship: map[uint]map[uint]bool{},
+		roles:      map[uint]map[models.Role]models.UserRole{},
+		tokens:     map[uint]models.PersonalAccessToken{},
+		keys:       map[uint]models.IdempotencyKey{},
+		deletions:  map[uint]models.AccountDeletion{},
+		exports:    map[uint]models.Export{},
+		reactions:  map[reactionKey]models.Reaction{},
+	}
+}
+
+// nextID returns a new unique ID, it must be called with the lock held.
+func (r *Memory) nextID() uint {
+	r.lastID++
+	return r.lastID
+}
+
+// Transaction runs fn restoring the data as it was before it when it fails.
+// Unlike the database, the changes of fn are seen by the concurrent operations
+// before it returns.
+func (r *Memory) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	restore := r.snapshot()
+	if err := fn(ctx); err != nil {
+		restore()
+		return err
+	}
+
+	return nil
+}
+
+// snapshot copies the data and returns the function restoring it. The IDs are
+// not reused, like the sequences of a database.
+func (r *Memory) snapshot() func() {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := copyMap(r.users)
+	phemes := copyMap(r.phemes)
+	friendship := copyNestedMap(r.friendship)
+	followship := copyNestedMap(r.followship)
+	roles := copyNestedMap(r.roles)
+	tokens := copyMap(r.tokens)
+	keys := copyMap(r.keys)
+	deletions := copyMap(r.deletions)
+	exports := copyMap(r.exports)
+	reactions := copyMap(r.reactions)
+
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		r.users = users
+		r.phemes = phemes
+		r.friendship = friendship
+		r.followship = followship
+		r.roles = roles
+		r.tokens = tokens
+		r.keys = keys
+		r.deletions = deletions
+		r.exports = exports
+		r.reactions = reactions
+	}
+}
+
+func copyMap[K comparable, V any](m map[K]V) map[K]V {
+	copied := make(map[K]V, len(m))
+	for k, v := range m {
+		copied[k] = v
+	}
+
+	return copied
+}
+
+func copyNestedMap[K comparable, L comparable, V any](m map[K]map[L]V) map[K]map[L]V {
+	copied := make(map[K]map[L]V, len(m))
+	for k, v := range m {
+		copied[k] = copyMap(v)
+	}
+
+	return copied
+}
+
+// sortPhemes orders the phemes by creation date, newest first.
+func sortPhemes(phemes []models.Pheme) {
+	sort.SliceStable(phemes, func(i, j int) bool {
+		if phemes[i].CreatedAt.Equal(phemes[j].CreatedAt) {
+			return phemes[i].ID > phemes[j].ID
+		}
+
+		return phemes[i].CreatedAt.After(phemes[j].CreatedAt)
+	})
+}
+
+// relationIDs returns the related IDs of a user, it must be called with the lock held.
+func relationIDs(relation map[uint]map[uint]bool, userID uint) []uint {
+	ids := []uint{}
+	for id := range relation[userID] {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+var (
+	_ models.PhemeRepository           = (*Memory)(nil)
+	_ models.UserRepository            = (*Memory)(nil)
+	_ models.TokenRepository           = (*Memory)(nil)
+	_ models.IdempotencyRepository     = (*Memory)(nil)
+	_ models.AccountDeletionRepository = (*Memory)(nil)
+	_ models.ExportRepository          = (*Memory)(nil)
+	_ models.ReactionRepository        = (*Memory)(nil)
+	_ models.Transactor                = (*Memory)(nil)
+)
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/feserr/pheme-user/models"
+)
+
+// ScheduleAccountDeletion schedules the deletion of the account of a user,
+// unless it is already scheduled: then it returns that one.
+func (r *Memory) ScheduleAccountDeletion(ctx context.Context, deletion models.AccountDeletion) (models.AccountDeletion, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[deletion.UserID]; !ok {
+		return deletion, models.ErrNotFound
+	}
+
+	if existing, ok := r.deletions[deletion.UserID]; ok {
+		return existing, nil
+	}
+
+	r.deletions[deletion.UserID] = deletion
+	return deletion, nil
+}
+
+// FindAccountDeletion returns the scheduled deletion of the account of a user.
+func (r *Memory) FindAccountDeletion(ctx context.Context, userID uint) (models.AccountDeletion, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	deletion, ok := r.deletions[userID]
+	if !ok {
+		return deletion, models.ErrDeletionNotFound
+	}
+
+	return deletion, nil
+}
+
+// CancelAccountDeletion cancels the scheduled deletion of the account of a user.
+func (r *Memory) CancelAccountDeletion(ctx context.Context, userID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.deletions[userID]; !ok {
+		return models.ErrDeletionNotFound
+	}
+
+	delete(r.deletions, userID)
+	return nil
+}
+
+// DueAccountDeletions returns up to limit deletions scheduled before the time.
+func (r *Memory) DueAccountDeletions(ctx context.Context, now time.Time, limit int) ([]models.AccountDeletion, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	deletions := []models.AccountDeletion{}
+	for _, deletion := range r.deletions {
+		if !deletion.ScheduledAt.After(now) {
+			deletions = append(deletions, deletion)
+		}
+	}
+
+	sort.Slice(deletions, func(i, j int) bool {
+		return deletions[i].ScheduledAt.Before(deletions[j].ScheduledAt)
+	})
+	if len(deletions) > limit {
+		deletions = deletions[:limit]
+	}
+
+	return deletions, nil
+}
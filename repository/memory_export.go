@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/feserr/pheme-user/models"
+)
+
+// CreateExport adds an export of a user, unless one is pending or running:
+// then it returns that one.
+func (r *Memory) CreateExport(ctx context.Context, export models.Export) (models.Export, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[export.UserID]; !ok {
+		return export, models.ErrNotFound
+	}
+
+	for _, pending := range r.exports {
+		if pending.UserID == export.UserID && (pending.Status == models.ExportPending || pending.Status == models.ExportRunning) {
+			return pending, nil
+		}
+	}
+
+	export.ID = r.nextID()
+	r.exports[export.ID] = export
+	return export, nil
+}
+
+// FindExport returns an export of a user, without its archive.
+func (r *Memory) FindExport(ctx context.Context, exportID uint, userID uint) (models.Export, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	export, ok := r.exports[exportID]
+	if !ok || export.UserID != userID {
+		return models.Export{}, models.ErrExportNotFound
+	}
+
+	export.Archive = nil
+	return export, nil
+}
+
+// FetchExportArchive returns the archive of a ready export of a user.
+func (r *Memory) FetchExportArchive(ctx context.Context, exportID uint, userID uint) ([]byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	export, ok := r.exports[exportID]
+	if !ok || export.UserID != userID || export.Status != models.ExportReady {
+		return nil, models.ErrExportNotFound
+	}
+
+	return export.Archive, nil
+}
+
+// ClaimExports marks up to limit exports as running since now and returns
+// them, the oldest first: the pending ones and the running ones claimed before
+// stale.
+func (r *Memory) ClaimExports(ctx context.Context, now time.Time, stale time.Time, limit int) ([]models.Export, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	exports := []models.Export{}
+	for _, export := range r.exports {
+		lost := export.Status == models.ExportRunning && export.ClaimedAt != nil && export.ClaimedAt.Before(stale)
+		if export.Status == models.ExportPending || lost {
+			exports = append(exports, export)
+		}
+	}
+
+	sort.Slice(exports, func(i, j int) bool { return exports[i].ID < exports[j].ID })
+	if len(exports) > limit {
+		exports = exports[:limit]
+	}
+
+	for i := range exports {
+		claimedAt := now
+		exports[i].Status = models.ExportRunning
+		exports[i].ClaimedAt = &claimedAt
+		r.exports[exports[i].ID] = exports[i]
+		exports[i].Archive = nil
+	}
+
+	return exports, nil
+}
+
+// CompleteExport stores the status, size and archive of an export, unless it
+// was claimed again since its claim: then it returns false.
+func (r *Memory) CompleteExport(ctx context.Context, export models.Export) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	completed, ok := r.exports[export.ID]
+	claimed := ok && completed.Status == models.ExportRunning && completed.ClaimedAt != nil && export.ClaimedAt != nil
+	if !claimed || !completed.ClaimedAt.Equal(*export.ClaimedAt) {
+		return false, nil
+	}
+
+	completed.Status = export.Status
+	completed.Size = export.Size
+	completed.CompletedAt = export.CompletedAt
+	completed.Archive = export.Archive
+	r.exports[export.ID] = completed
+	return true, nil
+}
+
+// DeleteExports removes the exports created before the time.
+func (r *Memory) DeleteExports(ctx context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deleted int64
+	for id, export := range r.exports {
+		if export.CreatedAt.Before(before) {
+			delete(r.exports, id)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/feserr/pheme-user/models"
+)
+
+// ReserveIdempotencyKey stores the key of a request in flight, unless the user
+// has it and it is not expired: then it returns that one and false.
+func (r *Memory) ReserveIdempotencyKey(ctx context.Context, key models.IdempotencyKey) (models.IdempotencyKey, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, existing := range r.keys {
+		if existing.UserID != key.UserID || existing.Key != key.Key {
+			continue
+		}
+
+		if !existing.Expired(key.CreatedAt) {
+			return existing, false, nil
+		}
+
+		delete(r.keys, id)
+	}
+
+	key.ID = r.nextID()
+	r.keys[key.ID] = key
+
+	return key, true, nil
+}
+
+// CompleteIdempotencyKey stores the response of the request of the key and
+// its expiration.
+func (r *Memory) CompleteIdempotencyKey(ctx context.Context, key models.IdempotencyKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.keys[key.ID]
+	if !ok {
+		return models.ErrNotFound
+	}
+
+	existing.Status = key.Status
+	existing.ContentType = key.ContentType
+	existing.Body = key.Body
+	existing.ExpiresAt = key.ExpiresAt
+	r.keys[key.ID] = existing
+
+	return nil
+}
+
+// ReleaseIdempotencyKey removes the key, so the request can be retried.
+func (r *Memory) ReleaseIdempotencyKey(ctx context.Context, keyID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.keys, keyID)
+
+	return nil
+}
+
+// DeleteExpiredIdempotencyKeys removes the keys expired at the time.
+func (r *Memory) DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deleted int64
+	for id, key := range r.keys {
+		if key.Expired(now) {
+			delete(r.keys, id)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,282 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/feserr/pheme-user/models"
+	"gorm.io/gorm"
+)
+
+// userPhemes returns the phemes of the users with equal or higher visibility,
+// it must be called with the lock held.
+func (r *Memory) userPhemes(userIDs []uint, visibility byte) []models.Pheme {
+	users := map[uint]bool{}
+	for _, userID := range userIDs {
+		users[userID] = true
+	}
+
+	phemes := []models.Pheme{}
+	for _, pheme := range r.phemes {
+		if users[pheme.UserID] && pheme.Visibility >= visibility && !pheme.DeletedAt.Valid {
+			phemes = append(phemes, pheme)
+		}
+	}
+
+	sortPhemes(phemes)
+	return phemes
+}
+
+// FetchAllPhemes returns all the phemes of a user, friends and followers with equal or higher visibility.
+func (r *Memory) FetchAllPhemes(ctx context.Context, userID uint) ([]models.Pheme, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	phemes := r.userPhemes([]uint{userID}, byte(models.PRIVATE))
+	phemes = append(phemes, r.userPhemes(relationIDs(r.friendship, userID), byte(models.PROTECTED))...)
+	phemes = append(phemes, r.userPhemes(relationIDs(r.followship, userID), byte(models.PUBLIC))...)
+
+	return phemes, nil
+}
+
+// FetchUserPhemes returns all the phemes of the logged user with equal or higher visibility.
+func (r *Memory) FetchUserPhemes(ctx context.Context, userID uint, visibility byte) ([]models.Pheme, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.userPhemes([]uint{userID}, visibility), nil
+}
+
+// FetchPheme returns the pheme if is visible for the user.
+func (r *Memory) FetchPheme(ctx context.Context, phemeID uint, userID uint) (models.Pheme, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	pheme := r.phemes[phemeID]
+	if pheme.CreatedBy != userID || pheme.UserID != userID || pheme.DeletedAt.Valid {
+		return models.Pheme{}, models.ErrPhemeNotFound
+	}
+
+	return pheme, nil
+}
+
+// FindPheme returns the pheme of any user, unless it is trashed.
+func (r *Memory) FindPheme(ctx context.Context, phemeID uint) (models.Pheme, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	pheme, ok := r.phemes[phemeID]
+	if !ok || pheme.DeletedAt.Valid {
+		return models.Pheme{}, models.ErrPhemeNotFound
+	}
+
+	return pheme, nil
+}
+
+// FetchPhemes returns the phemes of the IDs visible for the user, skipping the others.
+func (r *Memory) FetchPhemes(ctx context.Context, phemeIDs []uint, userID uint) ([]models.Pheme, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	phemes := []models.Pheme{}
+	for _, phemeID := range phemeIDs {
+		pheme, ok := r.phemes[phemeID]
+		if ok && pheme.CreatedBy == userID && pheme.UserID == userID && !pheme.DeletedAt.Valid {
+			phemes = append(phemes, pheme)
+		}
+	}
+
+	sort.Slice(phemes, func(i, j int) bool { return phemes[i].ID < phemes[j].ID })
+	return phemes, nil
+}
+
+// CreatePheme adds a pheme.
+func (r *Memory) CreatePheme(ctx context.Context, pheme models.Pheme) (uint, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if pheme.CreatedBy != pheme.UserID && !r.friendship[pheme.CreatedBy][pheme.UserID] {
+		return 0, nil
+	}
+
+	pheme.ID = r.nextID()
+	if pheme.UpdatedAt.IsZero() {
+		pheme.UpdatedAt = pheme.CreatedAt
+	}
+	r.phemes[pheme.ID] = pheme
+
+	return pheme.ID, nil
+}
+
+// trash moves a pheme to the trash for the user, it must be called with the
+// lock held.
+func (r *Memory) trash(pheme models.Pheme, userID uint) models.Pheme {
+	pheme.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	pheme.DeletedBy = &userID
+	r.phemes[pheme.ID] = pheme
+	return pheme
+}
+
+// DeletePheme moves a pheme of a user to the trash, returns the trashed pheme.
+func (r *Memory) DeletePheme(ctx context.Context, phemeID uint, userID uint) (models.Pheme, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pheme, ok := r.phemes[phemeID]
+	if !ok || pheme.UserID != userID || pheme.DeletedAt.Valid {
+		return models.Pheme{}, models.ErrPhemeNotFound
+	}
+
+	return r.trash(pheme, userID), nil
+}
+
+// DeletePhemeByID moves a pheme of any user to the trash for the moderator,
+// returns the trashed pheme.
+func (r *Memory) DeletePhemeByID(ctx context.Context, phemeID uint, moderatorID uint) (models.Pheme, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pheme, ok := r.phemes[phemeID]
+	if !ok || pheme.DeletedAt.Valid {
+		return models.Pheme{}, models.ErrPhemeNotFound
+	}
+
+	return r.trash(pheme, moderatorID), nil
+}
+
+// FetchTrash returns the trashed phemes of a user, the last trashed first.
+func (r *Memory) FetchTrash(ctx context.Context, userID uint) ([]models.Pheme, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	phemes := []models.Pheme{}
+	for _, pheme := range r.phemes {
+		if pheme.UserID == userID && pheme.DeletedAt.Valid {
+			phemes = append(phemes, pheme)
+		}
+	}
+
+	sort.Slice(phemes, func(i, j int) bool {
+		if phemes[i].DeletedAt.Time.Equal(phemes[j].DeletedAt.Time) {
+			return phemes[i].ID > phemes[j].ID
+		}
+
+		return phemes[i].DeletedAt.Time.After(phemes[j].DeletedAt.Time)
+	})
+	return phemes, nil
+}
+
+// RestorePheme moves a pheme of a user out of the trash, unless another user
+// moved it there.
+func (r *Memory) RestorePheme(ctx context.Context, phemeID uint, userID uint) (models.Pheme, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pheme, ok := r.phemes[phemeID]
+	if !ok || pheme.UserID != userID || !pheme.DeletedAt.Valid {
+		return models.Pheme{}, models.ErrPhemeNotFound
+	}
+
+	if pheme.DeletedBy == nil || *pheme.DeletedBy != userID {
+		return models.Pheme{}, models.ErrPhemeModerated
+	}
+
+	pheme.DeletedAt = gorm.DeletedAt{}
+	pheme.DeletedBy = nil
+	r.phemes[phemeID] = pheme
+	return pheme, nil
+}
+
+// PurgeTrash removes for good the phemes trashed before the time.
+func (r *Memory) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var purged int64
+	for id, pheme := range r.phemes {
+		if pheme.DeletedAt.Valid && pheme.DeletedAt.Time.Before(before) {
+			delete(r.phemes, id)
+			purged++
+		}
+	}
+
+	r.deleteReactions(func(key reactionKey) bool {
+		_, ok := r.phemes[key.phemeID]
+		return !ok
+	})
+	return purged, nil
+}
+
+// ImportPhemes adds the imported phemes, skipping the ones with the import key
+// of a pheme of the user, returns the number of added phemes.
+func (r *Memory) ImportPhemes(ctx context.Context, phemes []models.Pheme) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	type userKey struct {
+		userID uint
+		key    string
+	}
+
+	keys := map[userKey]bool{}
+	for _, pheme := range r.phemes {
+		if pheme.ImportKey != nil {
+			keys[userKey{pheme.UserID, *pheme.ImportKey}] = true
+		}
+	}
+
+	imported := 0
+	for _, pheme := range phemes {
+		if pheme.ImportKey != nil {
+			key := userKey{pheme.UserID, *pheme.ImportKey}
+			if keys[key] {
+				continue
+			}
+			keys[key] = true
+		}
+
+		pheme.ID = r.nextID()
+		r.phemes[pheme.ID] = pheme
+		imported++
+	}
+
+	return imported, nil
+}
+
+// FetchPersonalPhemes returns all the phemes authored or received by a user,
+// the trashed ones included.
+func (r *Memory) FetchPersonalPhemes(ctx context.Context, userID uint) ([]models.Pheme, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	phemes := []models.Pheme{}
+	for _, pheme := range r.phemes {
+		if pheme.UserID == userID || pheme.CreatedBy == userID {
+			phemes = append(phemes, pheme)
+		}
+	}
+
+	sort.Slice(phemes, func(i, j int) bool { return phemes[i].ID < phemes[j].ID })
+	return phemes, nil
+}
+
+// UpdatePheme updates the data of a pheme.
+func (r *Memory) UpdatePheme(ctx context.Context, pheme models.PhemeParamsPost, phemeID uint, userID uint) (models.Pheme, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	oldPheme, ok := r.phemes[phemeID]
+	if !ok || oldPheme.CreatedBy != userID || oldPheme.DeletedAt.Valid {
+		return models.Pheme{}, models.ErrPhemeNotFound
+	}
+
+	oldPheme.Version = models.PhemeVersion()
+	oldPheme.UpdatedAt = time.Now()
+	oldPheme.Visibility = pheme.Visibilty
+	oldPheme.Category = pheme.Category
+	oldPheme.Text = pheme.Text
+	r.phemes[phemeID] = oldPheme
+
+	return oldPheme, nil
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"sort"
+
+	"github.com/feserr/pheme-user/models"
+)
+
+// reactionKey identifies the reaction of a user to a pheme.
+type reactionKey struct {
+	phemeID uint
+	userID  uint
+}
+
+// SetReaction adds the reaction of the user to the pheme or replaces the
+// previous one, returns false if the user already had that one.
+func (r *Memory) SetReaction(ctx context.Context, reaction models.Reaction) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.phemes[reaction.PhemeID]; !ok {
+		return false, models.ErrPhemeNotFound
+	}
+
+	key := reactionKey{phemeID: reaction.PhemeID, userID: reaction.UserID}
+	if existing, ok := r.reactions[key]; ok && existing.Emoji == reaction.Emoji {
+		return false, nil
+	}
+
+	r.reactions[key] = reaction
+	return true, nil
+}
+
+// DeleteReaction removes the reaction of the user to the pheme.
+func (r *Memory) DeleteReaction(ctx context.Context, phemeID uint, userID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := reactionKey{phemeID: phemeID, userID: userID}
+	if _, ok := r.reactions[key]; !ok {
+		return models.ErrReactionNotFound
+	}
+
+	delete(r.reactions, key)
+	return nil
+}
+
+// FetchReactions returns the reactions to the pheme, the oldest first.
+func (r *Memory) FetchReactions(ctx context.Context, phemeID uint) ([]models.Reaction, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	reactions := []models.Reaction{}
+	for key, reaction := range r.reactions {
+		if key.phemeID == phemeID {
+			reactions = append(reactions, reaction)
+		}
+	}
+
+	sort.Slice(reactions, func(i, j int) bool {
+		if reactions[i].CreatedAt.Equal(reactions[j].CreatedAt) {
+			return reactions[i].UserID < reactions[j].UserID
+		}
+
+		return reactions[i].CreatedAt.Before(reactions[j].CreatedAt)
+	})
+	return reactions, nil
+}
+
+// deleteReactions removes the reactions matching the filter, it must be called
+// with the lock held.
+func (r *Memory) deleteReactions(match func(key reactionKey) bool) {
+	for key := range r.reactions {
+		if match(key) {
+			delete(r.reactions, key)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"time"
+
+	"github.com/feserr/pheme-user/models"
+)
+
+// CreateToken adds a personal access token.
+func (r *Memory) CreateToken(ctx context.Context, token models.PersonalAccessToken) (models.PersonalAccessToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token.ID = r.nextID()
+	r.tokens[token.ID] = token
+
+	return token, nil
+}
+
+// FetchTokens returns the personal access tokens of a user.
+func (r *Memory) FetchTokens(ctx context.Context, userID uint) ([]models.PersonalAccessToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tokens := []models.PersonalAccessToken{}
+	for _, token := range r.tokens {
+		if token.UserID == userID {
+			tokens = append(tokens, token)
+		}
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+	})
+
+	return tokens, nil
+}
+
+// FindTokenByHash returns the personal access token with the hash.
+func (r *Memory) FindTokenByHash(ctx context.Context, hash []byte) (models.PersonalAccessToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, token := range r.tokens {
+		if bytes.Equal(token.Hash, hash) {
+			return token, nil
+		}
+	}
+
+	return models.PersonalAccessToken{}, models.ErrNotFound
+}
+
+// TouchToken records the last time the token was used.
+func (r *Memory) TouchToken(ctx context.Context, tokenID uint, usedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.tokens[tokenID]
+	if !ok {
+		return models.ErrNotFound
+	}
+
+	token.LastUsedAt = &usedAt
+	r.tokens[tokenID] = token
+
+	return nil
+}
+
+// DeleteToken revokes a personal access token of a user.
+func (r *Memory) DeleteToken(ctx context.Context, tokenID uint, userID uint) (uint, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.tokens[tokenID]
+	if !ok || token.UserID != userID {
+		return tokenID, models.ErrTokenNotFound
+	}
+
+	delete(r.tokens, tokenID)
+	return tokenID, nil
+}
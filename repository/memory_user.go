@@ -0,0 +1,262 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/feserr/pheme-user/models"
+)
+
+// AddUser adds a user, the users are created by the pheme-auth service so it
+// is only used to seed the in-memory repository.
+func (r *Memory) AddUser(user models.User) models.User {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if user.ID == 0 {
+		user.ID = r.nextID()
+	} else if user.ID > r.lastID {
+		r.lastID = user.ID
+	}
+
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now()
+	}
+
+	user.Roles = nil
+	r.users[user.ID] = user
+
+	return user
+}
+
+// FindAuthUser returns the user with its roles.
+func (r *Memory) FindAuthUser(ctx context.Context, userID uint) (models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[userID]
+	if !ok {
+		return models.User{}, models.ErrNotFound
+	}
+
+	user.Roles = r.userRoles(userID)
+	return user, nil
+}
+
+// DeleteByID deletes the user by the ID with all its phemes, authored and
+// received, reactions, relationships, roles, tokens, idempotency keys and
+// exports.
+func (r *Memory) DeleteByID(ctx context.Context, userID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[userID]; !ok {
+		return models.ErrNotFound
+	}
+
+	for id, pheme := range r.phemes {
+		if pheme.UserID == userID || pheme.CreatedBy == userID {
+			delete(r.phemes, id)
+		}
+	}
+
+	r.deleteReactions(func(key reactionKey) bool {
+		_, ok := r.phemes[key.phemeID]
+		return key.userID == userID || !ok
+	})
+
+	for _, relation := range []map[uint]map[uint]bool{r.friendship, r.followship} {
+		delete(relation, userID)
+		for _, related := range relation {
+			delete(related, userID)
+		}
+	}
+
+	for id, token := range r.tokens {
+		if token.UserID == userID {
+			delete(r.tokens, id)
+		}
+	}
+
+	for id, key := range r.keys {
+		if key.UserID == userID {
+			delete(r.keys, id)
+		}
+	}
+
+	for id, export := range r.exports {
+		if export.UserID == userID {
+			delete(r.exports, id)
+		}
+	}
+
+	delete(r.roles, userID)
+	delete(r.deletions, userID)
+	delete(r.users, userID)
+	return nil
+}
+
+// FindByID returns the user from the ID.
+func (r *Memory) FindByID(ctx context.Context, userID uint) (models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[userID]
+	if !ok {
+		return models.User{}, models.ErrNotFound
+	}
+
+	return user, nil
+}
+
+// FindByName returns the users that contains the name.
+func (r *Memory) FindByName(ctx context.Context, userName string) ([]models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := []models.User{}
+	for _, user := range r.users {
+		if strings.Contains(user.Name, userName) {
+			users = append(users, models.User{ID: user.ID, Name: user.Name, CreatedAt: user.CreatedAt})
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].CreatedAt.After(users[j].CreatedAt)
+	})
+
+	for i := range users {
+		users[i].CreatedAt = time.Time{}
+	}
+
+	return users, nil
+}
+
+// IsFriend returns if it is friend or not.
+func (r *Memory) IsFriend(ctx context.Context, userID uint, friendID uint) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.friendship[userID][friendID], nil
+}
+
+// GetFriends returns the friends of a user.
+func (r *Memory) GetFriends(ctx context.Context, userID uint) ([]uint, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return relationIDs(r.friendship, userID), nil
+}
+
+// GetFollowers returns the followers of a user.
+func (r *Memory) GetFollowers(ctx context.Context, userID uint) ([]uint, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return relationIDs(r.followship, userID), nil
+}
+
+// relate adds or removes a relationship between two existing users.
+func (r *Memory) relate(relation map[uint]map[uint]bool, userID uint, otherID uint, related bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, id := range []uint{userID, otherID} {
+		if _, ok := r.users[id]; !ok {
+			return models.ErrNotFound
+		}
+	}
+
+	if related {
+		if relation[userID] == nil {
+			relation[userID] = map[uint]bool{}
+		}
+		relation[userID][otherID] = true
+	} else {
+		delete(relation[userID], otherID)
+	}
+
+	return nil
+}
+
+// AddFriend adds a friends to a user.
+func (r *Memory) AddFriend(ctx context.Context, userID uint, friendID uint) error {
+	return r.relate(r.friendship, userID, friendID, true)
+}
+
+// AddFollower adds a follower to a user.
+func (r *Memory) AddFollower(ctx context.Context, userID uint, followerID uint) error {
+	return r.relate(r.followship, userID, followerID, true)
+}
+
+// RemoveFriend removes a friends for a user.
+func (r *Memory) RemoveFriend(ctx context.Context, userID uint, friendID uint) error {
+	return r.relate(r.friendship, userID, friendID, false)
+}
+
+// RemoveFollower removes a follower for a user.
+func (r *Memory) RemoveFollower(ctx context.Context, userID uint, followerID uint) error {
+	return r.relate(r.followship, userID, followerID, false)
+}
+
+// userRoles returns the roles of a user, it must be called with the lock held.
+func (r *Memory) userRoles(userID uint) []models.UserRole {
+	roles := []models.UserRole{}
+	for _, role := range r.roles[userID] {
+		roles = append(roles, role)
+	}
+
+	sort.Slice(roles, func(i, j int) bool {
+		return roles[i].CreatedAt.Before(roles[j].CreatedAt)
+	})
+
+	return roles
+}
+
+// GetRoles returns the roles granted to a user.
+func (r *Memory) GetRoles(ctx context.Context, userID uint) ([]models.UserRole, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.userRoles(userID), nil
+}
+
+// GrantRole grants a role to a user.
+func (r *Memory) GrantRole(ctx context.Context, userID uint, role models.Role, grantedBy uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[userID]; !ok {
+		return models.ErrNotFound
+	}
+
+	if r.roles[userID] == nil {
+		r.roles[userID] = map[models.Role]models.UserRole{}
+	}
+
+	if _, ok := r.roles[userID][role]; !ok {
+		r.roles[userID][role] = models.UserRole{
+			UserID:    userID,
+			Role:      role,
+			GrantedBy: grantedBy,
+			CreatedAt: time.Now(),
+		}
+	}
+
+	return nil
+}
+
+// RevokeRole revokes a role from a user.
+func (r *Memory) RevokeRole(ctx context.Context, userID uint, role models.Role) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.roles[userID][role]; !ok {
+		return models.ErrRoleNotGranted
+	}
+
+	delete(r.roles[userID], role)
+	return nil
+}
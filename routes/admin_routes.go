@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"github.com/feserr/pheme-user/auth"
+	"github.com/feserr/pheme-user/controllers"
+	"github.com/feserr/pheme-user/middleware"
+	"github.com/feserr/pheme-user/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+func AdminSetup(app *fiber.App, service *controllers.Service, verifier *auth.Verifier) {
+	admin := app.Group("/api/v1/admin", authenticate(service, verifier)...)
+
+	manageRoles := middleware.RequirePermission(models.PermissionRolesManage)
+
+	admin.Get("/user/:id<int>/role", manageRoles, service.GetUserRoles)
+	admin.Put("/user/:id<int>/role/:role<alpha>", manageRoles, service.GrantRole)
+	admin.Delete("/user/:id<int>/role/:role<alpha>", manageRoles, service.RevokeRole)
+}
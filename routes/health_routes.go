@@ -0,0 +1,11 @@
+package routes
+
+import (
+	"github.com/feserr/pheme-user/controllers"
+	"github.com/gofiber/fiber/v2"
+)
+
+func HealthSetup(app *fiber.App, health *controllers.Health) {
+	app.Get("/healthz", health.Live)
+	app.Get("/readyz", health.Ready)
+}
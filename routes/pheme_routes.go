@@ -1,15 +1,37 @@
 package routes
 
 import (
+	"github.com/feserr/pheme-user/auth"
 	"github.com/feserr/pheme-user/controllers"
+	"github.com/feserr/pheme-user/middleware"
+	"github.com/feserr/pheme-user/models"
 	"github.com/gofiber/fiber/v2"
 )
 
-func PhemeSetup(app *fiber.App) {
-	app.Get("/api/v1/pheme", controllers.GetAllPhemes)
-	app.Get("/api/v1/pheme/mine", controllers.GetUserPhemes)
-	app.Get("/api/v1/pheme/:id<int>", controllers.GetPheme)
-	app.Post("/api/v1/pheme", controllers.PostPheme)
-	app.Delete("/api/v1/pheme/:id<int>", controllers.DeletePheme)
-	app.Put("/api/v1/pheme/:id<int>", controllers.UpdatePheme)
+func PhemeSetup(app *fiber.App, service *controllers.Service, verifier *auth.Verifier) {
+	pheme := app.Group("/api/v1/pheme", authenticate(service, verifier)...)
+
+	read := middleware.RequirePermission(models.PermissionPhemesRead)
+	write := middleware.RequirePermission(models.PermissionPhemesWrite)
+	phemesLimit := rateLimit(service, service.Limiter.Policies.Phemes)
+	phemesBatchLimit := rateLimitBatch(service, service.Limiter.Policies.Phemes, "phemes")
+	idempotency := idempotent(service)
+
+	pheme.Get("", read, service.GetAllPhemes)
+	pheme.Get("/mine", read, service.GetUserPhemes)
+	pheme.Get("/batch", read, service.GetPhemeBatch)
+	pheme.Get("/trash", read, service.GetTrash)
+	if service.Events != nil {
+		pheme.Get("/stream", read, service.StreamPhemes)
+	}
+	pheme.Get("/:id<int>", read, service.GetPheme)
+	pheme.Post("", write, phemesLimit, idempotency, service.PostPheme)
+	pheme.Post("/batch", write, phemesBatchLimit, idempotency, service.PostPhemeBatch)
+	pheme.Post("/import", write, phemesLimit, service.PostImport)
+	pheme.Delete("/:id<int>", write, service.DeletePheme)
+	pheme.Post("/:id<int>/restore", write, service.RestorePheme)
+	pheme.Put("/:id<int>", write, service.UpdatePheme)
+	pheme.Get("/:id<int>/reactions", read, service.GetReactions)
+	pheme.Put("/:id<int>/reaction", write, service.PutReaction)
+	pheme.Delete("/:id<int>/reaction", write, service.DeleteReaction)
 }
@@ -1,10 +1,96 @@
 package routes
 
 import (
+	"encoding/json"
+
+	"github.com/feserr/pheme-user/auth"
+	"github.com/feserr/pheme-user/controllers"
+	"github.com/feserr/pheme-user/middleware"
+	"github.com/feserr/pheme-user/ratelimit"
 	"github.com/gofiber/fiber/v2"
 )
 
-func Setup(app *fiber.App) {
-	PhemeSetup(app)
-	UserSetup(app)
+func Setup(app *fiber.App, service *controllers.Service, verifier *auth.Verifier) {
+	PhemeSetup(app, service, verifier)
+	UserSetup(app, service, verifier)
+	AdminSetup(app, service, verifier)
+}
+
+// authenticate returns the middlewares of the authenticated route groups. The
+// requests are limited by IP first, so the ones failing the authentication
+// are limited too. The public routes, as the health probes, the metrics and
+// the Swagger docs, are registered outside of these groups.
+func authenticate(service *controllers.Service, verifier *auth.Verifier) []fiber.Handler {
+	return []fiber.Handler{
+		rateLimit(service, service.Limiter.Policies.IP),
+		middleware.Authenticate(middleware.AuthConfig{
+			Verifier: verifier,
+			Users:    service.Users,
+			Tokens:   service.Tokens,
+			Logger:   service.Logger,
+		}),
+		middleware.CSRF(),
+		rateLimit(service, service.Limiter.Policies.Default),
+	}
+}
+
+// idempotent returns the middleware replaying the responses to the retries of
+// the requests with an Idempotency-Key. A request in flight keeps its key for
+// the write timeout of the server.
+func idempotent(service *controllers.Service) fiber.Handler {
+	if service.IdempotencyKeys == nil {
+		return func(c *fiber.Ctx) error {
+			return c.Next()
+		}
+	}
+
+	return middleware.Idempotency(middleware.IdempotencyConfig{
+		Keys:   service.IdempotencyKeys,
+		TTL:    service.IdempotencyTTL,
+		Lease:  service.WriteTimeout,
+		Logger: service.Logger,
+	})
+}
+
+// rateLimit returns the middleware limiting the requests of every client with the policy.
+func rateLimit(service *controllers.Service, policy ratelimit.Policy) fiber.Handler {
+	return rateLimitBatch(service, policy, "")
+}
+
+// rateLimitBatch returns the middleware limiting the items of the batches of
+// every client with the policy, taking a token by item of the field of the
+// JSON body. An empty field takes a token by request.
+func rateLimitBatch(service *controllers.Service, policy ratelimit.Policy, field string) fiber.Handler {
+	if service.Limiter.Store == nil {
+		policy = ratelimit.Policy{}
+	}
+
+	config := middleware.RateLimitConfig{
+		Store:  service.Limiter.Store,
+		Policy: policy,
+		Logger: service.Logger,
+	}
+	if field != "" {
+		config.Cost = func(c *fiber.Ctx) int {
+			return batchItems(c.Body(), field)
+		}
+	}
+
+	return middleware.RateLimit(config)
+}
+
+// batchItems returns the number of items of the field of the JSON body, one
+// when it isn't an array as the handler rejects the body.
+func batchItems(body []byte, field string) int {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return 1
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(fields[field], &items); err != nil || len(items) == 0 {
+		return 1
+	}
+
+	return len(items)
 }
@@ -0,0 +1,1236 @@
+package routes_test
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	"github.com/feserr/pheme-user/apitest"
+	"github.com/feserr/pheme-user/controllers"
+	"github.com/feserr/pheme-user/events"
+	"github.com/feserr/pheme-user/jobs"
+	"github.com/feserr/pheme-user/logging"
+	"github.com/feserr/pheme-user/middleware"
+	"github.com/feserr/pheme-user/models"
+	"github.com/feserr/pheme-user/notify"
+	"github.com/feserr/pheme-user/problem"
+	"github.com/feserr/pheme-user/ratelimit"
+	"github.com/feserr/pheme-user/repository"
+	"github.com/feserr/pheme-user/routes"
+	"github.com/gofiber/fiber/v2"
+)
+
+type testServer struct {
+	apitest.Server
+	store *repository.Memory
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	return newLimitedTestServer(t, ratelimit.Limiter{})
+}
+
+// newLimitedTestServer returns a test server with the rate limits of the limiter.
+func newLimitedTestServer(t *testing.T, limiter ratelimit.Limiter) *testServer {
+	t.Helper()
+
+	store := repository.NewMemory()
+	service := &controllers.Service{
+		Phemes:          store,
+		Users:           store,
+		Tokens:          store,
+		Transactions:    store,
+		Logger:          logging.Discard(),
+		Limiter:         limiter,
+		IdempotencyKeys: store,
+		IdempotencyTTL:  time.Hour,
+		BatchSize:       3,
+		Deletions:       store,
+		DeletionGrace:   time.Hour,
+		Reactions:       store,
+		Exports:         store,
+		Events:          events.NewBus(time.Minute, 8),
+		Heartbeat:       50 * time.Millisecond,
+		WriteTimeout:    time.Second,
+		Notifications:   notify.NewHub(notify.NewMemory(), time.Second, 8, logging.Discard()),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go service.Notifications.Run(ctx)
+	t.Cleanup(cancel)
+
+	app := fiber.New(fiber.Config{
+		CaseSensitive: true,
+		StrictRouting: true,
+		ErrorHandler:  problem.Handler,
+		// The streams are served on a listener.
+		DisableStartupMessage: true,
+	})
+	routes.Setup(app, service, apitest.Verifier(t))
+
+	return &testServer{Server: apitest.Server{T: t, App: app}, store: store}
+}
+
+func (s *testServer) addUser(name string) apitest.User {
+	s.T.Helper()
+
+	return apitest.NewUser(s.T, s.store.AddUser(models.User{
+		Version: models.UserVersion(),
+		Name:    name,
+		Email:   name + "@user.com",
+	}))
+}
+
+func TestUnauthenticated(t *testing.T) {
+	s := newTestServer(t)
+
+	for _, target := range []string{"/api/v1/pheme", "/api/v1/user", "/api/v1/admin/user/1/role"} {
+		apitest.ExpectStatus(t, s.Request(apitest.User{}, http.MethodGet, target, nil), http.StatusUnauthorized)
+	}
+
+	apitest.ExpectStatus(t, s.Bearer("not-a-jwt", http.MethodGet, "/api/v1/pheme", nil), http.StatusUnauthorized)
+
+	// The public routes are outside of the authenticated groups.
+	routes.HealthSetup(s.App, &controllers.Health{})
+	apitest.ExpectStatus(t, s.Request(apitest.User{}, http.MethodGet, "/healthz", nil), http.StatusOK)
+}
+
+func TestCurrentUser(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.addUser("alice")
+
+	res := s.Request(alice, http.MethodGet, "/api/v1/user", nil)
+	apitest.ExpectStatus(t, res, http.StatusOK)
+
+	var user models.User
+	apitest.Decode(t, res, &user)
+	if user.ID != alice.ID || user.Name != "alice" {
+		t.Errorf("got user %+v, want %+v", user, alice.User)
+	}
+}
+
+func TestPhemeLifecycle(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.addUser("alice")
+
+	res := s.Request(alice, http.MethodPost, "/api/v1/pheme", models.PhemeParamsPost{
+		Visibilty: byte(models.PUBLIC),
+		Category:  "test",
+		Text:      "first",
+		UserID:    alice.ID,
+	})
+	apitest.ExpectStatus(t, res, http.StatusOK)
+
+	var created models.PhemeParamsID
+	apitest.Decode(t, res, &created)
+	target := fmt.Sprintf("/api/v1/pheme/%d", created.ID)
+
+	res = s.Request(alice, http.MethodGet, target, nil)
+	apitest.ExpectStatus(t, res, http.StatusOK)
+
+	var pheme models.Pheme
+	apitest.Decode(t, res, &pheme)
+	if pheme.Text != "first" || pheme.UserID != alice.ID {
+		t.Errorf("got pheme %+v", pheme)
+	}
+
+	res = s.Request(alice, http.MethodPut, target, models.PhemeParamsPost{
+		Visibilty: byte(models.PRIVATE),
+		Category:  "test",
+		Text:      "updated",
+		UserID:    alice.ID,
+	})
+	apitest.ExpectStatus(t, res, http.StatusOK)
+	apitest.Decode(t, res, &pheme)
+	if pheme.Text != "updated" {
+		t.Errorf("got text %q, want updated", pheme.Text)
+	}
+
+	res = s.Request(alice, http.MethodGet, "/api/v1/pheme/mine", nil)
+	apitest.ExpectStatus(t, res, http.StatusOK)
+
+	var phemes []models.Pheme
+	apitest.Decode(t, res, &phemes)
+	if len(phemes) != 1 {
+		t.Errorf("got %d phemes, want 1", len(phemes))
+	}
+
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodDelete, target, nil), http.StatusOK)
+	apitest.ExpectProblem(t, s.Request(alice, http.MethodGet, target, nil), http.StatusNotFound, "pheme_not_found")
+}
+
+func TestPhemeTrash(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.addUser("alice")
+	bob := s.addUser("bob")
+
+	res := s.Request(alice, http.MethodPost, "/api/v1/pheme", models.PhemeParamsPost{
+		Category: "test",
+		Text:     "oops",
+		UserID:   alice.ID,
+	})
+	apitest.ExpectStatus(t, res, http.StatusOK)
+
+	var created models.PhemeParamsID
+	apitest.Decode(t, res, &created)
+	target := fmt.Sprintf("/api/v1/pheme/%d", created.ID)
+
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodDelete, target, nil), http.StatusOK)
+	apitest.ExpectProblem(t, s.Request(alice, http.MethodDelete, target, nil), http.StatusNotFound, "pheme_not_found")
+	apitest.ExpectProblem(t, s.Request(alice, http.MethodPut, target, models.PhemeParamsPost{
+		Category: "test",
+		Text:     "updated",
+		UserID:   alice.ID,
+	}), http.StatusNotFound, "pheme_not_found")
+
+	res = s.Request(alice, http.MethodGet, "/api/v1/pheme/trash", nil)
+	apitest.ExpectStatus(t, res, http.StatusOK)
+
+	var trash []models.Pheme
+	apitest.Decode(t, res, &trash)
+	if len(trash) != 1 || trash[0].ID != created.ID || !trash[0].DeletedAt.Valid {
+		t.Errorf("got the trash %+v, want the deleted pheme", trash)
+	}
+
+	apitest.ExpectProblem(t, s.Request(bob, http.MethodPost, target+"/restore", nil), http.StatusNotFound, "pheme_not_found")
+
+	res = s.Request(alice, http.MethodPost, target+"/restore", nil)
+	apitest.ExpectStatus(t, res, http.StatusOK)
+
+	var restored models.Pheme
+	apitest.Decode(t, res, &restored)
+	if restored.Text != "oops" || restored.DeletedAt.Valid {
+		t.Errorf("got %+v, want the pheme restored", restored)
+	}
+
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodGet, target, nil), http.StatusOK)
+	apitest.ExpectProblem(t, s.Request(alice, http.MethodPost, target+"/restore", nil), http.StatusNotFound, "pheme_not_found")
+
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodDelete, target, nil), http.StatusOK)
+	purged, err := s.store.PurgeTrash(context.Background(), time.Now().Add(time.Minute))
+	if err != nil || purged != 1 {
+		t.Errorf("purged %d, %v, want the trashed pheme", purged, err)
+	}
+	apitest.ExpectProblem(t, s.Request(alice, http.MethodPost, target+"/restore", nil), http.StatusNotFound, "pheme_not_found")
+}
+
+func TestAccountDeletion(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.addUser("alice")
+	bob := s.addUser("bob")
+
+	apitest.ExpectProblem(t, s.Request(alice, http.MethodGet, "/api/v1/user/deletion", nil), http.StatusNotFound, "deletion_not_found")
+
+	res := s.Request(alice, http.MethodDelete, "/api/v1/user", nil)
+	apitest.ExpectStatus(t, res, http.StatusAccepted)
+
+	var scheduled models.AccountDeletion
+	apitest.Decode(t, res, &scheduled)
+	if scheduled.UserID != alice.ID || scheduled.ScheduledAt.Sub(scheduled.RequestedAt) != time.Hour {
+		t.Errorf("got %+v, want the deletion of alice after the grace period", scheduled)
+	}
+
+	// Deleting it again keeps the first schedule.
+	res = s.Request(alice, http.MethodDelete, "/api/v1/user", nil)
+	apitest.ExpectStatus(t, res, http.StatusAccepted)
+
+	var again models.AccountDeletion
+	apitest.Decode(t, res, &again)
+	if !again.ScheduledAt.Equal(scheduled.ScheduledAt) {
+		t.Errorf("got %+v, want the deletion already scheduled", again)
+	}
+
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodGet, "/api/v1/user/deletion", nil), http.StatusOK)
+	apitest.ExpectProblem(t, s.Request(bob, http.MethodDelete, "/api/v1/user/deletion", nil), http.StatusNotFound, "deletion_not_found")
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodDelete, "/api/v1/user/deletion", nil), http.StatusNoContent)
+	apitest.ExpectProblem(t, s.Request(alice, http.MethodGet, "/api/v1/user/deletion", nil), http.StatusNotFound, "deletion_not_found")
+
+	// The job only deletes the accounts after the grace period.
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodDelete, "/api/v1/user", nil), http.StatusAccepted)
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodPut, fmt.Sprintf("/api/v1/user/friend/%d", bob.ID), nil), http.StatusOK)
+
+	deleteAccounts := jobs.DeleteAccounts(s.store, s.store, logging.Discard())
+	if err := deleteAccounts(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.store.FindByID(context.Background(), alice.ID); err != nil {
+		t.Errorf("got %v, want alice kept during the grace period", err)
+	}
+
+	_, err := s.store.ScheduleAccountDeletion(context.Background(), models.AccountDeletion{UserID: bob.ID, ScheduledAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := deleteAccounts(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.store.FindByID(context.Background(), bob.ID); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("got %v, want bob deleted", err)
+	}
+	if friends, _ := s.store.GetFriends(context.Background(), alice.ID); len(friends) != 0 {
+		t.Errorf("got the friends %v, want bob removed", friends)
+	}
+}
+
+func TestExport(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.addUser("alice")
+	bob := s.addUser("bob")
+
+	apitest.ExpectStatus(t, s.Request(bob, http.MethodPut, fmt.Sprintf("/api/v1/user/friend/%d", alice.ID), nil), http.StatusOK)
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodPost, "/api/v1/pheme", models.PhemeParamsPost{Category: "test", Text: "mine", UserID: alice.ID}), http.StatusOK)
+	apitest.ExpectStatus(t, s.Request(bob, http.MethodPost, "/api/v1/pheme", models.PhemeParamsPost{Category: "test", Text: "<b>for alice</b>", UserID: alice.ID}), http.StatusOK)
+	apitest.ExpectStatus(t, s.Request(bob, http.MethodPost, "/api/v1/pheme", models.PhemeParamsPost{Category: "test", Text: "not for alice", UserID: bob.ID}), http.StatusOK)
+
+	res := s.Request(alice, http.MethodPost, "/api/v1/user/export", nil)
+	apitest.ExpectStatus(t, res, http.StatusAccepted)
+
+	var export models.Export
+	apitest.Decode(t, res, &export)
+	target := fmt.Sprintf("/api/v1/user/export/%d", export.ID)
+	if export.Status != models.ExportPending || res.Header.Get(fiber.HeaderLocation) != target {
+		t.Errorf("got %+v at %q, want a pending export", export, res.Header.Get(fiber.HeaderLocation))
+	}
+
+	// Exporting again returns the pending export.
+	res = s.Request(alice, http.MethodPost, "/api/v1/user/export", nil)
+	apitest.ExpectStatus(t, res, http.StatusAccepted)
+
+	var again models.Export
+	apitest.Decode(t, res, &again)
+	if again.ID != export.ID {
+		t.Errorf("got the export %d, want the pending %d", again.ID, export.ID)
+	}
+
+	res = s.Request(alice, http.MethodGet, target, nil)
+	apitest.ExpectStatus(t, res, http.StatusAccepted)
+	if res.Header.Get(fiber.HeaderRetryAfter) == "" {
+		t.Error("got no Retry-After for a pending export")
+	}
+	apitest.ExpectProblem(t, s.Request(bob, http.MethodGet, target, nil), http.StatusNotFound, "export_not_found")
+
+	if err := jobs.BuildExports(s.store, s.store, s.store, s.store, logging.Discard())(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	res = s.Request(alice, http.MethodGet, target, nil)
+	apitest.ExpectStatus(t, res, http.StatusOK)
+	if contentType := res.Header.Get(fiber.HeaderContentType); contentType != "application/zip" {
+		t.Errorf("got the content type %q, want a ZIP", contentType)
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][]byte{}
+	for _, file := range archive.File {
+		f, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		content, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		files[file.Name] = content
+	}
+
+	var phemes []models.Pheme
+	if err := json.Unmarshal(files["phemes.json"], &phemes); err != nil || len(phemes) != 2 {
+		t.Errorf("got the phemes %+v, %v, want the ones authored and received by alice", phemes, err)
+	}
+
+	var relationships map[string][]uint
+	if err := json.Unmarshal(files["relationships.json"], &relationships); err != nil || len(relationships["friends"]) != 0 {
+		t.Errorf("got the relationships %+v, %v, want no friends", relationships, err)
+	}
+
+	var profile models.User
+	if err := json.Unmarshal(files["profile.json"], &profile); err != nil || profile.ID != alice.ID {
+		t.Errorf("got the profile %+v, %v, want alice", profile, err)
+	}
+
+	if _, ok := files["tokens.json"]; !ok {
+		t.Error("got no tokens in the export")
+	}
+
+	index := string(files["index.html"])
+	if !strings.Contains(index, "&lt;b&gt;for alice&lt;/b&gt;") || !strings.Contains(index, `href="phemes.json"`) {
+		t.Errorf("got the index %s, want the escaped phemes and links to the data", index)
+	}
+}
+
+func TestImport(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.addUser("alice")
+
+	importArchive := func(target string, archive string) *http.Response {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(archive))
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+alice.JWT)
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMETextPlain)
+		return s.Do(req)
+	}
+
+	archive := `{"id": "a", "createdAt": "2020-01-02T03:04:05Z", "category": "news", "text": "old news"}
+{"id": "b", "createdAt": "2020-01-03T03:04:05Z"}`
+
+	res := importArchive("/api/v1/pheme/import?format=jsonl&categories=news=News&visibility=private", archive)
+	apitest.ExpectStatus(t, res, http.StatusOK)
+
+	var report models.ImportReport
+	apitest.Decode(t, res, &report)
+	if report.Imported != 1 || report.Failed != 1 || len(report.Errors) != 1 || report.Errors[0].Line != 2 || report.Errors[0].Code != "invalid_fields" {
+		t.Errorf("got %+v, want the first line imported and the second failed", report)
+	}
+
+	res = s.Request(alice, http.MethodGet, "/api/v1/pheme/mine", nil)
+	apitest.ExpectStatus(t, res, http.StatusOK)
+
+	var phemes []models.Pheme
+	apitest.Decode(t, res, &phemes)
+	if len(phemes) != 1 || phemes[0].Category != "News" || phemes[0].Visibility != byte(models.PRIVATE) || phemes[0].CreatedAt.Year() != 2020 {
+		t.Errorf("got %+v, want the imported pheme", phemes)
+	}
+
+	res = importArchive("/api/v1/pheme/import?format=jsonl", archive)
+	apitest.ExpectStatus(t, res, http.StatusOK)
+	apitest.Decode(t, res, &report)
+	if report.Imported != 0 || report.Duplicates != 1 {
+		t.Errorf("got %+v, want the pheme skipped", report)
+	}
+
+	problem := apitest.ExpectProblem(t, importArchive("/api/v1/pheme/import?format=csv&visibility=friends", archive), http.StatusBadRequest, "invalid_fields")
+	if len(problem.Errors) != 2 || problem.Errors[0].Field != "format" || problem.Errors[1].Field != "visibility" {
+		t.Errorf("got the field errors %+v, want the format and visibility", problem.Errors)
+	}
+	apitest.ExpectProblem(t, importArchive("/api/v1/pheme/import?format=twitter", "{}"), http.StatusBadRequest, "invalid_archive")
+}
+
+// streamEvent is an event of a server-sent events stream.
+type streamEvent struct {
+	ID    string
+	Event string
+	Data  string
+}
+
+// openStream connects the user to the stream of the phemes of the app served
+// on a listener, resuming after the last event ID if any.
+func (s *testServer) openStream(address string, user apitest.User, lastEventID string) (*http.Response, *bufio.Reader) {
+	s.T.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, "http://"+address+"/api/v1/pheme/stream", nil)
+	if err != nil {
+		s.T.Fatal(err)
+	}
+	req.Header.Set(fiber.HeaderCookie, "jwt="+user.JWT)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		s.T.Fatal(err)
+	}
+	s.T.Cleanup(func() { res.Body.Close() })
+	apitest.ExpectStatus(s.T, res, http.StatusOK)
+
+	return res, bufio.NewReader(res.Body)
+}
+
+// readEvent returns the next event of the stream, skipping the comments and
+// the blocks without an event.
+func readEvent(t *testing.T, reader *bufio.Reader) streamEvent {
+	t.Helper()
+
+	var event streamEvent
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading the stream: %v", err)
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		field, value, _ := strings.Cut(line, ": ")
+		switch field {
+		case "id":
+			event.ID = value
+		case "event":
+			event.Event = value
+		case "data":
+			event.Data = value
+		case "":
+			if line == "" && event.Event != "" {
+				return event
+			}
+		}
+	}
+}
+
+func TestPhemeStream(t *testing.T) {
+	s := newTestServer(t)
+	alice, bob, carol, dave := s.addUser("alice"), s.addUser("bob"), s.addUser("carol"), s.addUser("dave")
+	ctx := context.Background()
+	if err := s.store.AddFriend(ctx, alice.ID, bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.store.AddFollower(ctx, alice.ID, carol.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	req := apitest.NewRequest(t, http.MethodGet, "/api/v1/pheme/stream", nil)
+	req.Header.Set(fiber.HeaderCookie, "jwt="+alice.JWT)
+	req.Header.Set("Last-Event-ID", "last")
+	apitest.ExpectProblem(t, s.Do(req), http.StatusBadRequest, "invalid_parameters")
+
+	// The streams never end, so they are read from a listener.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.App.Listener(listener)
+	defer s.App.Shutdown()
+	address := listener.Addr().String()
+
+	_, stream := s.openStream(address, alice, "")
+
+	post := func(user apitest.User, visibility byte, text string) uint {
+		t.Helper()
+
+		res := s.Request(user, http.MethodPost, "/api/v1/pheme", models.PhemeParamsPost{
+			Visibilty: visibility,
+			Category:  "test",
+			Text:      text,
+			UserID:    user.ID,
+		})
+		apitest.ExpectStatus(t, res, http.StatusOK)
+
+		var created models.PhemeParamsID
+		apitest.Decode(t, res, &created)
+		return created.ID
+	}
+
+	// Only the phemes listed for alice are streamed.
+	post(carol, byte(models.PROTECTED), "carol protected")
+	post(dave, byte(models.PUBLIC), "dave public")
+	post(bob, byte(models.PROTECTED), "bob protected")
+	post(carol, byte(models.PUBLIC), "carol public")
+	mine := post(alice, byte(models.PRIVATE), "alice private")
+
+	for _, text := range []string{"bob protected", "carol public", "alice private"} {
+		event := readEvent(t, stream)
+
+		var pheme models.Pheme
+		if err := json.Unmarshal([]byte(event.Data), &pheme); err != nil {
+			t.Fatal(err)
+		}
+		if event.Event != "pheme.created" || pheme.Text != text || event.ID == "" {
+			t.Errorf("got %+v, want the creation of %q", event, text)
+		}
+	}
+
+	target := fmt.Sprintf("/api/v1/pheme/%d", mine)
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodPut, target, models.PhemeParamsPost{
+		Visibilty: byte(models.PRIVATE),
+		Category:  "test",
+		Text:      "alice updated",
+		UserID:    alice.ID,
+	}), http.StatusOK)
+	updated := readEvent(t, stream)
+	if updated.Event != "pheme.updated" || !strings.Contains(updated.Data, "alice updated") {
+		t.Errorf("got %+v, want the update", updated)
+	}
+
+	// A client reconnecting with its last event receives the missed ones.
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodDelete, target, nil), http.StatusOK)
+	_, resumed := s.openStream(address, alice, updated.ID)
+	if deleted := readEvent(t, resumed); deleted.Event != "pheme.deleted" || !strings.Contains(deleted.Data, `"alice updated"`) {
+		t.Errorf("got %+v, want the deletion missed", deleted)
+	}
+	if deleted := readEvent(t, stream); deleted.Event != "pheme.deleted" {
+		t.Errorf("got %+v, want the deletion", deleted)
+	}
+
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodPost, target+"/restore", nil), http.StatusOK)
+	restored := readEvent(t, stream)
+
+	var pheme models.Pheme
+	if err := json.Unmarshal([]byte(restored.Data), &pheme); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Event != "pheme.created" || pheme.ID != mine || pheme.Text != "alice updated" || pheme.DeletedAt.Valid {
+		t.Errorf("got %+v, want the restored pheme created again", restored)
+	}
+
+	// The events that are no longer kept can't be resumed.
+	_, reset := s.openStream(address, alice, "1")
+	if event := readEvent(t, reset); event.Event != "reset" {
+		t.Errorf("got %+v, want a reset", event)
+	}
+}
+
+// openNotifications connects the user to the notifications of the app served
+// on a listener, subscribed to the types.
+func (s *testServer) openNotifications(address string, user apitest.User, types ...models.NotificationType) *websocket.Conn {
+	s.T.Helper()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+address+"/api/v1/user/notifications", http.Header{fiber.HeaderCookie: {"jwt=" + user.JWT}})
+	if err != nil {
+		s.T.Fatal(err)
+	}
+	s.T.Cleanup(func() { conn.Close() })
+
+	if err := conn.WriteJSON(models.NotificationRequest{Action: models.NotificationSubscribe, Types: types}); err != nil {
+		s.T.Fatal(err)
+	}
+	if message := readNotification(s.T, conn); message.Type != models.NotificationMessageSubscribed || len(message.Types) != len(types) {
+		s.T.Fatalf("got %+v, want subscribed to %v", message, types)
+	}
+
+	return conn
+}
+
+// readNotification returns the next message of the notifications.
+func readNotification(t *testing.T, conn *websocket.Conn) models.NotificationMessage {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var message models.NotificationMessage
+	if err := conn.ReadJSON(&message); err != nil {
+		t.Fatalf("reading the notifications: %v", err)
+	}
+
+	return message
+}
+
+func TestNotifications(t *testing.T) {
+	s := newTestServer(t)
+	alice, bob := s.addUser("alice"), s.addUser("bob")
+
+	apitest.ExpectProblem(t, s.Request(bob, http.MethodGet, "/api/v1/user/notifications", nil), http.StatusUpgradeRequired, "upgrade_required")
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.App.Listener(listener)
+	defer s.App.Shutdown()
+	address := listener.Addr().String()
+
+	// The cookies of the other sites can't open the notifications.
+	_, res, err := websocket.DefaultDialer.Dial("ws://"+address+"/api/v1/user/notifications", http.Header{
+		fiber.HeaderCookie: {"jwt=" + bob.JWT},
+		fiber.HeaderOrigin: {"https://evil.example"},
+	})
+	if err == nil || res == nil || res.StatusCode != http.StatusForbidden {
+		t.Fatalf("got %v, %v, want the origin forbidden", res, err)
+	}
+
+	all := s.openNotifications(address, bob, models.NotificationFriend, models.NotificationFollow, models.NotificationMention)
+	friends := s.openNotifications(address, bob, models.NotificationFriend)
+
+	// Every connection of the user receives the notifications of its types.
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodPut, fmt.Sprintf("/api/v1/user/friend/%d", bob.ID), nil), http.StatusOK)
+	for _, conn := range []*websocket.Conn{all, friends} {
+		message := readNotification(t, conn)
+		if message.Type != models.NotificationMessageNotification || message.Notification.Type != models.NotificationFriend || message.Notification.ActorID != alice.ID {
+			t.Errorf("got %+v, want the friend added by alice", message)
+		}
+	}
+
+	// The mentions are only notified to the users that can see the pheme.
+	if err := s.store.AddFriend(context.Background(), bob.ID, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, post := range []models.PhemeParamsPost{
+		{Visibilty: byte(models.PRIVATE), Category: "test", Text: "secret for @bob", UserID: alice.ID},
+		{Visibilty: byte(models.PROTECTED), Category: "test", Text: "hello @bob and @carol", UserID: alice.ID},
+	} {
+		apitest.ExpectStatus(t, s.Request(alice, http.MethodPost, "/api/v1/pheme", post), http.StatusOK)
+	}
+	message := readNotification(t, all)
+	if message.Notification == nil || message.Notification.Type != models.NotificationMention || message.Notification.Pheme.Text != "hello @bob and @carol" {
+		t.Errorf("got %+v, want the mention of the protected pheme", message)
+	}
+
+	// The clients choose their types.
+	if err := friends.WriteJSON(models.NotificationRequest{Action: models.NotificationUnsubscribe, Types: []models.NotificationType{models.NotificationFriend}}); err != nil {
+		t.Fatal(err)
+	}
+	if message := readNotification(t, friends); message.Type != models.NotificationMessageSubscribed || len(message.Types) != 0 {
+		t.Errorf("got %+v, want no types", message)
+	}
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodPut, fmt.Sprintf("/api/v1/user/follower/%d", bob.ID), nil), http.StatusOK)
+	if message := readNotification(t, all); message.Notification == nil || message.Notification.Type != models.NotificationFollow {
+		t.Errorf("got %+v, want the follow", message)
+	}
+
+	for request, code := range map[string]string{
+		`{"action": "subscribe", "types": ["likes"]}`: "invalid_type",
+		`{"action": "mute"}`:                          "invalid_action",
+		`not json`:                                    "invalid_message",
+	} {
+		if err := friends.WriteMessage(websocket.TextMessage, []byte(request)); err != nil {
+			t.Fatal(err)
+		}
+		if message := readNotification(t, friends); message.Type != models.NotificationMessageError || message.Code != code {
+			t.Errorf("got %+v for %s, want %s", message, request, code)
+		}
+	}
+}
+
+func TestRepliesAndReactions(t *testing.T) {
+	s := newTestServer(t)
+	alice, bob, carol := s.addUser("alice"), s.addUser("bob"), s.addUser("carol")
+	ctx := context.Background()
+	for _, users := range [][2]uint{{alice.ID, bob.ID}, {bob.ID, alice.ID}} {
+		if err := s.store.AddFriend(ctx, users[0], users[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.App.Listener(listener)
+	defer s.App.Shutdown()
+	conn := s.openNotifications(listener.Addr().String(), bob, models.NotificationReply, models.NotificationReaction)
+
+	post := func(user apitest.User, body models.PhemeParamsPost) *http.Response {
+		t.Helper()
+
+		body.Category = "test"
+		body.UserID = user.ID
+		return s.Request(user, http.MethodPost, "/api/v1/pheme", body)
+	}
+
+	res := post(bob, models.PhemeParamsPost{Visibilty: byte(models.PROTECTED), Text: "question"})
+	apitest.ExpectStatus(t, res, http.StatusOK)
+	var question models.PhemeParamsID
+	apitest.Decode(t, res, &question)
+
+	res = post(carol, models.PhemeParamsPost{Visibilty: byte(models.PRIVATE), Text: "secret"})
+	apitest.ExpectStatus(t, res, http.StatusOK)
+	var secret models.PhemeParamsID
+	apitest.Decode(t, res, &secret)
+
+	// The replies are notified to the author of the pheme replied to.
+	apitest.ExpectProblem(t, post(alice, models.PhemeParamsPost{Text: "reply", ReplyTo: &secret.ID}), http.StatusUnprocessableEntity, "reply_not_found")
+	apitest.ExpectStatus(t, post(alice, models.PhemeParamsPost{Visibilty: byte(models.PROTECTED), Text: "answer", ReplyTo: &question.ID}), http.StatusOK)
+
+	message := readNotification(t, conn)
+	if n := message.Notification; n == nil || n.Type != models.NotificationReply || n.ActorID != alice.ID || n.Pheme.Text != "answer" || n.Pheme.ReplyTo == nil || *n.Pheme.ReplyTo != question.ID {
+		t.Errorf("got %+v, want the reply of alice", message)
+	}
+
+	// The reactions are notified when they change.
+	target := fmt.Sprintf("/api/v1/pheme/%d/reaction", question.ID)
+	apitest.ExpectProblem(t, s.Request(carol, http.MethodPut, target, models.ReactionParams{Emoji: "👀"}), http.StatusNotFound, "pheme_not_found")
+	apitest.ExpectProblem(t, s.Request(alice, http.MethodPut, target, models.ReactionParams{}), http.StatusBadRequest, "invalid_fields")
+	for _, emoji := range []string{"👍", "👍", "🎉"} {
+		apitest.ExpectStatus(t, s.Request(alice, http.MethodPut, target, models.ReactionParams{Emoji: emoji}), http.StatusOK)
+	}
+	for _, emoji := range []string{"👍", "🎉"} {
+		message := readNotification(t, conn)
+		if n := message.Notification; n == nil || n.Type != models.NotificationReaction || n.ActorID != alice.ID || n.Reaction != emoji || n.Pheme.ID != question.ID {
+			t.Errorf("got %+v, want the reaction %s of alice", message, emoji)
+		}
+	}
+
+	res = s.Request(bob, http.MethodGet, fmt.Sprintf("/api/v1/pheme/%d/reactions", question.ID), nil)
+	apitest.ExpectStatus(t, res, http.StatusOK)
+	var reactions []models.Reaction
+	apitest.Decode(t, res, &reactions)
+	if len(reactions) != 1 || reactions[0].UserID != alice.ID || reactions[0].Emoji != "🎉" {
+		t.Errorf("got %+v, want the last reaction of alice", reactions)
+	}
+	apitest.ExpectProblem(t, s.Request(carol, http.MethodGet, fmt.Sprintf("/api/v1/pheme/%d/reactions", question.ID), nil), http.StatusNotFound, "pheme_not_found")
+
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodDelete, target, nil), http.StatusOK)
+	apitest.ExpectProblem(t, s.Request(alice, http.MethodDelete, target, nil), http.StatusNotFound, "reaction_not_found")
+}
+
+func TestPhemeValidation(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.addUser("alice")
+	bob := s.addUser("bob")
+
+	res := s.Request(alice, http.MethodPost, "/api/v1/pheme", models.PhemeParamsPost{UserID: alice.ID})
+	problem := apitest.ExpectProblem(t, res, http.StatusBadRequest, "invalid_fields")
+	if len(problem.Errors) != 2 || problem.Errors[0].Field != "category" || problem.Errors[0].Code != "required" || problem.Errors[1].Field != "text" {
+		t.Errorf("got the field errors %+v, want category and text required", problem.Errors)
+	}
+
+	req := apitest.NewRequest(t, http.MethodPost, "/api/v1/pheme", nil)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+alice.JWT)
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	apitest.ExpectProblem(t, s.Do(req), http.StatusBadRequest, "invalid_body")
+
+	res = s.Request(alice, http.MethodPost, "/api/v1/pheme", models.PhemeParamsPost{
+		Category: "test",
+		Text:     "not a friend",
+		UserID:   bob.ID,
+	})
+	apitest.ExpectProblem(t, res, http.StatusForbidden, "not_friends")
+}
+
+func TestPhemeModeration(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.addUser("alice")
+	bob := s.addUser("bob")
+
+	res := s.Request(alice, http.MethodPost, "/api/v1/pheme", models.PhemeParamsPost{
+		Visibilty: byte(models.PUBLIC),
+		Category:  "test",
+		Text:      "spam",
+		UserID:    alice.ID,
+	})
+	apitest.ExpectStatus(t, res, http.StatusOK)
+
+	var created models.PhemeParamsID
+	apitest.Decode(t, res, &created)
+	target := fmt.Sprintf("/api/v1/pheme/%d", created.ID)
+
+	apitest.ExpectProblem(t, s.Request(bob, http.MethodDelete, target, nil), http.StatusNotFound, "pheme_not_found")
+
+	if err := s.store.GrantRole(context.Background(), bob.ID, models.RoleModerator, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	apitest.ExpectStatus(t, s.Request(bob, http.MethodDelete, target, nil), http.StatusOK)
+
+	// The owner can't restore a pheme deleted by a moderator.
+	res = s.Request(alice, http.MethodGet, "/api/v1/pheme/trash", nil)
+	apitest.ExpectStatus(t, res, http.StatusOK)
+
+	var trash []models.Pheme
+	apitest.Decode(t, res, &trash)
+	if len(trash) != 1 || trash[0].DeletedBy == nil || *trash[0].DeletedBy != bob.ID {
+		t.Errorf("got the trash %+v, want the pheme deleted by the moderator", trash)
+	}
+
+	apitest.ExpectProblem(t, s.Request(alice, http.MethodPost, target+"/restore", nil), http.StatusForbidden, "pheme_moderated")
+	apitest.ExpectProblem(t, s.Request(alice, http.MethodGet, target, nil), http.StatusNotFound, "pheme_not_found")
+}
+
+func TestRelationships(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.addUser("alice")
+	bob := s.addUser("bob")
+
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodPut, fmt.Sprintf("/api/v1/user/friend/%d", bob.ID), nil), http.StatusOK)
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodPut, fmt.Sprintf("/api/v1/user/follower/%d", bob.ID), nil), http.StatusOK)
+
+	friends, err := s.store.GetFriends(context.Background(), alice.ID)
+	if err != nil || len(friends) != 1 || friends[0] != bob.ID {
+		t.Errorf("got friends %v, %v, want [%d]", friends, err, bob.ID)
+	}
+
+	res := s.Request(alice, http.MethodPost, "/api/v1/pheme", models.PhemeParamsPost{
+		Visibilty: byte(models.PUBLIC),
+		Category:  "test",
+		Text:      "for a friend",
+		UserID:    bob.ID,
+	})
+	apitest.ExpectStatus(t, res, http.StatusOK)
+
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodDelete, fmt.Sprintf("/api/v1/user/friend/%d", bob.ID), nil), http.StatusOK)
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodDelete, fmt.Sprintf("/api/v1/user/follower/%d", bob.ID), nil), http.StatusOK)
+
+	friends, err = s.store.GetFriends(context.Background(), alice.ID)
+	if err != nil || len(friends) != 0 {
+		t.Errorf("got friends %v, %v, want none", friends, err)
+	}
+}
+
+func TestPhemeBatch(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.addUser("alice")
+	bob := s.addUser("bob")
+
+	mine := models.PhemeParamsPost{Category: "test", Text: "mine", UserID: alice.ID}
+	forBob := models.PhemeParamsPost{Category: "test", Text: "for bob", UserID: bob.ID}
+	invalid := models.PhemeParamsPost{Category: "test", UserID: alice.ID}
+
+	res := s.Request(alice, http.MethodPost, "/api/v1/pheme/batch", models.PhemeBatchPost{
+		Phemes: []models.PhemeParamsPost{mine, forBob, invalid},
+	})
+	apitest.ExpectStatus(t, res, http.StatusOK)
+
+	var results models.BatchResult
+	apitest.Decode(t, res, &results)
+	if len(results.Results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results.Results))
+	}
+	if item := results.Results[0]; item.Status != http.StatusOK || item.ID == 0 || item.Error != nil {
+		t.Errorf("got %+v, want the pheme created", item)
+	}
+	if item := results.Results[1]; item.Status != http.StatusForbidden || item.Error == nil || item.Error.Code != "not_friends" {
+		t.Errorf("got %+v, want not_friends", item)
+	}
+	if item := results.Results[2]; item.Status != http.StatusBadRequest || item.Error == nil || item.Error.Errors[0].Field != "text" {
+		t.Errorf("got %+v, want the text required", item)
+	}
+
+	// The atomic batches create all the phemes or none.
+	res = s.Request(alice, http.MethodPost, "/api/v1/pheme/batch", models.PhemeBatchPost{
+		Phemes: []models.PhemeParamsPost{mine, forBob},
+		Atomic: true,
+	})
+	problem := apitest.ExpectProblem(t, res, http.StatusForbidden, "not_friends")
+	if !strings.HasPrefix(problem.Detail, "phemes[1]: ") {
+		t.Errorf("got detail %q, want the failed item", problem.Detail)
+	}
+
+	res = s.Request(alice, http.MethodPost, "/api/v1/pheme/batch", models.PhemeBatchPost{
+		Phemes: []models.PhemeParamsPost{mine, invalid},
+		Atomic: true,
+	})
+	problem = apitest.ExpectProblem(t, res, http.StatusBadRequest, "invalid_fields")
+	if len(problem.Errors) != 1 || problem.Errors[0].Field != "phemes[1].text" {
+		t.Errorf("got errors %+v, want phemes[1].text", problem.Errors)
+	}
+
+	phemes, err := s.store.FetchUserPhemes(context.Background(), alice.ID, byte(models.PRIVATE))
+	if err != nil || len(phemes) != 1 {
+		t.Errorf("got %d phemes, %v, want only the first one", len(phemes), err)
+	}
+
+	res = s.Request(alice, http.MethodPost, "/api/v1/pheme/batch", models.PhemeBatchPost{
+		Phemes: []models.PhemeParamsPost{mine, mine},
+		Atomic: true,
+	})
+	apitest.ExpectStatus(t, res, http.StatusOK)
+	apitest.Decode(t, res, &results)
+
+	res = s.Request(alice, http.MethodPost, "/api/v1/pheme/batch", models.PhemeBatchPost{
+		Phemes: []models.PhemeParamsPost{mine, mine, mine, mine},
+	})
+	apitest.ExpectProblem(t, res, http.StatusBadRequest, "batch_too_large")
+	apitest.ExpectProblem(t, s.Request(alice, http.MethodPost, "/api/v1/pheme/batch", models.PhemeBatchPost{}), http.StatusBadRequest, "invalid_fields")
+
+	target := fmt.Sprintf("/api/v1/pheme/batch?ids=%d,%d,99,%d", results.Results[1].ID, results.Results[0].ID, results.Results[1].ID)
+	res = s.Request(alice, http.MethodGet, target, nil)
+	apitest.ExpectStatus(t, res, http.StatusOK)
+
+	var batch models.PhemeBatch
+	apitest.Decode(t, res, &batch)
+	if len(batch.Phemes) != 2 || len(batch.NotFound) != 1 || batch.NotFound[0] != 99 {
+		t.Errorf("got %d phemes, not found %v, want 2 and [99]", len(batch.Phemes), batch.NotFound)
+	}
+
+	apitest.ExpectStatus(t, s.Request(bob, http.MethodGet, target, nil), http.StatusOK)
+	apitest.ExpectProblem(t, s.Request(alice, http.MethodGet, "/api/v1/pheme/batch", nil), http.StatusBadRequest, "invalid_fields")
+}
+
+func TestRelationshipBatch(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.addUser("alice")
+	bob := s.addUser("bob")
+	carol := s.addUser("carol")
+
+	res := s.Request(alice, http.MethodPost, "/api/v1/user/relationships/batch", models.RelationshipBatch{
+		Operations: []models.RelationshipOperation{
+			{Action: models.ActionAdd, Relation: models.RelationFriend, UserID: bob.ID},
+			{Action: models.ActionAdd, Relation: models.RelationFollower, UserID: carol.ID},
+			{Action: models.ActionAdd, Relation: models.RelationFriend, UserID: 99},
+		},
+	})
+	apitest.ExpectStatus(t, res, http.StatusOK)
+
+	var results models.BatchResult
+	apitest.Decode(t, res, &results)
+	statuses := []int{}
+	for _, item := range results.Results {
+		statuses = append(statuses, item.Status)
+	}
+	if fmt.Sprint(statuses) != fmt.Sprint([]int{http.StatusOK, http.StatusOK, http.StatusNotFound}) {
+		t.Errorf("got statuses %v, want the unknown user not found", statuses)
+	}
+
+	// The atomic batches are rolled back when an operation fails.
+	res = s.Request(alice, http.MethodPost, "/api/v1/user/relationships/batch", models.RelationshipBatch{
+		Operations: []models.RelationshipOperation{
+			{Action: models.ActionRemove, Relation: models.RelationFriend, UserID: bob.ID},
+			{Action: models.ActionAdd, Relation: models.RelationFriend, UserID: alice.ID},
+		},
+		Atomic: true,
+	})
+	apitest.ExpectProblem(t, res, http.StatusBadRequest, "same_user")
+
+	friends, err := s.store.GetFriends(context.Background(), alice.ID)
+	if err != nil || len(friends) != 1 || friends[0] != bob.ID {
+		t.Errorf("got friends %v, %v, want [%d]", friends, err, bob.ID)
+	}
+
+	res = s.Request(alice, http.MethodPost, "/api/v1/user/relationships/batch", models.RelationshipBatch{
+		Operations: []models.RelationshipOperation{{Action: "block", Relation: models.RelationFriend, UserID: bob.ID}},
+		Atomic:     true,
+	})
+	problem := apitest.ExpectProblem(t, res, http.StatusBadRequest, "invalid_fields")
+	if len(problem.Errors) != 1 || problem.Errors[0].Field != "operations[0].action" {
+		t.Errorf("got errors %+v, want operations[0].action", problem.Errors)
+	}
+}
+
+func TestUserSearch(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.addUser("alice")
+	s.addUser("bob")
+
+	res := s.Request(alice, http.MethodGet, "/api/v1/user/bo", nil)
+	apitest.ExpectStatus(t, res, http.StatusOK)
+
+	var users []models.User
+	apitest.Decode(t, res, &users)
+	if len(users) != 1 || users[0].Name != "bob" {
+		t.Errorf("got users %+v, want bob", users)
+	}
+}
+
+func TestRoles(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.addUser("alice")
+	bob := s.addUser("bob")
+
+	target := fmt.Sprintf("/api/v1/admin/user/%d/role/moderator", bob.ID)
+	apitest.ExpectProblem(t, s.Request(alice, http.MethodPut, target, nil), http.StatusForbidden, "missing_permission")
+
+	if err := s.store.GrantRole(context.Background(), alice.ID, models.RoleAdmin, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodPut, target, nil), http.StatusOK)
+
+	res := s.Request(alice, http.MethodGet, fmt.Sprintf("/api/v1/admin/user/%d/role", bob.ID), nil)
+	apitest.ExpectStatus(t, res, http.StatusOK)
+
+	var roles []models.UserRole
+	apitest.Decode(t, res, &roles)
+	if len(roles) != 1 || roles[0].Role != models.RoleModerator {
+		t.Errorf("got roles %+v, want moderator", roles)
+	}
+
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodDelete, target, nil), http.StatusOK)
+	apitest.ExpectProblem(t, s.Request(alice, http.MethodDelete, target, nil), http.StatusNotFound, "role_not_granted")
+	apitest.ExpectProblem(t, s.Request(alice, http.MethodDelete, fmt.Sprintf("/api/v1/admin/user/%d/role/admin", alice.ID), nil), http.StatusBadRequest, "own_admin_role")
+}
+
+func TestCSRF(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.addUser("alice")
+
+	req := apitest.NewRequest(t, http.MethodPut, "/api/v1/user/friend/1", nil)
+	req.Header.Set(fiber.HeaderCookie, "jwt="+alice.JWT)
+	apitest.ExpectProblem(t, s.Do(req), http.StatusForbidden, "invalid_csrf_token")
+
+	apitest.ExpectStatus(t, s.Bearer(alice.JWT, http.MethodPost, "/api/v1/pheme", models.PhemeParamsPost{
+		Category: "test",
+		Text:     "bearer",
+		UserID:   alice.ID,
+	}), http.StatusOK)
+}
+
+func TestPersonalAccessTokens(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.addUser("alice")
+
+	res := s.Request(alice, http.MethodPost, "/api/v1/user/tokens", models.TokenParamsNew{
+		Name:   "read only",
+		Scopes: []string{string(models.PermissionPhemesRead)},
+	})
+	apitest.ExpectStatus(t, res, http.StatusOK)
+
+	var created models.TokenCreated
+	apitest.Decode(t, res, &created)
+
+	apitest.ExpectStatus(t, s.Bearer(created.Token, http.MethodGet, "/api/v1/pheme", nil), http.StatusOK)
+	apitest.ExpectStatus(t, s.Bearer(created.Token, http.MethodPost, "/api/v1/pheme", models.PhemeParamsPost{
+		Category: "test",
+		Text:     "out of scope",
+		UserID:   alice.ID,
+	}), http.StatusForbidden)
+	apitest.ExpectProblem(t, s.Bearer(created.Token, http.MethodGet, "/api/v1/user/tokens", nil), http.StatusForbidden, "session_required")
+
+	tokens, err := s.store.FetchTokens(context.Background(), alice.ID)
+	if err != nil || len(tokens) != 1 || tokens[0].LastUsedAt == nil {
+		t.Errorf("got tokens %+v, %v, want one used token", tokens, err)
+	}
+
+	apitest.ExpectStatus(t, s.Request(alice, http.MethodDelete, fmt.Sprintf("/api/v1/user/tokens/%d", created.ID), nil), http.StatusOK)
+	apitest.ExpectProblem(t, s.Bearer(created.Token, http.MethodGet, "/api/v1/pheme", nil), http.StatusUnauthorized, "unauthenticated")
+}
+
+func TestRateLimit(t *testing.T) {
+	s := newLimitedTestServer(t, ratelimit.Limiter{
+		Store: ratelimit.NewMemory(),
+		Policies: ratelimit.Policies{
+			Default: ratelimit.Policy{Name: "default", Limit: 100, Period: time.Minute},
+			Phemes:  ratelimit.Policy{Name: "phemes", Limit: 2, Period: time.Minute},
+		},
+	})
+	alice := s.addUser("alice")
+	bob := s.addUser("bob")
+
+	post := func(user apitest.User) *http.Response {
+		return s.Request(user, http.MethodPost, "/api/v1/pheme", models.PhemeParamsPost{
+			Category: "test",
+			Text:     "limited",
+			UserID:   user.ID,
+		})
+	}
+
+	for remaining := 1; remaining >= 0; remaining-- {
+		res := post(alice)
+		apitest.ExpectStatus(t, res, http.StatusOK)
+		if got := res.Header.Get(middleware.HeaderRateLimitRemaining); got != fmt.Sprint(remaining) {
+			t.Errorf("got %s remaining requests, want %d", got, remaining)
+		}
+		if got := res.Header.Get(middleware.HeaderRateLimitPolicy); got != "2;w=60" {
+			t.Errorf("got the policy %q, want the one of the phemes", got)
+		}
+	}
+
+	res := post(alice)
+	apitest.ExpectProblem(t, res, http.StatusTooManyRequests, "rate_limited")
+	if res.Header.Get(fiber.HeaderRetryAfter) != "30" || res.Header.Get(middleware.HeaderRateLimitReset) != "60" {
+		t.Errorf("got Retry-After %q and RateLimit-Reset %q, want 30 and 60",
+			res.Header.Get(fiber.HeaderRetryAfter), res.Header.Get(middleware.HeaderRateLimitReset))
+	}
+
+	apitest.ExpectStatus(t, post(bob), http.StatusOK)
+
+	res = s.Request(alice, http.MethodGet, "/api/v1/pheme", nil)
+	apitest.ExpectStatus(t, res, http.StatusOK)
+	if got := res.Header.Get(middleware.HeaderRateLimitRemaining); got != "96" {
+		t.Errorf("got %s remaining requests, want 96 of the default policy", got)
+	}
+
+	// The batches take a token by pheme.
+	batch := func(user apitest.User, count int) *http.Response {
+		body := models.PhemeBatchPost{}
+		for i := 0; i < count; i++ {
+			body.Phemes = append(body.Phemes, models.PhemeParamsPost{Category: "test", Text: "batched", UserID: user.ID})
+		}
+		return s.Request(user, http.MethodPost, "/api/v1/pheme/batch", body)
+	}
+	apitest.ExpectProblem(t, batch(bob, 2), http.StatusTooManyRequests, "rate_limited")
+	carol := s.addUser("carol")
+	res = batch(carol, 2)
+	apitest.ExpectStatus(t, res, http.StatusOK)
+	if got := res.Header.Get(middleware.HeaderRateLimitRemaining); got != "0" {
+		t.Errorf("got %s remaining phemes, want 0 after a batch of 2", got)
+	}
+}
+
+func TestRateLimitIP(t *testing.T) {
+	s := newLimitedTestServer(t, ratelimit.Limiter{
+		Store: ratelimit.NewMemory(),
+		Policies: ratelimit.Policies{
+			IP: ratelimit.Policy{Name: "ip", Limit: 2, Period: time.Minute},
+		},
+	})
+
+	// The requests failing the authentication are limited too.
+	for i := 0; i < 2; i++ {
+		apitest.ExpectStatus(t, s.Bearer("not-a-jwt", http.MethodGet, "/api/v1/pheme", nil), http.StatusUnauthorized)
+	}
+	apitest.ExpectProblem(t, s.Bearer("not-a-jwt", http.MethodGet, "/api/v1/pheme", nil), http.StatusTooManyRequests, "rate_limited")
+	apitest.ExpectProblem(t, s.Request(s.addUser("alice"), http.MethodGet, "/api/v1/pheme", nil), http.StatusTooManyRequests, "rate_limited")
+}
+
+func TestIdempotency(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.addUser("alice")
+	bob := s.addUser("bob")
+
+	params := func(text string, userID uint) models.PhemeParamsPost {
+		return models.PhemeParamsPost{Category: "test", Text: text, UserID: userID}
+	}
+	post := func(key string, text string, userID uint) *http.Response {
+		req := apitest.NewRequest(t, http.MethodPost, "/api/v1/pheme", params(text, userID))
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+alice.JWT)
+		req.Header.Set(middleware.HeaderIdempotencyKey, key)
+		return s.Do(req)
+	}
+
+	var first, retried models.PhemeParamsID
+	res := post("key-1", "once", alice.ID)
+	apitest.ExpectStatus(t, res, http.StatusOK)
+	apitest.Decode(t, res, &first)
+
+	res = post("key-1", "once", alice.ID)
+	apitest.ExpectStatus(t, res, http.StatusOK)
+	apitest.Decode(t, res, &retried)
+	if retried != first || res.Header.Get(middleware.HeaderIdempotentReplayed) != "true" {
+		t.Errorf("got %+v, replayed %q, want the response of the first request replayed", retried, res.Header.Get(middleware.HeaderIdempotentReplayed))
+	}
+
+	phemes, err := s.store.FetchUserPhemes(context.Background(), alice.ID, byte(models.PRIVATE))
+	if err != nil || len(phemes) != 1 {
+		t.Errorf("got %d phemes, %v, want 1", len(phemes), err)
+	}
+
+	apitest.ExpectProblem(t, post("key-1", "another", alice.ID), http.StatusUnprocessableEntity, "idempotency_key_reused")
+
+	// The failed requests don't keep the key.
+	apitest.ExpectProblem(t, post("key-2", "for bob", bob.ID), http.StatusForbidden, "not_friends")
+	if err := s.store.AddFriend(context.Background(), alice.ID, bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	apitest.ExpectStatus(t, post("key-2", "for bob", bob.ID), http.StatusOK)
+
+	body, err := json.Marshal(params("in flight", alice.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.store.ReserveIdempotencyKey(context.Background(), models.IdempotencyKey{
+		UserID:      alice.ID,
+		Key:         "key-3",
+		Fingerprint: models.RequestFingerprint(http.MethodPost, "/api/v1/pheme", body),
+		CreatedAt:   time.Now(),
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	apitest.ExpectProblem(t, post("key-3", "in flight", alice.ID), http.StatusConflict, "idempotency_key_in_flight")
+
+	// The key of a request lost in a restart is taken over once its lease ends.
+	lost := time.Now().Add(-2 * time.Second)
+	if _, _, err := s.store.ReserveIdempotencyKey(context.Background(), models.IdempotencyKey{
+		UserID:      alice.ID,
+		Key:         "key-4",
+		Fingerprint: models.RequestFingerprint(http.MethodPost, "/api/v1/pheme", body),
+		CreatedAt:   lost,
+		ExpiresAt:   lost.Add(time.Second),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	apitest.ExpectStatus(t, post("key-4", "in flight", alice.ID), http.StatusOK)
+	res = post("key-4", "in flight", alice.ID)
+	if res.StatusCode != http.StatusOK || res.Header.Get(middleware.HeaderIdempotentReplayed) != "true" {
+		t.Errorf("got %d, replayed %q, want the response of the retry replayed for the TTL", res.StatusCode, res.Header.Get(middleware.HeaderIdempotentReplayed))
+	}
+	apitest.ExpectProblem(t, post(strings.Repeat("k", 256), "too long", alice.ID), http.StatusBadRequest, "invalid_idempotency_key")
+}
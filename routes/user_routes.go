@@ -1,16 +1,39 @@
 package routes
 
 import (
-	authModels "github.com/feserr/pheme-auth/controllers"
+	"github.com/feserr/pheme-user/auth"
 	"github.com/feserr/pheme-user/controllers"
+	"github.com/feserr/pheme-user/middleware"
+	"github.com/feserr/pheme-user/models"
 	"github.com/gofiber/fiber/v2"
 )
 
-func UserSetup(app *fiber.App) {
-	app.Get("/api/v1/user", authModels.User)
-	app.Get("/api/v1/user/:name<string>", controllers.GetUsersByName)
-	app.Put("/api/v1/user/friend/:id<int>", controllers.AddFriend)
-	app.Put("/api/v1/user/follower/:id<int>", controllers.AddFollower)
-	app.Delete("/api/v1/user/friend/:id<int>", controllers.DeleteFriend)
-	app.Delete("/api/v1/user/follower/:id<int>", controllers.DeleteFollower)
+func UserSetup(app *fiber.App, service *controllers.Service, verifier *auth.Verifier) {
+	user := app.Group("/api/v1/user", authenticate(service, verifier)...)
+
+	read := middleware.RequirePermission(models.PermissionUsersRead)
+	relationships := middleware.RequirePermission(models.PermissionRelationshipsWrite)
+	session := middleware.RequireSession()
+	relationshipsLimit := rateLimit(service, service.Limiter.Policies.Relationships)
+	relationshipsBatchLimit := rateLimitBatch(service, service.Limiter.Policies.Relationships, "operations")
+	idempotency := idempotent(service)
+
+	user.Get("", service.GetCurrentUser)
+	user.Delete("", session, service.DeleteAccount)
+	user.Get("/deletion", session, service.GetAccountDeletion)
+	user.Delete("/deletion", session, service.CancelAccountDeletion)
+	user.Post("/export", session, service.PostExport)
+	user.Get("/export/:id<int>", session, service.GetExport)
+	if service.Notifications != nil {
+		user.Get("/notifications", read, service.GetNotifications)
+	}
+	user.Get("/tokens", session, service.GetTokens)
+	user.Post("/tokens", session, service.PostToken)
+	user.Delete("/tokens/:id<int>", session, service.DeleteToken)
+	user.Get("/:name<string>", read, service.GetUsersByName)
+	user.Put("/friend/:id<int>", relationships, relationshipsLimit, idempotency, service.AddFriend)
+	user.Put("/follower/:id<int>", relationships, relationshipsLimit, idempotency, service.AddFollower)
+	user.Delete("/friend/:id<int>", relationships, service.DeleteFriend)
+	user.Delete("/follower/:id<int>", relationships, service.DeleteFollower)
+	user.Post("/relationships/batch", relationships, relationshipsBatchLimit, idempotency, service.PostRelationshipBatch)
 }
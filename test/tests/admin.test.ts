@@ -0,0 +1,187 @@
+import {
+  describe, it, expect, beforeAll, afterAll,
+} from '@jest/globals';
+import request from 'supertest';
+
+jest.setTimeout(10000);
+
+const authUrl = 'http://127.0.0.1:8000';
+const phemeUrl = 'http://127.0.0.1:8001';
+
+class User {
+  id: number = 0;
+
+  cookie: string = '';
+
+  csrf: string = '';
+
+  constructor(id: number, cookie: string, csrf: string) {
+    this.id = id;
+    this.cookie = cookie;
+    this.csrf = csrf;
+  }
+}
+
+async function createUser(userName: string): Promise<User> {
+  await request(authUrl)
+    .post('/api/v1/auth/register')
+    .send({ name: `${userName}`, email: `${userName}@user.com`, password: 'test' });
+
+  let response = await request(authUrl)
+    .post('/api/v1/auth/login')
+    .send({ email: `${userName}@user.com`, password: 'test' });
+  const cookie = response.get('Set-Cookie')[0];
+
+  response = await request(authUrl)
+    .get('/api/v1/auth/user')
+    .set('Cookie', cookie);
+  const { body } = response;
+
+  // Unsafe requests authenticated with the cookie need the CSRF token.
+  response = await request(phemeUrl)
+    .get('/api/v1/user')
+    .set('Cookie', cookie);
+  const csrfCookie = response.get('Set-Cookie')[0].split(';')[0];
+  const csrf = csrfCookie.substring(csrfCookie.indexOf('=') + 1);
+
+  return new User(body.id, `${cookie.split(';')[0]}; ${csrfCookie}`, csrf);
+}
+
+async function deleteUser(user: User) {
+  await request(authUrl)
+    .delete('/api/v1/auth/user')
+    .set('Cookie', user.cookie);
+}
+
+// The admin email is set with ADMIN_EMAILS in the .env file.
+let admin: User = new User(0, '', '');
+let testUser: User = new User(0, '', '');
+
+beforeAll(async () => {
+  admin = await createUser('test.admin');
+  testUser = await createUser('test.role');
+});
+
+afterAll(async () => {
+  await deleteUser(testUser);
+  await deleteUser(admin);
+});
+
+describe('Role endpoints', () => {
+  it('Unauthenticated', async () => {
+    const response = await request(phemeUrl)
+      .get(`/api/v1/admin/user/${testUser.id}/role`);
+
+    expect(response.statusCode).toBe(401);
+    expect(response.headers['content-type']).toContain('application/problem+json');
+  });
+
+  it('Forbidden for users', async () => {
+    const response = await request(phemeUrl)
+      .put(`/api/v1/admin/user/${testUser.id}/role/admin`)
+      .set('Cookie', testUser.cookie)
+      .set('X-CSRF-Token', testUser.csrf);
+
+    expect(response.statusCode).toBe(403);
+    expect(response.headers['content-type']).toContain('application/problem+json');
+  });
+
+  it('Unknown role', async () => {
+    const response = await request(phemeUrl)
+      .put(`/api/v1/admin/user/${testUser.id}/role/wrong`)
+      .set('Cookie', admin.cookie)
+      .set('X-CSRF-Token', admin.csrf);
+
+    expect(response.statusCode).toBe(400);
+    expect(response.headers['content-type']).toContain('application/problem+json');
+  });
+
+  it('Revoke own admin role', async () => {
+    const response = await request(phemeUrl)
+      .delete(`/api/v1/admin/user/${admin.id}/role/admin`)
+      .set('Cookie', admin.cookie)
+      .set('X-CSRF-Token', admin.csrf);
+
+    expect(response.statusCode).toBe(400);
+    expect(response.headers['content-type']).toContain('application/problem+json');
+  });
+
+  it('Grant and revoke role', async () => {
+    let response = await request(phemeUrl)
+      .put(`/api/v1/admin/user/${testUser.id}/role/moderator`)
+      .set('Cookie', admin.cookie)
+      .set('X-CSRF-Token', admin.csrf);
+
+    expect(response.statusCode).toBe(200);
+
+    response = await request(phemeUrl)
+      .get(`/api/v1/admin/user/${testUser.id}/role`)
+      .set('Cookie', admin.cookie);
+
+    expect(response.statusCode).toBe(200);
+    expect(response.body).toHaveLength(1);
+    expect(response.body[0].role).toBe('moderator');
+
+    response = await request(phemeUrl)
+      .delete(`/api/v1/admin/user/${testUser.id}/role/moderator`)
+      .set('Cookie', admin.cookie)
+      .set('X-CSRF-Token', admin.csrf);
+
+    expect(response.statusCode).toBe(200);
+
+    response = await request(phemeUrl)
+      .get(`/api/v1/admin/user/${testUser.id}/role`)
+      .set('Cookie', admin.cookie);
+
+    expect(response.statusCode).toBe(200);
+    expect(response.body).toHaveLength(0);
+  });
+
+  it('Revoke missing role', async () => {
+    const response = await request(phemeUrl)
+      .delete(`/api/v1/admin/user/${testUser.id}/role/moderator`)
+      .set('Cookie', admin.cookie)
+      .set('X-CSRF-Token', admin.csrf);
+
+    expect(response.statusCode).toBe(404);
+  });
+});
+
+describe('Moderation', () => {
+  it('Moderator deletes another user pheme', async () => {
+    let response = await request(phemeUrl)
+      .post('/api/v1/pheme')
+      .send({
+        visibility: 0, category: 'main', text: 'Hello world!', userID: admin.id,
+      })
+      .set('Cookie', admin.cookie)
+      .set('X-CSRF-Token', admin.csrf);
+
+    expect(response.statusCode).toBe(200);
+    const phemeID = response.body.id;
+
+    response = await request(phemeUrl)
+      .delete(`/api/v1/pheme/${phemeID}`)
+      .set('Cookie', testUser.cookie)
+      .set('X-CSRF-Token', testUser.csrf);
+
+    expect(response.statusCode).toBe(404);
+
+    await request(phemeUrl)
+      .put(`/api/v1/admin/user/${testUser.id}/role/moderator`)
+      .set('Cookie', admin.cookie)
+      .set('X-CSRF-Token', admin.csrf);
+
+    response = await request(phemeUrl)
+      .delete(`/api/v1/pheme/${phemeID}`)
+      .set('Cookie', testUser.cookie)
+      .set('X-CSRF-Token', testUser.csrf);
+
+    expect(response.statusCode).toBe(200);
+
+    await request(phemeUrl)
+      .delete(`/api/v1/admin/user/${testUser.id}/role/moderator`)
+      .set('Cookie', admin.cookie)
+      .set('X-CSRF-Token', admin.csrf);
+  });
+});
@@ -0,0 +1,150 @@
+import {
+  describe, it, expect, beforeAll, afterAll,
+} from '@jest/globals';
+import request from 'supertest';
+
+jest.setTimeout(10000);
+
+const authUrl = 'http://127.0.0.1:8000';
+const phemeUrl = 'http://127.0.0.1:8001';
+let cookie = '';
+let token = '';
+let userID = 0;
+
+beforeAll(async () => {
+  await request(authUrl)
+    .post('/api/v1/auth/register')
+    .send({ name: 'test.bearer', email: 'test.bearer@test.com', password: 'test' });
+
+  let response = await request(authUrl)
+    .post('/api/v1/auth/login')
+    .send({ email: 'test.bearer@test.com', password: 'test' });
+  cookie = response.get('Set-Cookie')[0].split(';')[0];
+  token = cookie.substring(cookie.indexOf('=') + 1);
+
+  response = await request(authUrl)
+    .get('/api/v1/auth/user')
+    .set('Cookie', cookie);
+  userID = response.body.id;
+});
+
+afterAll(async () => {
+  await request(authUrl)
+    .delete('/api/v1/auth/user')
+    .set('Cookie', cookie);
+});
+
+describe('Bearer authentication', () => {
+  it('Valid bearer token', async () => {
+    const response = await request(phemeUrl)
+      .get('/api/v1/user')
+      .set('Authorization', `Bearer ${token}`);
+
+    expect(response.statusCode).toBe(200);
+    expect(response.body.id).toBe(userID);
+  });
+
+  it('Invalid bearer token', async () => {
+    const response = await request(phemeUrl)
+      .get('/api/v1/user')
+      .set('Authorization', 'Bearer wrong');
+
+    expect(response.statusCode).toBe(401);
+    expect(response.headers['content-type']).toContain('application/problem+json');
+  });
+
+  it('Wrong authorization scheme', async () => {
+    const response = await request(phemeUrl)
+      .get('/api/v1/user')
+      .set('Authorization', `Basic ${token}`);
+
+    expect(response.statusCode).toBe(401);
+  });
+
+  it('Authorization header takes precedence over the cookie', async () => {
+    const response = await request(phemeUrl)
+      .get('/api/v1/user')
+      .set('Authorization', 'Bearer wrong')
+      .set('Cookie', cookie);
+
+    expect(response.statusCode).toBe(401);
+  });
+
+  it('Unsafe request does not need a CSRF token', async () => {
+    const response = await request(phemeUrl)
+      .post('/api/v1/pheme')
+      .send({
+        visibility: 0, category: 'main', text: 'Hello world!', userID,
+      })
+      .set('Authorization', `Bearer ${token}`);
+
+    expect(response.statusCode).toBe(200);
+
+    await request(phemeUrl)
+      .delete(`/api/v1/pheme/${response.body.id}`)
+      .set('Authorization', `Bearer ${token}`);
+  });
+});
+
+describe('CSRF protection', () => {
+  it('Safe request sets the CSRF cookie', async () => {
+    const response = await request(phemeUrl)
+      .get('/api/v1/user')
+      .set('Cookie', cookie);
+
+    expect(response.statusCode).toBe(200);
+    expect(response.get('Set-Cookie')[0]).toContain('csrf_token=');
+  });
+
+  it('Bearer request does not set the CSRF cookie', async () => {
+    const response = await request(phemeUrl)
+      .get('/api/v1/user')
+      .set('Authorization', `Bearer ${token}`);
+
+    expect(response.statusCode).toBe(200);
+    expect(response.get('Set-Cookie')).toBeUndefined();
+  });
+
+  it('Unsafe request without CSRF token', async () => {
+    const response = await request(phemeUrl)
+      .post('/api/v1/pheme')
+      .send({
+        visibility: 0, category: 'main', text: 'Hello world!', userID,
+      })
+      .set('Cookie', cookie);
+
+    expect(response.statusCode).toBe(403);
+    expect(response.headers['content-type']).toContain('application/problem+json');
+  });
+
+  it('Unsafe request with wrong CSRF token', async () => {
+    const response = await request(phemeUrl)
+      .post('/api/v1/pheme')
+      .send({
+        visibility: 0, category: 'main', text: 'Hello world!', userID,
+      })
+      .set('Cookie', `${cookie}; csrf_token=token`)
+      .set('X-CSRF-Token', 'wrong');
+
+    expect(response.statusCode).toBe(403);
+  });
+
+  it('Unsafe request with CSRF token', async () => {
+    let response = await request(phemeUrl)
+      .post('/api/v1/pheme')
+      .send({
+        visibility: 0, category: 'main', text: 'Hello world!', userID,
+      })
+      .set('Cookie', `${cookie}; csrf_token=token`)
+      .set('X-CSRF-Token', 'token');
+
+    expect(response.statusCode).toBe(200);
+
+    response = await request(phemeUrl)
+      .delete(`/api/v1/pheme/${response.body.id}`)
+      .set('Cookie', `${cookie}; csrf_token=token`)
+      .set('X-CSRF-Token', 'token');
+
+    expect(response.statusCode).toBe(200);
+  });
+});
@@ -6,6 +6,7 @@ import request from 'supertest';
 const authUrl = 'http://127.0.0.1:8000';
 const phemeUrl = 'http://127.0.0.1:8001';
 let cookie = '';
+let csrf = '';
 let userID = 0;
 
 async function postPheme(): Promise<number> {
@@ -14,7 +15,8 @@ async function postPheme(): Promise<number> {
     .send({
       visibility: 0, category: 'main', text: 'Hello world!', userID,
     })
-    .set('Cookie', cookie);
+    .set('Cookie', cookie)
+    .set('X-CSRF-Token', csrf);
 
   expect(response.statusCode).toBe(200);
   expect(response.headers['content-type']).toContain('application/json');
@@ -38,6 +40,14 @@ beforeAll(async () => {
     .get('/api/v1/auth/user')
     .set('Cookie', cookie);
   userID = response.body.id;
+
+  // Unsafe requests authenticated with the cookie need the CSRF token.
+  response = await request(phemeUrl)
+    .get('/api/v1/user')
+    .set('Cookie', cookie);
+  const csrfCookie = response.get('Set-Cookie')[0].split(';')[0];
+  csrf = csrfCookie.substring(csrfCookie.indexOf('=') + 1);
+  cookie = `${cookie.split(';')[0]}; ${csrfCookie}`;
 });
 
 afterAll(async () => {
@@ -55,7 +65,8 @@ afterEach(async () => {
   await Promise.all(phemes.map(async (pheme: any) => {
     await request(phemeUrl)
       .delete(`/api/v1/pheme/${pheme.id}`)
-      .set('Cookie', cookie);
+      .set('Cookie', cookie)
+      .set('X-CSRF-Token', csrf);
   }));
 });
 
@@ -64,30 +75,33 @@ describe('PostPheme endpoint', () => {
     const response = await request(phemeUrl)
       .post('/api/v1/pheme')
       .send({ visibility: 0, text: 'Hello world!', userID })
-      .set('Cookie', cookie);
+      .set('Cookie', cookie)
+      .set('X-CSRF-Token', csrf);
 
     expect(response.statusCode).toBe(400);
-    expect(response.headers['content-type']).toContain('application/json');
+    expect(response.headers['content-type']).toContain('application/problem+json');
   });
 
   it('new pheme missing text', async () => {
     const response = await request(phemeUrl)
       .post('/api/v1/pheme')
       .send({ visibility: 0, category: 'main', userID })
-      .set('Cookie', cookie);
+      .set('Cookie', cookie)
+      .set('X-CSRF-Token', csrf);
 
     expect(response.statusCode).toBe(400);
-    expect(response.headers['content-type']).toContain('application/json');
+    expect(response.headers['content-type']).toContain('application/problem+json');
   });
 
   it('new pheme missing userID', async () => {
     const response = await request(phemeUrl)
       .post('/api/v1/pheme')
       .send({ visibility: 0, category: 'main', text: 'Hello world!' })
-      .set('Cookie', cookie);
+      .set('Cookie', cookie)
+      .set('X-CSRF-Token', csrf);
 
     expect(response.statusCode).toBe(400);
-    expect(response.headers['content-type']).toContain('application/json');
+    expect(response.headers['content-type']).toContain('application/problem+json');
   });
 
   it('new pheme', async () => {
@@ -96,7 +110,8 @@ describe('PostPheme endpoint', () => {
       .send({
         visibility: 0, category: 'main', text: 'Hello world!', userID,
       })
-      .set('Cookie', cookie);
+      .set('Cookie', cookie)
+      .set('X-CSRF-Token', csrf);
     expect(response.statusCode).toBe(200);
     expect(response.headers['content-type']).toContain('application/json');
     expect(response.body).toHaveProperty('id');
@@ -112,7 +127,8 @@ describe('UpdatePheme endpoint', () => {
       .send({
         visibility: 0, category: 'main', text: 'Hello world!', userID,
       })
-      .set('Cookie', cookie);
+      .set('Cookie', cookie)
+      .set('X-CSRF-Token', csrf);
     expect(response.statusCode).toBe(200);
     expect(response.headers['content-type']).toContain('application/json');
 
@@ -125,7 +141,8 @@ describe('UpdatePheme endpoint', () => {
       .send({
         visibility: 0, category: 'main', text: 'Hello world!', userID,
       })
-      .set('Cookie', cookie);
+      .set('Cookie', cookie)
+      .set('X-CSRF-Token', csrf);
 
     expect(response.statusCode).toBe(405);
   });
@@ -136,7 +153,8 @@ describe('UpdatePheme endpoint', () => {
       .send({
         visibility: 0, text: 'Hello world!', userID,
       })
-      .set('Cookie', cookie);
+      .set('Cookie', cookie)
+      .set('X-CSRF-Token', csrf);
 
     expect(response.statusCode).toBe(400);
   });
@@ -147,7 +165,8 @@ describe('UpdatePheme endpoint', () => {
       .send({
         visibility: 0, category: 'main', userID,
       })
-      .set('Cookie', cookie);
+      .set('Cookie', cookie)
+      .set('X-CSRF-Token', csrf);
 
     expect(response.statusCode).toBe(400);
   });
@@ -158,7 +177,8 @@ describe('UpdatePheme endpoint', () => {
       .send({
         visibility: 0, category: 'main', text: 'Hello world!',
       })
-      .set('Cookie', cookie);
+      .set('Cookie', cookie)
+      .set('X-CSRF-Token', csrf);
 
     expect(response.statusCode).toBe(400);
   });
@@ -169,7 +189,8 @@ describe('UpdatePheme endpoint', () => {
       .send({
         visibility: 0, category: 'main', text: 'Hello world!', userID,
       })
-      .set('Cookie', cookie);
+      .set('Cookie', cookie)
+      .set('X-CSRF-Token', csrf);
 
     expect(response.statusCode).toBe(200);
   });
@@ -185,8 +206,8 @@ describe('GetPheme endpoint', () => {
       .get(`/api/v1/pheme/${lastPhemeID + 1}`)
       .set('Cookie', cookie);
 
-    expect(response.statusCode).toBe(400);
-    expect(response.headers['content-type']).toContain('application/json');
+    expect(response.statusCode).toBe(404);
+    expect(response.headers['content-type']).toContain('application/problem+json');
   });
 
   it('get posted pheme', async () => {
@@ -247,10 +268,11 @@ describe('DeletePheme endpoint', () => {
 
     const response = await request(phemeUrl)
       .delete(`/api/v1/pheme/${lastPhemeID + 10}`)
-      .set('Cookie', cookie);
+      .set('Cookie', cookie)
+      .set('X-CSRF-Token', csrf);
 
-    expect(response.statusCode).toBe(400);
-    expect(response.headers['content-type']).toContain('application/json');
+    expect(response.statusCode).toBe(404);
+    expect(response.headers['content-type']).toContain('application/problem+json');
   });
 
   it('delete posted pheme', async () => {
@@ -258,7 +280,8 @@ describe('DeletePheme endpoint', () => {
 
     const response = await request(phemeUrl)
       .delete(`/api/v1/pheme/${lastPhemeID}`)
-      .set('Cookie', cookie);
+      .set('Cookie', cookie)
+      .set('X-CSRF-Token', csrf);
 
     expect(response.statusCode).toBe(200);
     expect(response.headers['content-type']).toContain('application/json');
@@ -276,7 +299,8 @@ describe('DeletePheme endpoint', () => {
     await Promise.all(postedPhemes.map(async (id) => {
       const response = await request(phemeUrl)
         .delete(`/api/v1/pheme/${id}`)
-        .set('Cookie', cookie);
+        .set('Cookie', cookie)
+        .set('X-CSRF-Token', csrf);
 
       expect(response.statusCode).toBe(200);
       expect(response.headers['content-type']).toContain('application/json');
@@ -0,0 +1,157 @@
+import {
+  describe, it, expect, beforeAll, afterAll,
+} from '@jest/globals';
+import request from 'supertest';
+
+jest.setTimeout(10000);
+
+const authUrl = 'http://127.0.0.1:8000';
+const phemeUrl = 'http://127.0.0.1:8001';
+let cookie = '';
+let csrf = '';
+let userID = 0;
+
+async function createToken(scopes: string[]): Promise<any> {
+  const response = await request(phemeUrl)
+    .post('/api/v1/user/tokens')
+    .send({ name: 'automation', scopes })
+    .set('Cookie', cookie)
+    .set('X-CSRF-Token', csrf);
+
+  expect(response.statusCode).toBe(200);
+  expect(response.body).toHaveProperty('token');
+
+  return response.body;
+}
+
+beforeAll(async () => {
+  await request(authUrl)
+    .post('/api/v1/auth/register')
+    .send({ name: 'test.token', email: 'test.token@test.com', password: 'test' });
+
+  let response = await request(authUrl)
+    .post('/api/v1/auth/login')
+    .send({ email: 'test.token@test.com', password: 'test' });
+  cookie = response.get('Set-Cookie')[0].split(';')[0];
+
+  response = await request(authUrl)
+    .get('/api/v1/auth/user')
+    .set('Cookie', cookie);
+  userID = response.body.id;
+
+  response = await request(phemeUrl)
+    .get('/api/v1/user')
+    .set('Cookie', cookie);
+  const csrfCookie = response.get('Set-Cookie')[0].split(';')[0];
+  csrf = csrfCookie.substring(csrfCookie.indexOf('=') + 1);
+  cookie = `${cookie}; ${csrfCookie}`;
+});
+
+afterAll(async () => {
+  await request(authUrl)
+    .delete('/api/v1/auth/user')
+    .set('Cookie', cookie);
+});
+
+describe('Token endpoints', () => {
+  it('Unknown scope', async () => {
+    const response = await request(phemeUrl)
+      .post('/api/v1/user/tokens')
+      .send({ name: 'automation', scopes: ['wrong'] })
+      .set('Cookie', cookie)
+      .set('X-CSRF-Token', csrf);
+
+    expect(response.statusCode).toBe(400);
+    expect(response.headers['content-type']).toContain('application/problem+json');
+  });
+
+  it('Missing scopes', async () => {
+    const response = await request(phemeUrl)
+      .post('/api/v1/user/tokens')
+      .send({ name: 'automation', scopes: [] })
+      .set('Cookie', cookie)
+      .set('X-CSRF-Token', csrf);
+
+    expect(response.statusCode).toBe(400);
+  });
+
+  it('Create, list and revoke a token', async () => {
+    const token = await createToken(['phemes:read']);
+    expect(token.scopes).toEqual(['phemes:read']);
+    expect(token.token.startsWith(token.prefix)).toBe(true);
+
+    let response = await request(phemeUrl)
+      .get('/api/v1/pheme/mine')
+      .set('Authorization', `Bearer ${token.token}`);
+
+    expect(response.statusCode).toBe(200);
+
+    response = await request(phemeUrl)
+      .get('/api/v1/user/tokens')
+      .set('Cookie', cookie);
+
+    expect(response.statusCode).toBe(200);
+    const listed = response.body.find((item: any) => item.id === token.id);
+    expect(listed).toBeDefined();
+    expect(listed).not.toHaveProperty('token');
+    expect(listed.lastUsedAt).not.toBeNull();
+
+    response = await request(phemeUrl)
+      .delete(`/api/v1/user/tokens/${token.id}`)
+      .set('Cookie', cookie)
+      .set('X-CSRF-Token', csrf);
+
+    expect(response.statusCode).toBe(200);
+
+    response = await request(phemeUrl)
+      .get('/api/v1/pheme/mine')
+      .set('Authorization', `Bearer ${token.token}`);
+
+    expect(response.statusCode).toBe(401);
+  });
+});
+
+describe('Token scopes', () => {
+  it('Route outside the scopes', async () => {
+    const token = await createToken(['phemes:read']);
+
+    const response = await request(phemeUrl)
+      .post('/api/v1/pheme')
+      .send({
+        visibility: 0, category: 'main', text: 'Hello world!', userID,
+      })
+      .set('Authorization', `Bearer ${token.token}`);
+
+    expect(response.statusCode).toBe(403);
+  });
+
+  it('Route inside the scopes', async () => {
+    const token = await createToken(['phemes:read', 'phemes:write']);
+
+    let response = await request(phemeUrl)
+      .post('/api/v1/pheme')
+      .send({
+        visibility: 0, category: 'main', text: 'Hello world!', userID,
+      })
+      .set('Authorization', `Bearer ${token.token}`);
+
+    expect(response.statusCode).toBe(200);
+
+    response = await request(phemeUrl)
+      .delete(`/api/v1/pheme/${response.body.id}`)
+      .set('Authorization', `Bearer ${token.token}`);
+
+    expect(response.statusCode).toBe(200);
+  });
+
+  it('Tokens cannot manage tokens', async () => {
+    const token = await createToken(['phemes:read']);
+
+    const response = await request(phemeUrl)
+      .post('/api/v1/user/tokens')
+      .send({ name: 'automation', scopes: ['phemes:write'] })
+      .set('Authorization', `Bearer ${token.token}`);
+
+    expect(response.statusCode).toBe(403);
+  });
+});
@@ -15,10 +15,13 @@ class User {
 
   cookie: string = '';
 
-  constructor(id: number, userName: string, cookie: string) {
+  csrf: string = '';
+
+  constructor(id: number, userName: string, cookie: string, csrf: string) {
     this.id = id;
     this.userName = userName;
     this.cookie = cookie;
+    this.csrf = csrf;
   }
 }
 
@@ -36,8 +39,16 @@ async function createUser(userName: string): Promise<User> {
   response = await request(authUrl)
     .get('/api/v1/auth/user')
     .set('Cookie', cookie);
+  const { body } = response;
+
+  // Unsafe requests authenticated with the cookie need the CSRF token.
+  response = await request(phemeUrl)
+    .get('/api/v1/user')
+    .set('Cookie', cookie);
+  const csrfCookie = response.get('Set-Cookie')[0].split(';')[0];
+  const csrf = csrfCookie.substring(csrfCookie.indexOf('=') + 1);
 
-  return new User(response.body.id, response.body.userName, cookie);
+  return new User(body.id, body.userName, `${cookie.split(';')[0]}; ${csrfCookie}`, csrf);
 }
 
 async function deleteUser(user: User) {
@@ -49,13 +60,15 @@ async function deleteUser(user: User) {
 async function deleteFriend(userA: User, userB: User) {
   await request(phemeUrl)
     .delete(`/api/v1/user/friend/${userB.id}`)
-    .set('Cookie', userA.cookie);
+    .set('Cookie', userA.cookie)
+    .set('X-CSRF-Token', userA.csrf);
 }
 
 async function deleteFollower(userA: User, userB: User) {
   await request(phemeUrl)
     .delete(`/api/v1/user/follower/${userB.id}`)
-    .set('Cookie', userA.cookie);
+    .set('Cookie', userA.cookie)
+    .set('X-CSRF-Token', userA.csrf);
 }
 
 async function postPheme(user: User): Promise<number> {
@@ -64,7 +77,8 @@ async function postPheme(user: User): Promise<number> {
     .send({
       visibility: 0, category: 'main', text: 'Hello world!', id: user.id,
     })
-    .set('Cookie', user.cookie);
+    .set('Cookie', user.cookie)
+    .set('X-CSRF-Token', user.csrf);
 
   expect(response.statusCode).toBe(200);
   expect(response.headers['content-type']).toContain('application/json');
@@ -73,7 +87,7 @@ async function postPheme(user: User): Promise<number> {
   return response.body.id;
 }
 
-let testUser: User = new User(0, '', '');
+let testUser: User = new User(0, '', '', '');
 
 beforeAll(async () => {
   testUser = await createUser('test.user');
@@ -92,14 +106,45 @@ afterEach(async () => {
   await Promise.all(phemes.map(async (pheme: any) => {
     await request(phemeUrl)
       .delete(`/api/v1/pheme/${pheme.id}`)
-      .set('Cookie', testUser.cookie);
+      .set('Cookie', testUser.cookie)
+      .set('X-CSRF-Token', testUser.csrf);
   }));
 });
 
+describe('CurrentUser endpoint', () => {
+  it('Unauthenticated', async () => {
+    const response = await request(phemeUrl)
+      .get('/api/v1/user');
+
+    expect(response.statusCode).toBe(401);
+    expect(response.headers['content-type']).toContain('application/problem+json');
+  });
+
+  it('Logged user', async () => {
+    const response = await request(phemeUrl)
+      .get('/api/v1/user')
+      .set('Cookie', testUser.cookie);
+
+    expect(response.statusCode).toBe(200);
+    expect(response.headers['content-type']).toContain('application/json');
+    expect(response.body.id).toBe(testUser.id);
+    expect(response.body.userName).toBe(testUser.userName);
+  });
+});
+
 describe('GetUser endpoint', () => {
+  it('Unauthenticated', async () => {
+    const response = await request(phemeUrl)
+      .get(`/api/v1/user/${testUser.userName}`);
+
+    expect(response.statusCode).toBe(401);
+    expect(response.headers['content-type']).toContain('application/problem+json');
+  });
+
   it('Missing username', async () => {
     const response = await request(phemeUrl)
-      .get('/api/v1/user/wrong');
+      .get('/api/v1/user/wrong')
+      .set('Cookie', testUser.cookie);
 
     expect(response.statusCode).toBe(200);
     expect(response.headers['content-type']).toContain('application/json');
@@ -108,7 +153,8 @@ describe('GetUser endpoint', () => {
 
   it('Search single user', async () => {
     const response = await request(phemeUrl)
-      .get(`/api/v1/user/${testUser.userName}`);
+      .get(`/api/v1/user/${testUser.userName}`)
+      .set('Cookie', testUser.cookie);
 
     expect(response.statusCode).toBe(200);
     expect(response.headers['content-type']).toContain('application/json');
@@ -128,7 +174,8 @@ describe('GetUser endpoint', () => {
     }));
 
     const response = await request(phemeUrl)
-      .get(`/api/v1/user/${name}`);
+      .get(`/api/v1/user/${name}`)
+      .set('Cookie', testUser.cookie);
 
     expect(response.statusCode).toBe(200);
     expect(response.headers['content-type']).toContain('application/json');
@@ -149,28 +196,31 @@ describe('Friend endpoint', () => {
   it('Wrong user', async () => {
     const response = await request(phemeUrl)
       .put(`/api/v1/user/friend/${testUser.id + 1}`)
-      .set('Cookie', testUser.cookie);
+      .set('Cookie', testUser.cookie)
+      .set('X-CSRF-Token', testUser.csrf);
 
-    expect(response.statusCode).toBe(400);
-    expect(response.headers['content-type']).toContain('application/json');
+    expect(response.statusCode).toBe(404);
+    expect(response.headers['content-type']).toContain('application/problem+json');
   });
 
   it('Add same user', async () => {
     const response = await request(phemeUrl)
       .put(`/api/v1/user/friend/${testUser.id}`)
-      .set('Cookie', testUser.cookie);
+      .set('Cookie', testUser.cookie)
+      .set('X-CSRF-Token', testUser.csrf);
 
     expect(response.statusCode).toBe(400);
-    expect(response.headers['content-type']).toContain('application/json');
+    expect(response.headers['content-type']).toContain('application/problem+json');
   });
 
   it('Remove same user', async () => {
     const response = await request(phemeUrl)
       .delete(`/api/v1/user/friend/${testUser.id}`)
-      .set('Cookie', testUser.cookie);
+      .set('Cookie', testUser.cookie)
+      .set('X-CSRF-Token', testUser.csrf);
 
     expect(response.statusCode).toBe(400);
-    expect(response.headers['content-type']).toContain('application/json');
+    expect(response.headers['content-type']).toContain('application/problem+json');
   });
 
   it('Add Valid friend', async () => {
@@ -178,7 +228,8 @@ describe('Friend endpoint', () => {
 
     const response = await request(phemeUrl)
       .put(`/api/v1/user/friend/${friend.id}`)
-      .set('Cookie', testUser.cookie);
+      .set('Cookie', testUser.cookie)
+      .set('X-CSRF-Token', testUser.csrf);
 
     expect(response.statusCode).toBe(200);
     expect(response.headers['content-type']).toContain('application/json');
@@ -193,28 +244,31 @@ describe('Follower endpoint', () => {
   it('Wrong user', async () => {
     const response = await request(phemeUrl)
       .put(`/api/v1/user/follower/${testUser.id + 1}`)
-      .set('Cookie', testUser.cookie);
+      .set('Cookie', testUser.cookie)
+      .set('X-CSRF-Token', testUser.csrf);
 
-    expect(response.statusCode).toBe(400);
-    expect(response.headers['content-type']).toContain('application/json');
+    expect(response.statusCode).toBe(404);
+    expect(response.headers['content-type']).toContain('application/problem+json');
   });
 
   it('Add same user', async () => {
     const response = await request(phemeUrl)
       .put(`/api/v1/user/follower/${testUser.id}`)
-      .set('Cookie', testUser.cookie);
+      .set('Cookie', testUser.cookie)
+      .set('X-CSRF-Token', testUser.csrf);
 
     expect(response.statusCode).toBe(400);
-    expect(response.headers['content-type']).toContain('application/json');
+    expect(response.headers['content-type']).toContain('application/problem+json');
   });
 
   it('Remove same user', async () => {
     const response = await request(phemeUrl)
       .delete(`/api/v1/user/follower/${testUser.id}`)
-      .set('Cookie', testUser.cookie);
+      .set('Cookie', testUser.cookie)
+      .set('X-CSRF-Token', testUser.csrf);
 
     expect(response.statusCode).toBe(400);
-    expect(response.headers['content-type']).toContain('application/json');
+    expect(response.headers['content-type']).toContain('application/problem+json');
   });
 
   it('Add Valid follower', async () => {
@@ -222,7 +276,8 @@ describe('Follower endpoint', () => {
 
     const response = await request(phemeUrl)
       .put(`/api/v1/user/follower/${friend.id}`)
-      .set('Cookie', testUser.cookie);
+      .set('Cookie', testUser.cookie)
+      .set('X-CSRF-Token', testUser.csrf);
 
     expect(response.statusCode).toBe(200);
     expect(response.headers['content-type']).toContain('application/json');
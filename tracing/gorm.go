@@ -0,0 +1,73 @@
+package tracing
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// spanKey stores the span of a query in the statement.
+const spanKey = "tracing:span"
+
+// Instrument starts a span for every query of the database, child of the span
+// of the context of the query.
+func Instrument(db *gorm.DB, provider trace.TracerProvider) error {
+	tracer := provider.Tracer(instrumentation)
+	system := semconv.DBSystemKey.String(db.Dialector.Name())
+
+	callbacks := db.Callback()
+	for _, err := range []error{
+		callbacks.Create().Before("*").Register("tracing:before_create", start(tracer, "create", system)),
+		callbacks.Create().After("*").Register("tracing:after_create", end),
+		callbacks.Query().Before("*").Register("tracing:before_query", start(tracer, "query", system)),
+		callbacks.Query().After("*").Register("tracing:after_query", end),
+		callbacks.Update().Before("*").Register("tracing:before_update", start(tracer, "update", system)),
+		callbacks.Update().After("*").Register("tracing:after_update", end),
+		callbacks.Delete().Before("*").Register("tracing:before_delete", start(tracer, "delete", system)),
+		callbacks.Delete().After("*").Register("tracing:after_delete", end),
+		callbacks.Row().Before("*").Register("tracing:before_row", start(tracer, "row", system)),
+		callbacks.Row().After("*").Register("tracing:after_row", end),
+		callbacks.Raw().Before("*").Register("tracing:before_raw", start(tracer, "raw", system)),
+		callbacks.Raw().After("*").Register("tracing:after_raw", end),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// start returns the callback starting the span of the query of the operation.
+func start(tracer trace.Tracer, operation string, system attribute.KeyValue) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx, span := tracer.Start(db.Statement.Context, "gorm."+operation,
+			trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(system))
+		db.Statement.Context = ctx
+		db.InstanceSet(spanKey, span)
+	}
+}
+
+// end ends the span of the query with its statement and error.
+func end(db *gorm.DB) {
+	value, ok := db.InstanceGet(spanKey)
+	if !ok {
+		return
+	}
+	span := value.(trace.Span)
+	defer span.End()
+
+	if db.Statement.Table != "" {
+		span.SetAttributes(semconv.DBSQLTable(db.Statement.Table))
+	}
+	span.SetAttributes(semconv.DBStatement(db.Statement.SQL.String()))
+
+	if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		span.RecordError(db.Error)
+		span.SetStatus(codes.Error, db.Error.Error())
+	}
+}
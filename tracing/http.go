@@ -0,0 +1,72 @@
+package tracing
+
+import (
+	"github.com/feserr/pheme-user/problem"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware starts a span for every request, continuing the trace of its
+// traceparent header, and stores it in the user context so the queries of
+// the request are its children. The span is named after the route template.
+func Middleware(provider trace.TracerProvider) fiber.Handler {
+	tracer := provider.Tracer(instrumentation)
+
+	return func(c *fiber.Ctx) error {
+		mount := c.Route().Path
+		method := utils.CopyString(c.Method())
+
+		ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), headerCarrier{&c.Request().Header})
+		ctx, span := tracer.Start(ctx, "HTTP "+method, trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPMethod(method), semconv.HTTPTarget(utils.CopyString(c.OriginalURL()))))
+		defer span.End()
+
+		c.SetUserContext(ctx)
+		err := c.Next()
+
+		// The error handler writes the status after the middlewares return.
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = problem.Status(err)
+			span.RecordError(err)
+		}
+
+		if route := c.Route().Path; route != mount {
+			span.SetName(method + " " + route)
+			span.SetAttributes(semconv.HTTPRoute(route))
+		}
+		span.SetAttributes(semconv.HTTPStatusCode(status))
+		if status >= fiber.StatusInternalServerError {
+			span.SetStatus(codes.Error, "")
+		}
+
+		return err
+	}
+}
+
+// headerCarrier reads and writes the propagated context in the headers.
+type headerCarrier struct {
+	header *fasthttp.RequestHeader
+}
+
+func (h headerCarrier) Get(key string) string {
+	return string(h.header.Peek(key))
+}
+
+func (h headerCarrier) Set(key string, value string) {
+	h.header.Set(key, value)
+}
+
+func (h headerCarrier) Keys() []string {
+	keys := []string{}
+	h.header.VisitAll(func(key, _ []byte) {
+		keys = append(keys, string(key))
+	})
+
+	return keys
+}
@@ -0,0 +1,89 @@
+// Package tracing OpenTelemetry traces of the service
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentation is the name of the tracers of the service.
+const instrumentation = "github.com/feserr/pheme-user"
+
+// Exporters of the spans.
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// Config of the traces.
+type Config struct {
+	// Exporter of the spans: none, otlp or stdout.
+	Exporter string
+	// Endpoint of the OTLP HTTP collector, e.g. http://localhost:4318. The
+	// exporter default, https://localhost:4318, is used when empty.
+	Endpoint string
+	// ServiceName is the service.name of the spans.
+	ServiceName string
+}
+
+// Setup returns the tracer provider of the exporter of the config and its
+// shutdown, which flushes the pending spans. The stdout exporter writes to
+// output. The W3C trace context is set as the global propagator, so the traces
+// continue the ones of the pheme-auth service.
+func Setup(ctx context.Context, config Config, output io.Writer) (trace.TracerProvider, func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch config.Exporter {
+	case "", ExporterNone:
+		return trace.NewNoopTracerProvider(), func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		exporter, err = otlpExporter(ctx, config.Endpoint)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(output))
+	default:
+		err = fmt.Errorf("unknown trace exporter %q, must be none, otlp or stdout", config.Exporter)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(config.ServiceName))),
+	)
+
+	return provider, provider.Shutdown, nil
+}
+
+// otlpExporter returns the OTLP HTTP exporter of the endpoint, a URL or a
+// host:port.
+func otlpExporter(ctx context.Context, endpoint string) (sdktrace.SpanExporter, error) {
+	options := []otlptracehttp.Option{}
+	if parsed, err := url.Parse(endpoint); err == nil && parsed.Host != "" {
+		options = append(options, otlptracehttp.WithEndpoint(parsed.Host))
+		if parsed.Scheme == "http" {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		if parsed.Path != "" && parsed.Path != "/" {
+			options = append(options, otlptracehttp.WithURLPath(parsed.Path))
+		}
+	} else if endpoint != "" {
+		options = append(options, otlptracehttp.WithEndpoint(endpoint))
+	}
+
+	return otlptracehttp.New(ctx, options...)
+}
@@ -0,0 +1,43 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"testing"
+)
+
+func TestSetup(t *testing.T) {
+	provider, shutdown, err := Setup(context.Background(), Config{Exporter: ExporterNone}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := provider.(interface{ Shutdown(context.Context) error }); ok {
+		t.Errorf("got provider %T, want a no-op one", provider)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Error(err)
+	}
+
+	for _, endpoint := range []string{"", "http://localhost:4318", "https://collector:4318/custom/v1/traces", "localhost:4318"} {
+		provider, shutdown, err := Setup(context.Background(), Config{Exporter: ExporterOTLP, Endpoint: endpoint, ServiceName: "test"}, io.Discard)
+		if err != nil {
+			t.Errorf("endpoint %q: %v", endpoint, err)
+			continue
+		}
+
+		_, span := provider.Tracer("test").Start(context.Background(), "span")
+		if !span.SpanContext().IsValid() {
+			t.Errorf("endpoint %q: got an invalid span", endpoint)
+		}
+		span.End()
+
+		// The spans are not sent, there is no collector.
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_ = shutdown(ctx)
+	}
+
+	if _, _, err := Setup(context.Background(), Config{Exporter: "zipkin"}, io.Discard); err == nil {
+		t.Error("expected an error for an unknown exporter")
+	}
+}